@@ -0,0 +1,154 @@
+// Package audit records every change the driver makes on OneFS, in an
+// append-only trail of JSON lines: who asked for it, what changed, when, and
+// its result.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Results of an operation.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Destinations of the audit log, besides a file path.
+const (
+	Disabled = ""
+	Stdout   = "stdout"
+)
+
+// Record is the audit record of a mutating operation.
+type Record struct {
+	Time time.Time `json:"time"`
+	// Name of the driver instance.
+	Driver string `json:"driver"`
+	// ID of the gRPC request the operation is part of, if any.
+	RequestID string `json:"requestID,omitempty"`
+	// COSI object the operation is made for, if known.
+	Actor     *Actor `json:"actor,omitempty"`
+	Operation string `json:"operation"`
+
+	Bucket     string `json:"bucket,omitempty"`
+	User       string `json:"user,omitempty"`
+	Group      string `json:"group,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Grantee    string `json:"grantee,omitempty"`
+	Permission string `json:"permission,omitempty"`
+	// Sid of the bucket policy statements.
+	Sid string `json:"sid,omitempty"`
+	// Bucket ACL before and after an ACL change.
+	Before any `json:"before,omitempty"`
+	After  any `json:"after,omitempty"`
+
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Kinds of actors.
+const (
+	KindBucketClaim  = "BucketClaim"
+	KindBucketAccess = "BucketAccess"
+	KindBucket       = "Bucket"
+)
+
+// Actor is the BucketClaim or BucketAccess an operation is made for.
+type Actor struct {
+	// KindBucketClaim, KindBucketAccess, or KindBucket when the claim is
+	// unknown.
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	UID       string `json:"uid,omitempty"`
+	// Account of a BucketAccess, the only identity of a revocation.
+	AccountID string `json:"accountID,omitempty"`
+}
+
+// Sink stores the audit records.
+type Sink interface {
+	Write(record *Record) error
+}
+
+// New returns the sink of a destination: Disabled, Stdout or a file path.
+// It returns nil when the audit log is disabled.
+func New(destination string) (Sink, error) {
+	switch destination {
+	case Disabled:
+		return nil, nil
+	case Stdout:
+		return NewWriterSink(os.Stdout), nil
+	default:
+		return NewFileSink(destination)
+	}
+}
+
+// WriterSink writes the records as JSON lines.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// Write writes a record on a single line, so that concurrent records are not
+// interleaved.
+func (s *WriterSink) Write(record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(data)
+	return err
+}
+
+// FileSink appends the records to a file, synced after every record.
+type FileSink struct {
+	WriterSink
+	file *os.File
+}
+
+// NewFileSink opens the file in append mode, creating it if needed.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &FileSink{WriterSink: WriterSink{w: file}, file: file}, nil
+}
+
+func (s *FileSink) Write(record *Record) error {
+	if err := s.WriterSink.Write(record); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+type actorKey struct{}
+
+// WithActor returns a context carrying the actor of the operations.
+func WithActor(ctx context.Context, actor *Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor of the context, or nil.
+func ActorFromContext(ctx context.Context) *Actor {
+	actor, _ := ctx.Value(actorKey{}).(*Actor)
+	return actor
+}
@@ -0,0 +1,39 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Records are appended to an existing audit log, e.g. after a restart.
+func TestFileSinkAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for _, operation := range []string{"CreateBucket", "DeleteBucket"} {
+		sink, err := NewFileSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Write(&Record{Operation: operation, Result: ResultSuccess}); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", data)
+	}
+	for i, operation := range []string{"CreateBucket", "DeleteBucket"} {
+		if !strings.Contains(lines[i], `"operation":"`+operation+`"`) {
+			t.Errorf("unexpected line %d: %s", i, lines[i])
+		}
+	}
+}
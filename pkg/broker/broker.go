@@ -0,0 +1,253 @@
+// Package broker hands out short-lived S3 keys to pods, so that the keys
+// stored in the BucketAccess secrets expire shortly after being issued.
+//
+// A key is valid for the configured TTL. Once a key reaches half of its TTL,
+// it is rotated through OneFS with the old key expiring at the end of its
+// TTL, so a key handed out is always valid for at least TTL/2. The accounts
+// are recorded on OneFS, so that their rotation resumes after a restart.
+//
+// The credentials are only served over TLS.
+package broker
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "k8s.io/klog/v2"
+
+	"github.com/japannext/cosi-powerscale/pkg/config"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+	"github.com/japannext/cosi-powerscale/pkg/redact"
+)
+
+var (
+	ErrUnauthenticated = errors.New("invalid service account token")
+	ErrForbidden       = errors.New("bucket access not owned by the namespace")
+)
+
+// Reviewer authenticates pods and authorizes their requests.
+type Reviewer interface {
+	// Authenticate validates a projected service account token and returns
+	// the namespace of its service account.
+	Authenticate(ctx context.Context, token string) (string, error)
+	// Owns reports whether a BucketAccess of the namespace was granted
+	// the given account.
+	Owns(ctx context.Context, namespace, accountID string) (bool, error)
+}
+
+// Credentials are the time-limited S3 credentials of an account.
+type Credentials struct {
+	AccessKeyID     string    `json:"accessKeyID"`
+	AccessSecretKey string    `json:"accessSecretKey"`
+	Endpoint        string    `json:"endpoint"`
+	Region          string    `json:"region,omitempty"`
+	Expiration      time.Time `json:"expiration"`
+}
+
+// loggedCredentials are Credentials without the MarshalLog method.
+type loggedCredentials Credentials
+
+// MarshalLog hides the secret key from the logs.
+func (c Credentials) MarshalLog() any {
+	if c.AccessSecretKey != "" {
+		c.AccessSecretKey = redact.Placeholder
+	}
+	return loggedCredentials(c)
+}
+
+type Broker struct {
+	powerscale  *powerscale.Server
+	reviewer    Reviewer
+	address     string
+	ttl         time.Duration
+	certificate *certificate
+
+	mu sync.Mutex
+	// Accounts whose keys are refreshed in the background.
+	accounts map[string]struct{}
+	// Serializes the rotation of the key of an account. The mutexes are
+	// kept when the account is forgotten, a rotation may still hold it.
+	locks map[string]*sync.Mutex
+}
+
+func New(cfg *config.Config, server *powerscale.Server, reviewer Reviewer) *Broker {
+	return &Broker{
+		powerscale:  server,
+		reviewer:    reviewer,
+		address:     cfg.BrokerAddress,
+		ttl:         cfg.BrokerKeyTTL,
+		certificate: &certificate{certFile: cfg.BrokerTLSCert, keyFile: cfg.BrokerTLSKey},
+		accounts:    make(map[string]struct{}),
+		locks:       make(map[string]*sync.Mutex),
+	}
+}
+
+func (b *Broker) lock(accountID string) *sync.Mutex {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	l, ok := b.locks[accountID]
+	if !ok {
+		l = &sync.Mutex{}
+		b.locks[accountID] = l
+	}
+	return l
+}
+
+// Issue returns the current key of the account, rotating it first when it is
+// past half of its TTL. The account is then refreshed in the background.
+func (b *Broker) Issue(accountID string) (*Credentials, error) {
+	l := b.lock(accountID)
+	l.Lock()
+	defer l.Unlock()
+
+	// The account is recorded before its key is handed out, a key that is
+	// not rotated would never expire.
+	b.mu.Lock()
+	_, known := b.accounts[accountID]
+	b.mu.Unlock()
+	if !known {
+		if err := b.powerscale.AddBrokerAccount(accountID); err != nil {
+			return nil, err
+		}
+		b.mu.Lock()
+		b.accounts[accountID] = struct{}{}
+		b.mu.Unlock()
+	}
+
+	key, err := b.refresh(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credentials{
+		AccessKeyID:     key.AccessID,
+		AccessSecretKey: key.SecretKey,
+		Endpoint:        b.powerscale.S3Endpoint,
+		Region:          b.powerscale.S3Region,
+		Expiration:      key.CreatedAt().Add(b.ttl),
+	}, nil
+}
+
+// Forget stops the background refresh of the account.
+func (b *Broker) Forget(ctx context.Context, accountID string) error {
+	if err := b.powerscale.WithContext(ctx).RemoveBrokerAccount(accountID); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.accounts, accountID)
+	return nil
+}
+
+// restore resumes the refresh of the accounts recorded on OneFS.
+func (b *Broker) restore() error {
+	accounts, err := b.powerscale.ListBrokerAccounts()
+	if err != nil {
+		log.ErrorS(err, "failed to restore the broker accounts, retrying")
+		return err
+	}
+	b.mu.Lock()
+	for _, accountID := range accounts {
+		b.accounts[accountID] = struct{}{}
+	}
+	b.mu.Unlock()
+	log.InfoS("Broker restored accounts", "accounts", len(accounts))
+	return nil
+}
+
+// refresh rotates the key of the account if needed and returns the current one.
+func (b *Broker) refresh(accountID string) (*powerscale.Key, error) {
+	key, err := b.powerscale.GetKey(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil && time.Since(key.CreatedAt()) < b.ttl/2 {
+		return key, nil
+	}
+
+	// The previous key may have been handed out, keep it until the end of its TTL.
+	existingKeyExpiry := time.Minute
+	if key != nil {
+		if remaining := b.ttl - time.Since(key.CreatedAt()); remaining > existingKeyExpiry {
+			existingKeyExpiry = remaining
+		}
+	}
+	newKey, err := b.powerscale.RotateKey(accountID, existingKeyExpiry)
+	if err != nil {
+		return nil, err
+	}
+	if newKey.SecretKeyTimestamp == 0 {
+		newKey.SecretKeyTimestamp = time.Now().Unix()
+	}
+	log.InfoS("Broker rotated key", "accountID", accountID, "existingKeyExpiry", existingKeyExpiry)
+	return newKey, nil
+}
+
+// refreshAll rotates the keys of every known account nearing expiry.
+func (b *Broker) refreshAll() {
+	b.mu.Lock()
+	accounts := make([]string, 0, len(b.accounts))
+	for accountID := range b.accounts {
+		accounts = append(accounts, accountID)
+	}
+	b.mu.Unlock()
+
+	for _, accountID := range accounts {
+		if _, err := b.Issue(accountID); err != nil {
+			log.ErrorS(err, "failed to refresh key", "accountID", accountID)
+		}
+	}
+}
+
+// Run serves the broker endpoint over TLS and refreshes the keys until ctx
+// is done.
+func (b *Broker) Run(ctx context.Context) error {
+	// Fail early on invalid TLS files.
+	if _, err := b.certificate.get(nil); err != nil {
+		return fmt.Errorf("failed to load the broker certificate: %w", err)
+	}
+	server := &http.Server{
+		Addr:    b.address,
+		Handler: b.Handler(),
+		TLSConfig: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: b.certificate.get,
+		},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		// The accounts are restored before the first refresh, retried on
+		// each tick until OneFS is reachable.
+		restored := b.restore() == nil
+		ticker := time.NewTicker(b.ttl / 10)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !restored {
+					restored = b.restore() == nil
+				}
+				b.refreshAll()
+			}
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	log.InfoS("Credential broker listening", "address", b.address, "keyTTL", b.ttl)
+	if err := server.ListenAndServeTLS("", ""); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale/fake"
+)
+
+func newTestBroker(t *testing.T, reviewer Reviewer) (*fake.Server, *Broker) {
+	t.Helper()
+	server := fake.NewServer()
+	t.Cleanup(server.Close)
+	cfg := server.Config()
+	cfg.BrokerKeyTTL = time.Hour
+	client := powerscale.New(cfg)
+	if err := client.CreateUser("ba-1", client.NewOwnership("", "", "")); err != nil {
+		t.Fatal(err)
+	}
+	return server, New(cfg, client, reviewer)
+}
+
+func TestIssue(t *testing.T) {
+	server, b := newTestBroker(t, nil)
+
+	issued, err := b.Issue("ba-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := server.Key("ba-1")
+	if key == nil || issued.AccessKeyID != key.AccessID {
+		t.Fatalf("unexpected credentials %+v", issued)
+	}
+	if expiration := time.Until(issued.Expiration); expiration <= 59*time.Minute || expiration > time.Hour {
+		t.Errorf("unexpected expiration %v", issued.Expiration)
+	}
+	if _, ok := b.accounts["ba-1"]; !ok {
+		t.Error("the account must be refreshed in the background")
+	}
+
+	// A key younger than half of the TTL is handed out again.
+	again, err := b.Issue("ba-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.AccessKeyID != issued.AccessKeyID {
+		t.Errorf("unexpected rotation to %s", again.AccessKeyID)
+	}
+
+	// Older keys are rotated, the previous key stays valid until the end
+	// of its TTL.
+	b.ttl = time.Nanosecond
+	rotated, err := b.Issue("ba-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key = server.Key("ba-1")
+	if rotated.AccessKeyID == issued.AccessKeyID || rotated.AccessKeyID != key.AccessID {
+		t.Errorf("expected a new key, got %+v", rotated)
+	}
+	if key.OldKeyExpiry == 0 {
+		t.Error("the previous key must expire later")
+	}
+
+	l := b.lock("ba-1")
+	if err := b.Forget(context.Background(), "ba-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.accounts["ba-1"]; ok {
+		t.Error("the account must be forgotten")
+	}
+	// A rotation still running keeps serializing the next ones.
+	if b.lock("ba-1") != l {
+		t.Error("the lock of the account must be kept")
+	}
+}
+
+// reviewer authenticates the token "token-<namespace>" and grants the
+// accounts of its map.
+type reviewer map[string]string
+
+func (r reviewer) Authenticate(ctx context.Context, token string) (string, error) {
+	for _, namespace := range r {
+		if token == "token-"+namespace {
+			return namespace, nil
+		}
+	}
+	return "", errors.New("unknown token")
+}
+
+func (r reviewer) Owns(ctx context.Context, namespace, accountID string) (bool, error) {
+	return r[accountID] == namespace, nil
+}
+
+func TestHandler(t *testing.T) {
+	_, b := newTestBroker(t, reviewer{"ba-1": "ns-1", "ba-2": "ns-2"})
+	handler := b.Handler()
+
+	tests := []struct {
+		token     string
+		accountID string
+		want      int
+	}{
+		{"", "ba-1", http.StatusUnauthorized},
+		{"token-ns-3", "ba-1", http.StatusUnauthorized},
+		{"token-ns-1", "", http.StatusBadRequest},
+		{"token-ns-2", "ba-1", http.StatusForbidden},
+		{"token-ns-1", "ba-1", http.StatusOK},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/v1/credentials?accountId="+test.accountID, nil)
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.want {
+			t.Errorf("%s for %s: got %d, want %d", test.token, test.accountID, rec.Code, test.want)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		var credentials Credentials
+		if err := json.NewDecoder(rec.Body).Decode(&credentials); err != nil {
+			t.Fatal(err)
+		}
+		if credentials.AccessKeyID == "" || credentials.Endpoint == "" {
+			t.Errorf("unexpected credentials %+v", credentials)
+		}
+		if cache := rec.Header().Get("Cache-Control"); cache != "no-store" {
+			t.Errorf("unexpected Cache-Control %q", cache)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	server, b := newTestBroker(t, nil)
+	if _, err := b.Issue("ba-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted broker keeps rotating the keys it handed out.
+	cfg := server.Config()
+	cfg.BrokerKeyTTL = time.Hour
+	restarted := New(cfg, b.powerscale, nil)
+	if err := restarted.restore(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restarted.accounts["ba-1"]; !ok {
+		t.Fatalf("account not restored: %v", restarted.accounts)
+	}
+
+	if err := restarted.Forget(context.Background(), "ba-1"); err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := b.powerscale.ListBrokerAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 0 {
+		t.Errorf("expected no account, got %v", accounts)
+	}
+}
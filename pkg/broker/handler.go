@@ -0,0 +1,70 @@
+package broker
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	log "k8s.io/klog/v2"
+)
+
+// Handler serves `GET /v1/credentials?accountId=<accountID>`.
+//
+// Pods authenticate with a projected service account token in the
+// `Authorization: Bearer` header, and may only request the credentials of
+// a BucketAccess of their own namespace.
+func (b *Broker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/credentials", b.serveCredentials)
+	return mux
+}
+
+func (b *Broker) serveCredentials(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		http.Error(w, ErrUnauthenticated.Error(), http.StatusUnauthorized)
+		return
+	}
+	accountID := r.URL.Query().Get("accountId")
+	if accountID == "" {
+		http.Error(w, "missing accountId", http.StatusBadRequest)
+		return
+	}
+
+	namespace, err := b.reviewer.Authenticate(r.Context(), token)
+	if err != nil {
+		log.ErrorS(err, "broker authentication failed", "accountID", accountID)
+		http.Error(w, ErrUnauthenticated.Error(), http.StatusUnauthorized)
+		return
+	}
+	owned, err := b.reviewer.Owns(r.Context(), namespace, accountID)
+	if err != nil {
+		log.ErrorS(err, "broker authorization failed", "accountID", accountID, "namespace", namespace)
+		http.Error(w, "authorization failed", http.StatusInternalServerError)
+		return
+	}
+	if !owned {
+		log.ErrorS(ErrForbidden, "broker request denied", "accountID", accountID, "namespace", namespace)
+		http.Error(w, ErrForbidden.Error(), http.StatusForbidden)
+		return
+	}
+
+	credentials, err := b.Issue(accountID)
+	if err != nil {
+		log.ErrorS(err, "failed to issue credentials", "accountID", accountID, "namespace", namespace)
+		http.Error(w, "failed to issue credentials", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(credentials); err != nil {
+		log.ErrorS(err, "failed to write credentials", "accountID", accountID)
+	}
+	log.InfoS("Broker issued credentials", "accountID", accountID, "namespace", namespace, "expiration", credentials.Expiration)
+}
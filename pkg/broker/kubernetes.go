@@ -0,0 +1,65 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	authv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/japannext/cosi-powerscale/pkg/kube"
+)
+
+// kubeReviewer authenticates tokens with the TokenReview API and looks up
+// the BucketAccess objects of the namespace.
+type kubeReviewer struct {
+	client   *kube.Client
+	audience string
+}
+
+// NewKubeReviewer returns a Reviewer using the Kubernetes API.
+func NewKubeReviewer(client *kube.Client, audience string) Reviewer {
+	return &kubeReviewer{client: client, audience: audience}
+}
+
+func (k *kubeReviewer) Authenticate(ctx context.Context, token string) (string, error) {
+	review := &authv1.TokenReview{
+		Spec: authv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: []string{k.audience},
+		},
+	}
+	result, err := k.client.Clientset.AuthenticationV1().TokenReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+	if !result.Status.Authenticated {
+		return "", fmt.Errorf("%w: %s", ErrUnauthenticated, result.Status.Error)
+	}
+
+	// Username is `system:serviceaccount:<namespace>:<name>`.
+	parts := strings.Split(result.Status.User.Username, ":")
+	if len(parts) != 4 || parts[0] != "system" || parts[1] != "serviceaccount" {
+		return "", fmt.Errorf("%w: %s is not a service account", ErrUnauthenticated, result.Status.User.Username)
+	}
+	return parts[2], nil
+}
+
+func (k *kubeReviewer) Owns(ctx context.Context, namespace, accountID string) (bool, error) {
+	items, err := k.client.ListBucketAccesses(ctx, namespace)
+	if err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		id, _, err := unstructured.NestedString(item.Object, "status", "accountID")
+		if err != nil {
+			continue
+		}
+		if id == accountID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,53 @@
+package broker
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	log "k8s.io/klog/v2"
+)
+
+// certificate is the serving certificate of the broker, reloaded when its
+// files change, e.g. when the secret is renewed by cert-manager.
+type certificate struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	current *tls.Certificate
+	modTime time.Time
+}
+
+// get returns the current certificate. When the new files cannot be loaded,
+// the previous certificate is kept.
+func (c *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		if c.current != nil {
+			return c.current, nil
+		}
+		return nil, err
+	}
+	if c.current != nil && info.ModTime().Equal(c.modTime) {
+		return c.current, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.current != nil {
+			log.ErrorS(err, "failed to reload the broker certificate, keeping the previous one", "certFile", c.certFile)
+			return c.current, nil
+		}
+		return nil, err
+	}
+	if c.current != nil {
+		log.InfoS("Broker certificate reloaded", "certFile", c.certFile)
+	}
+	c.current = &cert
+	c.modTime = info.ModTime()
+	return c.current, nil
+}
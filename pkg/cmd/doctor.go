@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/japannext/cosi-powerscale/pkg/doctor"
+)
+
+// doctorCmd checks the configuration against the cluster and returns the exit
+// code of the process.
+func doctorCmd(args []string) int {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	loadConfig := configFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s doctor [-config file] [-profile name]\n\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Check the connectivity and permissions of the driver, configured by the config file and the POWERSCALE_* environment variables.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if !doctor.Write(os.Stdout, doctor.Run(cfg)) {
+		return 1
+	}
+	return 0
+}
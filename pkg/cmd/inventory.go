@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/japannext/cosi-powerscale/pkg/inventory"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+)
+
+// inventoryCmd prints the buckets managed by the driver and returns the exit
+// code of the process.
+func inventoryCmd(args []string) int {
+	flags := flag.NewFlagSet("inventory", flag.ContinueOnError)
+	output := flags.String("o", inventory.FormatTable, "output format: table, json or csv")
+	loadConfig := configFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s inventory [-o table|json|csv] [-config file] [-profile name]\n\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "List the buckets created by the driver, configured by the config file and the POWERSCALE_* environment variables.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if err := inventory.CheckFormat(*output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	records, err := inventory.Collect(powerscale.New(cfg))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "inventory failed: %v\n", err)
+		return 1
+	}
+	if err := inventory.Write(os.Stdout, *output, records); err != nil {
+		fmt.Fprintf(os.Stderr, "inventory failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -2,20 +2,48 @@ package cmd
 
 import (
 	"context"
+	"flag"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/japannext/cosi-powerscale/pkg/config"
 	"github.com/japannext/cosi-powerscale/pkg/driver"
+	"github.com/japannext/cosi-powerscale/pkg/tracing"
 	log "k8s.io/klog/v2"
 )
 
 func Execute() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "inventory":
+			os.Exit(inventoryCmd(os.Args[2:]))
+		case "doctor":
+			os.Exit(doctorCmd(os.Args[2:]))
+		}
+	}
+
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	loadConfig := configFlags(flags)
+	// Logging flags, e.g. -v for the verbosity.
+	log.InitFlags(flags)
+	flags.Parse(os.Args[1:])
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	cfg := config.New()
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Name)
+	if err != nil {
+		log.Fatal(err)
+	}
 	d, err := driver.New(cfg)
 	if err != nil {
 		log.Fatal(err)
@@ -28,8 +56,24 @@ func Execute() {
 		sig := <-sigs
 		log.InfoS("Signal received", "type", sig)
 		cancel()
+		// Flush the pending spans.
+		flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelFlush()
+		if err := shutdownTracing(flushCtx); err != nil {
+			log.ErrorS(err, "Failed to flush traces")
+		}
 		os.Exit(1)
 	}()
 
 	d.Run(ctx)
 }
+
+// configFlags registers the flags selecting the config file, and returns the
+// function loading the configuration once the flags are parsed.
+func configFlags(flags *flag.FlagSet) func() (*config.Config, error) {
+	file := flags.String("config", os.Getenv("POWERSCALE_CONFIG_FILE"), "path of the YAML or JSON config file, overridden by the POWERSCALE_* environment variables")
+	profile := flags.String("profile", os.Getenv("POWERSCALE_PROFILE"), "profile of the config file")
+	return func() (*config.Config, error) {
+		return config.Load(*file, *profile)
+	}
+}
@@ -1,6 +1,11 @@
 package config
 
 import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/spf13/viper"
 	log "k8s.io/klog/v2"
 )
@@ -12,43 +17,167 @@ type Config struct {
 	ApiEndpoint string `mapstructure:"POWERSCALE_API_ENDPOINT"`
 	ApiUsername string `mapstructure:"POWERSCALE_API_USERNAME"`
 	ApiPassword string `mapstructure:"POWERSCALE_API_PASSWORD"`
+	// Files holding the API credentials, used when the literal values are
+	// not set in the environment.
+	ApiUsernameFile string `mapstructure:"POWERSCALE_API_USERNAME_FILE"`
+	ApiPasswordFile string `mapstructure:"POWERSCALE_API_PASSWORD_FILE"`
 	// URL address of the S3 Powerscale endpoint.
 	// Example: `https://data.nas.example.com:9021`
 	S3Endpoint string `mapstructure:"POWERSCALE_S3_ENDPOINT"`
 	S3Region   string `mapstructure:"POWERSCALE_S3_REGION"`
 	Zone       string `mapstructure:"POWERSCALE_ZONE"`
 	BasePath   string `mapstructure:"POWERSCALE_BASE_PATH"`
+	// Prefix of the users and groups created by the driver, it must start
+	// with `<name>-`. Defaults to `<name>-`.
+	IdentityPrefix string `mapstructure:"POWERSCALE_IDENTITY_PREFIX"`
 	// TLS options
 	TlsInsecureSkipVerify bool   `mapstructure:"POWERSCALE_TLS_INSECURE_SKIP_VERIFY"`
 	TlsClientCert         string `mapstructure:"POWERSCALE_TLS_CLIENT_CERT"`
 	TlsClientKey          string `mapstructure:"POWERSCALE_TLS_CLIENT_KEY"`
 	TlsCacert             string `mapstructure:"POWERSCALE_TLS_CACERT"`
+	// Credential broker options
+	BrokerEnabled bool `mapstructure:"POWERSCALE_BROKER_ENABLED"`
+	// Listen address of the credential broker HTTP endpoint.
+	BrokerAddress string `mapstructure:"POWERSCALE_BROKER_ADDRESS"`
+	// Audience expected in the projected service account tokens of the pods.
+	BrokerAudience string `mapstructure:"POWERSCALE_BROKER_AUDIENCE"`
+	// Lifetime of the keys handed out by the broker.
+	BrokerKeyTTL time.Duration `mapstructure:"POWERSCALE_BROKER_KEY_TTL"`
+	// Serving certificate and key of the broker, required as the broker
+	// hands out secret keys.
+	BrokerTLSCert string `mapstructure:"POWERSCALE_BROKER_TLS_CERT"`
+	BrokerTLSKey  string `mapstructure:"POWERSCALE_BROKER_TLS_KEY"`
+	// Reconciler options
+	// Interval between two reconciliations, 0 disables the reconciler.
+	ReconcileInterval time.Duration `mapstructure:"POWERSCALE_RECONCILE_INTERVAL"`
+	// Objects younger than the grace period are not reported.
+	ReconcileGracePeriod time.Duration `mapstructure:"POWERSCALE_RECONCILE_GRACE_PERIOD"`
+	// Delete the orphan objects owned by the driver instead of only reporting them.
+	ReconcileFix bool `mapstructure:"POWERSCALE_RECONCILE_FIX"`
+	// Listen address of the metrics HTTP endpoint, empty to disable it.
+	MetricsAddress string `mapstructure:"POWERSCALE_METRICS_ADDRESS"`
+	// Interval between two counts of the objects managed by the driver.
+	MetricsCountInterval time.Duration `mapstructure:"POWERSCALE_METRICS_COUNT_INTERVAL"`
+	// Listen address of the `/healthz` and `/readyz` HTTP endpoints, empty to disable them.
+	HealthAddress string `mapstructure:"POWERSCALE_HEALTH_ADDRESS"`
+	// Interval between two checks of the OneFS API.
+	HealthCheckInterval time.Duration `mapstructure:"POWERSCALE_HEALTH_CHECK_INTERVAL"`
+	// Audit log of the changes made on OneFS: a file path, `stdout`, or
+	// empty to disable it.
+	AuditLog string `mapstructure:"POWERSCALE_AUDIT_LOG"`
+	// Record Kubernetes Events on the BucketClaims and BucketAccesses.
+	EventsEnabled bool `mapstructure:"POWERSCALE_EVENTS_ENABLED"`
+	// Defaults of the BucketAccessClass parameters, only set by the config file.
+	AccessParameters map[string]string `mapstructure:"-"`
 }
 
+// New returns the configuration of the environment, on top of the optional
+// config file of POWERSCALE_CONFIG_FILE and its POWERSCALE_PROFILE profile.
 func New() *Config {
+	cfg, err := Load(os.Getenv("POWERSCALE_CONFIG_FILE"), os.Getenv("POWERSCALE_PROFILE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return cfg
+}
+
+// Load returns the configuration of the environment, on top of the settings
+// of a profile of the config file. The config file is optional.
+func Load(file, profile string) (*Config, error) {
+	v := viper.New()
 
 	// Required env
-	viper.BindEnv("POWERSCALE_NAME")
-	viper.BindEnv("POWERSCALE_API_ENDPOINT")
-	viper.BindEnv("POWERSCALE_API_USERNAME")
-	viper.BindEnv("POWERSCALE_API_PASSWORD")
-	viper.BindEnv("POWERSCALE_S3_ENDPOINT")
-	viper.BindEnv("POWERSCALE_S3_REGION")
-	viper.BindEnv("POWERSCALE_ZONE")
-	viper.BindEnv("POWERSCALE_BASE_PATH")
+	v.BindEnv("POWERSCALE_NAME")
+	v.BindEnv("POWERSCALE_API_ENDPOINT")
+	v.BindEnv("POWERSCALE_API_USERNAME")
+	v.BindEnv("POWERSCALE_API_PASSWORD")
+	v.BindEnv("POWERSCALE_S3_ENDPOINT")
+	v.BindEnv("POWERSCALE_S3_REGION")
+	v.BindEnv("POWERSCALE_ZONE")
+	v.BindEnv("POWERSCALE_BASE_PATH")
 
 	// Optional
-	viper.SetDefault("POWERSCALE_TLS_INSECURE_SKIP_VERIFY", false)
-	viper.SetDefault("POWERSCALE_TLS_CLIENT_CERT", "")
-	viper.SetDefault("POWERSCALE_TLS_CLIENT_KEY", "")
-	viper.SetDefault("POWERSCALE_TLS_CACERT", "")
+	v.SetDefault("POWERSCALE_API_USERNAME_FILE", "")
+	v.SetDefault("POWERSCALE_API_PASSWORD_FILE", "")
+	v.SetDefault("POWERSCALE_IDENTITY_PREFIX", "")
+	v.SetDefault("POWERSCALE_TLS_INSECURE_SKIP_VERIFY", false)
+	v.SetDefault("POWERSCALE_TLS_CLIENT_CERT", "")
+	v.SetDefault("POWERSCALE_TLS_CLIENT_KEY", "")
+	v.SetDefault("POWERSCALE_TLS_CACERT", "")
+	v.SetDefault("POWERSCALE_BROKER_ENABLED", false)
+	v.SetDefault("POWERSCALE_BROKER_ADDRESS", ":9080")
+	v.SetDefault("POWERSCALE_BROKER_AUDIENCE", "cosi-powerscale")
+	v.SetDefault("POWERSCALE_BROKER_KEY_TTL", "1h")
+	v.SetDefault("POWERSCALE_BROKER_TLS_CERT", "")
+	v.SetDefault("POWERSCALE_BROKER_TLS_KEY", "")
+	v.SetDefault("POWERSCALE_RECONCILE_INTERVAL", "0")
+	v.SetDefault("POWERSCALE_RECONCILE_GRACE_PERIOD", "1h")
+	v.SetDefault("POWERSCALE_RECONCILE_FIX", false)
+	v.SetDefault("POWERSCALE_METRICS_ADDRESS", "")
+	v.SetDefault("POWERSCALE_METRICS_COUNT_INTERVAL", "5m")
+	v.SetDefault("POWERSCALE_HEALTH_ADDRESS", "")
+	v.SetDefault("POWERSCALE_HEALTH_CHECK_INTERVAL", "30s")
+	v.SetDefault("POWERSCALE_AUDIT_LOG", "")
+	v.SetDefault("POWERSCALE_EVENTS_ENABLED", true)
+
+	// Settings of the config file override the defaults, and are
+	// overridden by the environment.
+	var fileSettings *settings
+	if file != "" {
+		var err error
+		fileSettings, err = loadFile(file, profile)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range fileSettings.values {
+			v.SetDefault(key, value)
+		}
+	}
 
 	var cfg Config
 
-	viper.AutomaticEnv()
-	if err := viper.Unmarshal(&cfg); err != nil {
-		log.Fatal(err)
+	v.AutomaticEnv()
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, err
+	}
+	if fileSettings != nil {
+		cfg.AccessParameters = fileSettings.accessParameters
+	}
+
+	if err := resolveSecret(&cfg.ApiUsername, &cfg.ApiUsernameFile, "POWERSCALE_API_USERNAME"); err != nil {
+		return nil, err
+	}
+	if err := resolveSecret(&cfg.ApiPassword, &cfg.ApiPasswordFile, "POWERSCALE_API_PASSWORD"); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// resolveSecret reads a secret from its file, unless its literal value is set
+// in the environment. The file is cleared when it is not used.
+func resolveSecret(value, file *string, env string) error {
+	if os.Getenv(env) != "" {
+		*file = ""
+		return nil
+	}
+	if *file == "" {
+		return nil
+	}
+	secret, err := ReadSecretFile(*file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s file: %w", env, err)
 	}
+	*value = secret
+	return nil
+}
 
-	return &cfg
+// ReadSecretFile returns the content of a secret file, without the
+// surrounding whitespace.
+func ReadSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
 }
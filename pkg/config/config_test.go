@@ -0,0 +1,133 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testFile = `
+profile: prod
+zone: System
+basePath: /ifs/nas/buckets
+apiPasswordFile: %s
+accessParameters:
+  aclGrantee: group
+  bucketPolicy: true
+profiles:
+  prod:
+    apiEndpoint: https://isilon.example.com:8080
+    reconcileGracePeriod: 2h
+  dr:
+    apiEndpoint: https://isilon-dr.example.com:8080
+    zone: DR
+    accessParameters:
+      aclGrantee: user
+`
+
+// writeConfig writes the config file and the password file it refers to, and
+// clears the settings of the environment.
+func writeConfig(t *testing.T, password string) string {
+	t.Helper()
+	for _, env := range fileKeys {
+		t.Setenv(env, "")
+	}
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte(password), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configFile, []byte(strings.Replace(testFile, "%s", passwordFile, 1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return configFile
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		env     map[string]string
+		check   func(*testing.T, *Config)
+	}{
+		{"default profile", "", nil, func(t *testing.T, cfg *Config) {
+			if cfg.ApiEndpoint != "https://isilon.example.com:8080" || cfg.Zone != "System" || cfg.ReconcileGracePeriod != 2*time.Hour {
+				t.Errorf("unexpected settings %+v", cfg)
+			}
+			if cfg.AccessParameters["aclGrantee"] != "group" || cfg.AccessParameters["bucketPolicy"] != "true" {
+				t.Errorf("unexpected access parameters %v", cfg.AccessParameters)
+			}
+		}},
+		{"profile merge", "dr", nil, func(t *testing.T, cfg *Config) {
+			if cfg.ApiEndpoint != "https://isilon-dr.example.com:8080" || cfg.Zone != "DR" || cfg.BasePath != "/ifs/nas/buckets" {
+				t.Errorf("unexpected settings %+v", cfg)
+			}
+			// Defaults apply to the settings of neither the file nor the profile.
+			if cfg.ReconcileGracePeriod != time.Hour {
+				t.Errorf("unexpected grace period %s", cfg.ReconcileGracePeriod)
+			}
+			if cfg.AccessParameters["aclGrantee"] != "user" || cfg.AccessParameters["bucketPolicy"] != "true" {
+				t.Errorf("unexpected access parameters %v", cfg.AccessParameters)
+			}
+		}},
+		{"environment override", "dr", map[string]string{"POWERSCALE_ZONE": "Override", "POWERSCALE_RECONCILE_GRACE_PERIOD": "5m"}, func(t *testing.T, cfg *Config) {
+			if cfg.Zone != "Override" || cfg.ReconcileGracePeriod != 5*time.Minute {
+				t.Errorf("unexpected settings %+v", cfg)
+			}
+		}},
+		{"secret file", "", nil, func(t *testing.T, cfg *Config) {
+			if cfg.ApiPassword != "s3cr3t" {
+				t.Errorf("expected the trimmed password, got %q", cfg.ApiPassword)
+			}
+		}},
+		{"secret in the environment", "", map[string]string{"POWERSCALE_API_PASSWORD": "from-env"}, func(t *testing.T, cfg *Config) {
+			if cfg.ApiPassword != "from-env" || cfg.ApiPasswordFile != "" {
+				t.Errorf("expected the password of the environment, got %q from %q", cfg.ApiPassword, cfg.ApiPasswordFile)
+			}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configFile := writeConfig(t, " s3cr3t\n")
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			cfg, err := Load(configFile, test.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	configFile := writeConfig(t, "s3cr3t")
+	tests := []struct {
+		name    string
+		file    string
+		profile string
+		want    string
+	}{
+		{"missing profile", configFile, "staging", `profile "staging" not found`},
+		{"missing file", filepath.Join(t.TempDir(), "missing.yaml"), "", "failed to read config file"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Load(test.file, test.profile); err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("expected %q, got %v", test.want, err)
+			}
+		})
+	}
+
+	unknown := filepath.Join(t.TempDir(), "unknown.yaml")
+	if err := os.WriteFile(unknown, []byte("zones: System\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(unknown, ""); err == nil || !strings.Contains(err.Error(), `unknown setting "zones"`) {
+		t.Errorf("expected the unknown setting to be reported, got %v", err)
+	}
+}
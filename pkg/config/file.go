@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// fileKeys maps the settings of the config file to their environment variable.
+var fileKeys = map[string]string{
+	"name":                  "POWERSCALE_NAME",
+	"apiEndpoint":           "POWERSCALE_API_ENDPOINT",
+	"apiUsername":           "POWERSCALE_API_USERNAME",
+	"apiUsernameFile":       "POWERSCALE_API_USERNAME_FILE",
+	"apiPassword":           "POWERSCALE_API_PASSWORD",
+	"apiPasswordFile":       "POWERSCALE_API_PASSWORD_FILE",
+	"s3Endpoint":            "POWERSCALE_S3_ENDPOINT",
+	"s3Region":              "POWERSCALE_S3_REGION",
+	"zone":                  "POWERSCALE_ZONE",
+	"basePath":              "POWERSCALE_BASE_PATH",
+	"identityPrefix":        "POWERSCALE_IDENTITY_PREFIX",
+	"tlsInsecureSkipVerify": "POWERSCALE_TLS_INSECURE_SKIP_VERIFY",
+	"tlsClientCert":         "POWERSCALE_TLS_CLIENT_CERT",
+	"tlsClientKey":          "POWERSCALE_TLS_CLIENT_KEY",
+	"tlsCacert":             "POWERSCALE_TLS_CACERT",
+	"brokerEnabled":         "POWERSCALE_BROKER_ENABLED",
+	"brokerAddress":         "POWERSCALE_BROKER_ADDRESS",
+	"brokerAudience":        "POWERSCALE_BROKER_AUDIENCE",
+	"brokerKeyTTL":          "POWERSCALE_BROKER_KEY_TTL",
+	"brokerTlsCert":         "POWERSCALE_BROKER_TLS_CERT",
+	"brokerTlsKey":          "POWERSCALE_BROKER_TLS_KEY",
+	"reconcileInterval":     "POWERSCALE_RECONCILE_INTERVAL",
+	"reconcileGracePeriod":  "POWERSCALE_RECONCILE_GRACE_PERIOD",
+	"reconcileFix":          "POWERSCALE_RECONCILE_FIX",
+	"metricsAddress":        "POWERSCALE_METRICS_ADDRESS",
+	"metricsCountInterval":  "POWERSCALE_METRICS_COUNT_INTERVAL",
+	"healthAddress":         "POWERSCALE_HEALTH_ADDRESS",
+	"healthCheckInterval":   "POWERSCALE_HEALTH_CHECK_INTERVAL",
+	"auditLog":              "POWERSCALE_AUDIT_LOG",
+	"eventsEnabled":         "POWERSCALE_EVENTS_ENABLED",
+}
+
+// accessParametersKey holds the defaults of the BucketAccessClass parameters.
+const accessParametersKey = "accessParameters"
+
+// file is the schema of the config file, in YAML or JSON:
+//
+//	# Profile used when none is given.
+//	profile: prod
+//	# Settings shared by all the profiles.
+//	zone: System
+//	apiPasswordFile: /etc/cosi-powerscale/password
+//	accessParameters:
+//	  aclGrantee: group
+//	profiles:
+//	  prod:
+//	    apiEndpoint: https://isilon.example.com:8080
+//	  dr:
+//	    apiEndpoint: https://isilon-dr.example.com:8080
+//
+// The settings of a profile override the shared settings. The access
+// parameters of a profile are merged with the shared ones.
+type file struct {
+	Profile  string                    `json:"profile"`
+	Profiles map[string]map[string]any `json:"profiles"`
+}
+
+// settings are the values of the config file, keyed by environment variable.
+type settings struct {
+	values           map[string]any
+	accessParameters map[string]string
+}
+
+func loadFile(path, profile string) (*settings, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var f file
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	var shared map[string]any
+	if err := yaml.Unmarshal(data, &shared); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	delete(shared, "profile")
+	delete(shared, "profiles")
+
+	s := &settings{values: make(map[string]any), accessParameters: make(map[string]string)}
+	if err := s.add(shared); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	if profile == "" {
+		profile = f.Profile
+	}
+	if profile != "" {
+		values, ok := f.Profiles[profile]
+		if !ok {
+			return nil, fmt.Errorf("profile %q not found in config file %s, available profiles: %s", profile, path, profileNames(f.Profiles))
+		}
+		if err := s.add(values); err != nil {
+			return nil, fmt.Errorf("invalid profile %q of config file %s: %w", profile, path, err)
+		}
+	}
+	return s, nil
+}
+
+// add sets the values of the config file, overriding the previous ones.
+func (s *settings) add(values map[string]any) error {
+	for key, value := range values {
+		if key == accessParametersKey {
+			parameters, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s must be a map", key)
+			}
+			for name, parameter := range parameters {
+				s.accessParameters[name] = fmt.Sprint(parameter)
+			}
+			continue
+		}
+		env, ok := fileKeys[key]
+		if !ok {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		s.values[env] = value
+	}
+	return nil
+}
+
+func profileNames(profiles map[string]map[string]any) string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	neturl "net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// The driver name is part of its identity name, `<name>.powerscale.cosi.japannext.co.jp`.
+var nameRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Identity prefixes leave room for the name they are prepended to.
+const maxIdentityPrefixLength = 32
+
+var identityPrefixRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?-?$`)
+
+// ValidateIdentityPrefix returns why prefix is not a valid identity prefix of
+// the driver instance name, or nil. Identity prefixes start with `<name>-`,
+// so that the identities are named after the instance which created them.
+func ValidateIdentityPrefix(name, prefix string) error {
+	switch {
+	case len(prefix) > maxIdentityPrefixLength:
+		return fmt.Errorf("must be at most %d characters", maxIdentityPrefixLength)
+	case !identityPrefixRegexp.MatchString(prefix):
+		return fmt.Errorf("must only contain lowercase alphanumeric characters or '-'")
+	case !strings.HasPrefix(prefix, name+"-"):
+		return fmt.Errorf("must start with the driver name %q", name+"-")
+	}
+	return nil
+}
+
+// ValidationError lists all the invalid settings of a configuration.
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Errors, "\n  - ")
+}
+
+func (e *ValidationError) add(setting, format string, args ...any) {
+	e.Errors = append(e.Errors, setting+": "+fmt.Sprintf(format, args...))
+}
+
+// Validate checks the configuration and returns a *ValidationError listing
+// every invalid setting, or nil.
+func (c *Config) Validate() error {
+	e := &ValidationError{}
+
+	if !nameRegexp.MatchString(c.Name) {
+		e.add("POWERSCALE_NAME", "%q must be a DNS label: at most 63 lowercase alphanumeric characters or '-', starting and ending with an alphanumeric character", c.Name)
+	}
+
+	if c.IdentityPrefix != "" {
+		if err := ValidateIdentityPrefix(c.Name, c.IdentityPrefix); err != nil {
+			e.add("POWERSCALE_IDENTITY_PREFIX", "%q %v", c.IdentityPrefix, err)
+		}
+	}
+
+	validateURL(e, "POWERSCALE_API_ENDPOINT", c.ApiEndpoint)
+	validateURL(e, "POWERSCALE_S3_ENDPOINT", c.S3Endpoint)
+
+	if c.ApiUsername == "" {
+		e.add("POWERSCALE_API_USERNAME", "required")
+	}
+	if c.ApiPassword == "" {
+		e.add("POWERSCALE_API_PASSWORD", "required")
+	}
+	if c.Zone == "" {
+		e.add("POWERSCALE_ZONE", "required")
+	}
+
+	switch {
+	case c.BasePath == "":
+		e.add("POWERSCALE_BASE_PATH", "required")
+	case c.BasePath != "/ifs" && !strings.HasPrefix(c.BasePath, "/ifs/"):
+		e.add("POWERSCALE_BASE_PATH", "%q must be an absolute path under /ifs", c.BasePath)
+	case path.Clean(c.BasePath) != c.BasePath:
+		e.add("POWERSCALE_BASE_PATH", "%q must be a clean path, without trailing '/', '.' or '..' elements", c.BasePath)
+	}
+
+	if (c.TlsClientCert == "") != (c.TlsClientKey == "") {
+		e.add("POWERSCALE_TLS_CLIENT_CERT", "the client certificate and POWERSCALE_TLS_CLIENT_KEY must be set together")
+	}
+
+	if c.BrokerEnabled {
+		if c.BrokerAddress == "" {
+			e.add("POWERSCALE_BROKER_ADDRESS", "required when the broker is enabled")
+		}
+		if c.BrokerKeyTTL <= 0 {
+			e.add("POWERSCALE_BROKER_KEY_TTL", "%s must be positive", c.BrokerKeyTTL)
+		}
+		if c.BrokerTLSCert == "" || c.BrokerTLSKey == "" {
+			e.add("POWERSCALE_BROKER_TLS_CERT", "the broker certificate and POWERSCALE_BROKER_TLS_KEY are required when the broker is enabled")
+		}
+	}
+
+	if c.ReconcileInterval < 0 {
+		e.add("POWERSCALE_RECONCILE_INTERVAL", "%s must not be negative", c.ReconcileInterval)
+	}
+	switch {
+	case c.ReconcileFix && c.ReconcileGracePeriod <= 0:
+		e.add("POWERSCALE_RECONCILE_GRACE_PERIOD", "%s must be positive when POWERSCALE_RECONCILE_FIX is set", c.ReconcileGracePeriod)
+	case c.ReconcileGracePeriod < 0:
+		e.add("POWERSCALE_RECONCILE_GRACE_PERIOD", "%s must not be negative", c.ReconcileGracePeriod)
+	}
+
+	if c.MetricsAddress != "" && c.MetricsCountInterval <= 0 {
+		e.add("POWERSCALE_METRICS_COUNT_INTERVAL", "%s must be positive", c.MetricsCountInterval)
+	}
+
+	if c.HealthCheckInterval <= 0 {
+		e.add("POWERSCALE_HEALTH_CHECK_INTERVAL", "%s must be positive", c.HealthCheckInterval)
+	}
+
+	if c.AuditLog != "" && c.AuditLog != "stdout" && !path.IsAbs(c.AuditLog) {
+		e.add("POWERSCALE_AUDIT_LOG", "%q must be stdout or an absolute file path", c.AuditLog)
+	}
+
+	if len(e.Errors) > 0 {
+		return e
+	}
+	return nil
+}
+
+func validateURL(e *ValidationError, setting, value string) {
+	if value == "" {
+		e.add(setting, "required")
+		return
+	}
+	u, err := neturl.Parse(value)
+	if err != nil {
+		e.add(setting, "%q is not a valid URL: %v", value, err)
+		return
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		e.add(setting, "%q must start with https:// or http://", value)
+		return
+	}
+	if u.Host == "" {
+		e.add(setting, "%q has no host", value)
+	}
+}
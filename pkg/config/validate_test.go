@@ -0,0 +1,97 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validConfig() *Config {
+	return &Config{
+		Name:                 "nas1",
+		ApiEndpoint:          "https://isilon.example.com:8080",
+		ApiUsername:          "cosi",
+		ApiPassword:          "secret",
+		S3Endpoint:           "https://isilon.example.com:9021",
+		Zone:                 "System",
+		BasePath:             "/ifs/nas/buckets",
+		ReconcileGracePeriod: time.Hour,
+		HealthCheckInterval:  30 * time.Second,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		// Setting reported as invalid, empty when the configuration is valid.
+		invalid string
+	}{
+		{"valid", func(*Config) {}, ""},
+		{"name", func(c *Config) { c.Name = "NAS_1" }, "POWERSCALE_NAME"},
+		{"api endpoint scheme", func(c *Config) { c.ApiEndpoint = "isilon.example.com:8080" }, "POWERSCALE_API_ENDPOINT"},
+		{"s3 endpoint", func(c *Config) { c.S3Endpoint = "" }, "POWERSCALE_S3_ENDPOINT"},
+		{"password", func(c *Config) { c.ApiPassword = "" }, "POWERSCALE_API_PASSWORD"},
+		{"base path outside of /ifs", func(c *Config) { c.BasePath = "/data" }, "POWERSCALE_BASE_PATH"},
+		{"base path not clean", func(c *Config) { c.BasePath = "/ifs/nas/" }, "POWERSCALE_BASE_PATH"},
+		{"identity prefix", func(c *Config) { c.IdentityPrefix = "nas1-team-" }, ""},
+		{"identity prefix without name", func(c *Config) { c.IdentityPrefix = "team-nas1-" }, "POWERSCALE_IDENTITY_PREFIX"},
+		{"identity prefix of another name", func(c *Config) { c.IdentityPrefix = "nas10-" }, "POWERSCALE_IDENTITY_PREFIX"},
+		{"client key without certificate", func(c *Config) { c.TlsClientKey = "/tls/tls.key" }, "POWERSCALE_TLS_CLIENT_CERT"},
+		{"broker key TTL", func(c *Config) {
+			c.BrokerEnabled = true
+			c.BrokerAddress = ":9080"
+			c.BrokerTLSCert = "/tls/tls.crt"
+			c.BrokerTLSKey = "/tls/tls.key"
+		}, "POWERSCALE_BROKER_KEY_TTL"},
+		{"broker without TLS", func(c *Config) {
+			c.BrokerEnabled = true
+			c.BrokerAddress = ":9080"
+			c.BrokerKeyTTL = time.Hour
+		}, "POWERSCALE_BROKER_TLS_CERT"},
+		{"fix without grace period", func(c *Config) {
+			c.ReconcileFix = true
+			c.ReconcileGracePeriod = 0
+		}, "POWERSCALE_RECONCILE_GRACE_PERIOD"},
+		{"report without grace period", func(c *Config) { c.ReconcileGracePeriod = 0 }, ""},
+		{"metrics count interval", func(c *Config) { c.MetricsAddress = ":8080" }, "POWERSCALE_METRICS_COUNT_INTERVAL"},
+		{"negative reconcile interval", func(c *Config) { c.ReconcileInterval = -time.Minute }, "POWERSCALE_RECONCILE_INTERVAL"},
+		{"health check interval", func(c *Config) { c.HealthCheckInterval = 0 }, "POWERSCALE_HEALTH_CHECK_INTERVAL"},
+		{"relative audit log", func(c *Config) { c.AuditLog = "audit.log" }, "POWERSCALE_AUDIT_LOG"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := validConfig()
+			test.modify(cfg)
+			err := cfg.Validate()
+			if test.invalid == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("expected a ValidationError, got %v", err)
+			}
+			if len(validationErr.Errors) != 1 || !strings.HasPrefix(validationErr.Errors[0], test.invalid+": ") {
+				t.Errorf("expected only %s to be invalid, got %v", test.invalid, validationErr.Errors)
+			}
+		})
+	}
+}
+
+// All the invalid settings are reported at once.
+func TestValidateAll(t *testing.T) {
+	err := (&Config{}).Validate()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	for _, setting := range []string{"POWERSCALE_NAME", "POWERSCALE_API_ENDPOINT", "POWERSCALE_ZONE", "POWERSCALE_BASE_PATH"} {
+		if !strings.Contains(err.Error(), setting+": ") {
+			t.Errorf("%s not reported in %v", setting, err)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Package doctor checks the driver configuration against the cluster before
+// deploying: TLS, authentication, access zone, S3 service, base path and the
+// RBAC privileges of the API user.
+package doctor
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	neturl "net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/japannext/cosi-powerscale/pkg/config"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+)
+
+const dialTimeout = 10 * time.Second
+
+// RequiredPrivileges are the read-write RBAC privileges needed by the API user.
+var RequiredPrivileges = []string{
+	"ISI_PRIV_S3",
+	"ISI_PRIV_AUTH",
+	"ISI_PRIV_NS_IFS_ACCESS",
+	"ISI_PRIV_QUOTA",
+	"ISI_PRIV_SNAPSHOT",
+}
+
+var errSkipped = errors.New("skipped")
+
+// Warning is the error of a check which passed with a caveat.
+type Warning string
+
+func (w Warning) Error() string {
+	return string(w)
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Name string
+	// Detail of a passed check.
+	Detail string
+	// Err is nil when the check passed, errSkipped when a previous check
+	// it depends on failed, a Warning when it passed with a caveat.
+	Err error
+}
+
+// Warned reports whether the check passed with a caveat.
+func (r Result) Warned() bool {
+	var w Warning
+	return errors.As(r.Err, &w)
+}
+
+// Failed reports whether the check ran and failed.
+func (r Result) Failed() bool {
+	return r.Err != nil && !errors.Is(r.Err, errSkipped) && !r.Warned()
+}
+
+type doctor struct {
+	cfg       *config.Config
+	tlsConfig *tls.Config
+	server    *powerscale.Server
+	results   []Result
+	// Unreachable API, the remaining checks are skipped.
+	stopped bool
+	zone    *powerscale.Zone
+}
+
+// Run runs all the checks and returns their results.
+func Run(cfg *config.Config) []Result {
+	d := &doctor{cfg: cfg}
+	d.check("Configuration", d.checkConfig)
+	d.check("TLS configuration", d.checkTLSConfig)
+	d.check("TLS handshake", d.checkTLSHandshake)
+	if !d.stopped {
+		// The probes of the checks are not changes of the driver, they are
+		// kept out of the audit log.
+		serverCfg := *cfg
+		serverCfg.AuditLog = ""
+		d.server = powerscale.New(&serverCfg)
+	}
+	d.check("Authentication", d.checkAuthentication)
+	d.check("Access zone", d.checkZone)
+	d.check("S3 service", d.checkS3)
+	d.check("Base path", d.checkBasePath)
+	d.check("Privileges", d.checkPrivileges)
+	return d.results
+}
+
+// check runs a check, unless a previous check stopped the run. Connectivity
+// checks stop the run when they fail.
+func (d *doctor) check(name string, fn func() (string, error)) {
+	if d.stopped {
+		d.results = append(d.results, Result{Name: name, Err: errSkipped})
+		return
+	}
+	detail, err := fn()
+	d.results = append(d.results, Result{Name: name, Detail: detail, Err: err})
+}
+
+func (d *doctor) checkConfig() (string, error) {
+	if err := d.cfg.Validate(); err != nil {
+		d.stopped = true
+		return "", err
+	}
+	return "valid", nil
+}
+
+func (d *doctor) checkTLSConfig() (string, error) {
+	tlsConfig, err := powerscale.NewTLSConfig(d.cfg)
+	if err != nil {
+		d.stopped = true
+		return "", err
+	}
+	d.tlsConfig = tlsConfig
+	if tlsConfig.InsecureSkipVerify {
+		return "certificate verification disabled", nil
+	}
+	return "CA and client certificates loaded", nil
+}
+
+func (d *doctor) checkTLSHandshake() (string, error) {
+	endpoint, err := neturl.Parse(d.cfg.ApiEndpoint)
+	if err != nil || endpoint.Host == "" {
+		d.stopped = true
+		return "", fmt.Errorf("invalid API endpoint %q", d.cfg.ApiEndpoint)
+	}
+	if endpoint.Scheme != "https" {
+		return "", Warning("the API endpoint is not using TLS, the credentials are sent in clear text")
+	}
+	host := endpoint.Host
+	if endpoint.Port() == "" {
+		host = net.JoinHostPort(endpoint.Hostname(), "443")
+	}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", host, d.tlsConfig)
+	if err != nil {
+		d.stopped = true
+		return "", err
+	}
+	defer conn.Close()
+	state := conn.ConnectionState()
+	return fmt.Sprintf("%s, %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite)), nil
+}
+
+func (d *doctor) checkAuthentication() (string, error) {
+	cluster, err := d.server.GetClusterConfig()
+	if err != nil {
+		d.stopped = true
+		var statusErr *powerscale.StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == 401 {
+			return "", fmt.Errorf("invalid credentials for user %q", d.cfg.ApiUsername)
+		}
+		return "", err
+	}
+	return fmt.Sprintf("cluster %s, OneFS %s", cluster.Name, cluster.OnefsVersion.Release), nil
+}
+
+func (d *doctor) checkZone() (string, error) {
+	zone, err := d.server.GetZone()
+	if err != nil {
+		return "", err
+	}
+	if zone == nil {
+		return "", fmt.Errorf("access zone %q not found", d.cfg.Zone)
+	}
+	d.zone = zone
+	return fmt.Sprintf("zone %s, path %s", zone.Name, zone.Path), nil
+}
+
+func (d *doctor) checkS3() (string, error) {
+	settings, err := d.server.GetS3Settings()
+	if err != nil {
+		return "", err
+	}
+	if !settings.Service {
+		return "", errors.New("the S3 service is disabled")
+	}
+	zoneSettings, err := d.server.GetS3ZoneSettings()
+	if err != nil {
+		return "", fmt.Errorf("S3 settings of zone %q: %w", d.cfg.Zone, err)
+	}
+	if zoneSettings.Service != nil && !*zoneSettings.Service {
+		return "", fmt.Errorf("S3 is disabled in zone %s", d.cfg.Zone)
+	}
+	return fmt.Sprintf("enabled in zone %s", d.cfg.Zone), nil
+}
+
+func (d *doctor) checkBasePath() (string, error) {
+	basePath := path.Clean(d.cfg.BasePath)
+	if d.zone != nil && basePath != d.zone.Path && !strings.HasPrefix(basePath, d.zone.Path+"/") {
+		return "", fmt.Errorf("%s is not under the path %s of zone %s", basePath, d.zone.Path, d.zone.Name)
+	}
+	exists, err := d.server.DirectoryExists(basePath)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("%s does not exist", basePath)
+	}
+
+	probe := fmt.Sprintf("%s/.cosi-doctor-%d", basePath, time.Now().UnixNano())
+	if err := d.server.CreateDirectory(probe); err != nil {
+		return "", fmt.Errorf("%s is not writable: %w", basePath, err)
+	}
+	if err := d.server.DeleteDirectory(probe); err != nil {
+		return "", fmt.Errorf("failed to delete %s: %w", probe, err)
+	}
+	return fmt.Sprintf("%s exists and is writable", basePath), nil
+}
+
+func (d *doctor) checkPrivileges() (string, error) {
+	id, err := d.server.GetAuthID()
+	if err != nil {
+		return "", err
+	}
+	var missing []string
+	for _, required := range RequiredPrivileges {
+		i := slices.IndexFunc(id.Privileges, func(p powerscale.Privilege) bool { return p.ID == required })
+		switch {
+		case i < 0:
+			missing = append(missing, required)
+		case id.Privileges[i].ReadOnly:
+			missing = append(missing, required+" (read-only)")
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("user %s is missing %s", id.User.Name, strings.Join(missing, ", "))
+	}
+	return fmt.Sprintf("user %s has %s", id.User.Name, strings.Join(RequiredPrivileges, ", ")), nil
+}
+
+// Write prints the report and returns whether all the checks passed.
+func Write(w io.Writer, results []Result) bool {
+	ok := true
+	for _, result := range results {
+		switch {
+		case result.Err == nil:
+			fmt.Fprintf(w, "[PASS] %s: %s\n", result.Name, result.Detail)
+		case result.Warned():
+			fmt.Fprintf(w, "[WARN] %s: %v\n", result.Name, result.Err)
+		case result.Failed():
+			ok = false
+			fmt.Fprintf(w, "[FAIL] %s: %v\n", result.Name, result.Err)
+		default:
+			fmt.Fprintf(w, "[SKIP] %s\n", result.Name)
+		}
+	}
+	return ok
+}
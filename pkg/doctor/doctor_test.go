@@ -0,0 +1,117 @@
+package doctor
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/japannext/cosi-powerscale/pkg/config"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale/fake"
+)
+
+func results(cfg *config.Config) map[string]Result {
+	cfg.HealthCheckInterval = time.Minute
+	byName := make(map[string]Result)
+	for _, result := range Run(cfg) {
+		byName[result.Name] = result
+	}
+	return byName
+}
+
+func TestRun(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+
+	byName := results(server.Config())
+	if len(byName) != 8 {
+		t.Errorf("expected 8 checks, got %+v", byName)
+	}
+	for name, result := range byName {
+		if result.Failed() {
+			t.Errorf("%s failed: %v", name, result.Err)
+		}
+	}
+	// The fake serves plain HTTP.
+	if result := byName["TLS handshake"]; !result.Warned() {
+		t.Errorf("expected a warning for the plain HTTP endpoint, got %+v", result)
+	}
+	if detail := byName["Authentication"].Detail; detail != "cluster fake-cluster, OneFS 9.5.0.0" {
+		t.Errorf("unexpected authentication detail %q", detail)
+	}
+}
+
+// The probes of the checks are not written to the audit log of the driver.
+func TestNoAudit(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	cfg := server.Config()
+	cfg.AuditLog = filepath.Join(t.TempDir(), "audit.log")
+
+	for name, result := range results(cfg) {
+		if result.Failed() {
+			t.Errorf("%s failed: %v", name, result.Err)
+		}
+	}
+	if _, err := os.Stat(cfg.AuditLog); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no audit log, got %v", err)
+	}
+}
+
+func TestInvalidCredentials(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	cfg := server.Config()
+	cfg.ApiPassword = "wrong"
+
+	byName := results(cfg)
+	if result := byName["Authentication"]; !result.Failed() {
+		t.Errorf("expected the authentication to fail, got %+v", result)
+	}
+	// The checks of the cluster are skipped.
+	if result := byName["Privileges"]; result.Failed() || result.Err == nil {
+		t.Errorf("expected the privileges check to be skipped, got %+v", result)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	cfg := server.Config()
+	cfg.ApiEndpoint = ""
+
+	byName := results(cfg)
+	if result := byName["Configuration"]; !result.Failed() {
+		t.Errorf("expected the configuration check to fail, got %+v", result)
+	}
+	if result := byName["Authentication"]; result.Failed() || result.Err == nil {
+		t.Errorf("expected the authentication check to be skipped, got %+v", result)
+	}
+}
+
+func TestMissingBasePath(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	cfg := server.Config()
+	cfg.BasePath = fake.ZonePath + "/missing"
+
+	byName := results(cfg)
+	if result := byName["Base path"]; !result.Failed() {
+		t.Errorf("expected the base path check to fail, got %+v", result)
+	}
+	if result := byName["Privileges"]; result.Err != nil {
+		t.Errorf("expected the privileges check to pass, got %+v", result)
+	}
+}
+
+func TestS3DisabledInZone(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	server.Inject(fake.Fault{Method: http.MethodGet, Path: "/platform/14/protocols/s3/settings/zone", StatusCode: http.StatusOK, Body: `{"settings":{"root_path":"/ifs","service":false}}`})
+
+	if result := results(server.Config())["S3 service"]; !result.Failed() {
+		t.Errorf("expected S3 disabled in the zone to fail, got %+v", result)
+	}
+}
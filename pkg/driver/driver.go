@@ -11,9 +11,19 @@ import (
 	"google.golang.org/grpc"
 	spec "sigs.k8s.io/container-object-storage-interface-spec"
 
+	"github.com/japannext/cosi-powerscale/pkg/broker"
 	"github.com/japannext/cosi-powerscale/pkg/config"
+	"github.com/japannext/cosi-powerscale/pkg/events"
+	"github.com/japannext/cosi-powerscale/pkg/health"
 	"github.com/japannext/cosi-powerscale/pkg/identity"
+	"github.com/japannext/cosi-powerscale/pkg/kube"
+	"github.com/japannext/cosi-powerscale/pkg/logging"
+	"github.com/japannext/cosi-powerscale/pkg/metrics"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
 	"github.com/japannext/cosi-powerscale/pkg/provisioner"
+	"github.com/japannext/cosi-powerscale/pkg/reconciler"
+	"github.com/japannext/cosi-powerscale/pkg/redact"
+	"github.com/japannext/cosi-powerscale/pkg/tracing"
 	log "k8s.io/klog/v2"
 )
 
@@ -25,17 +35,67 @@ const (
 type Driver struct {
 	server *grpc.Server
 	lis    net.Listener
+	cfg    *config.Config
+	// Client of the OneFS API, its credentials and TLS files are watched.
+	powerscale *powerscale.Server
+	// Periodic check of OneFS, for the health service and probes.
+	health *health.Checker
+	// Optional credential broker, nil when disabled.
+	broker *broker.Broker
+	// Optional orphan reconciler, nil when disabled.
+	reconciler *reconciler.Reconciler
 }
 
 func New(cfg *config.Config) (*Driver, error) {
 	identityName := fmt.Sprintf("%s.powerscale.cosi.japannext.co.jp", cfg.Name)
-	identityServer := identity.New(identityName)
-	provisionerServer := provisioner.New(cfg)
 
-	options := []grpc.ServerOption{}
+	// The Kubernetes API is only needed by optional features.
+	kubeClient, kubeErr := kube.NewInCluster()
+	if kubeErr != nil {
+		log.InfoS("Kubernetes API unavailable, features requiring it are disabled", "error", kubeErr)
+		kubeClient = nil
+	}
+
+	provisionerServer, err := provisioner.New(cfg, kubeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.EventsEnabled && kubeClient != nil {
+		provisionerServer.Events = events.New(kubeClient, cfg.Name)
+	}
+
+	checker := health.New(cfg, provisionerServer.Powerscale)
+	identityServer := identity.New(identityName, checker)
+
+	var credentialBroker *broker.Broker
+	if cfg.BrokerEnabled {
+		if kubeClient == nil {
+			return nil, fmt.Errorf("the credential broker requires the Kubernetes API: %w", kubeErr)
+		}
+		reviewer := broker.NewKubeReviewer(kubeClient, cfg.BrokerAudience)
+		credentialBroker = broker.New(cfg, provisionerServer.Powerscale, reviewer)
+		provisionerServer.Authenticators[spec.AuthenticationType_Key] = provisioner.NewBrokerAuthenticator(provisionerServer.Powerscale, credentialBroker)
+	}
+
+	var orphanReconciler *reconciler.Reconciler
+	if cfg.ReconcileInterval > 0 {
+		orphanReconciler = reconciler.New(cfg, provisionerServer.Powerscale)
+	}
+
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			tracing.UnaryServerInterceptor,
+			logging.UnaryServerInterceptor,
+			metrics.UnaryServerInterceptor,
+			redact.UnaryServerInterceptor,
+			logging.RecoveryUnaryServerInterceptor,
+		),
+	}
 	server := grpc.NewServer(options...)
 	spec.RegisterIdentityServer(server, identityServer)
 	spec.RegisterProvisionerServer(server, provisionerServer)
+	checker.Register(server)
 
 	if _, err := os.Stat(socket); !errors.Is(err, fs.ErrNotExist) {
 		if err := os.RemoveAll(socket); err != nil {
@@ -50,7 +110,15 @@ func New(cfg *config.Config) (*Driver, error) {
 
 	log.InfoS("Listening on socket", "socket", socket)
 
-	return &Driver{server, listener}, nil
+	return &Driver{
+		server:     server,
+		lis:        listener,
+		cfg:        cfg,
+		powerscale: provisionerServer.Powerscale,
+		health:     checker,
+		broker:     credentialBroker,
+		reconciler: orphanReconciler,
+	}, nil
 }
 
 func (d *Driver) Run(ctx context.Context) error {
@@ -65,6 +133,47 @@ func (d *Driver) Run(ctx context.Context) error {
 
 	<-ready
 	log.Info("gRPC server started")
+
+	go func() {
+		if err := d.powerscale.WatchFiles(ctx, d.cfg); err != nil {
+			log.ErrorS(err, "Failed to watch credentials and TLS files, they will not be reloaded")
+		}
+	}()
+
+	go d.health.Run(ctx)
+	if d.cfg.HealthAddress != "" {
+		go func() {
+			if err := d.health.Serve(ctx, d.cfg.HealthAddress); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	if d.cfg.MetricsAddress != "" {
+		go func() {
+			if err := metrics.Serve(ctx, d.cfg.MetricsAddress); err != nil {
+				log.Fatal(err)
+			}
+		}()
+		go metrics.CountManaged(ctx, d.powerscale, d.cfg.MetricsCountInterval)
+	}
+
+	if d.broker != nil {
+		go func() {
+			if err := d.broker.Run(ctx); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	if d.reconciler != nil {
+		go func() {
+			if err := d.reconciler.Run(ctx); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
 	<-ctx.Done()
 
 	d.server.GracefulStop()
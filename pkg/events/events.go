@@ -0,0 +1,123 @@
+// Package events records Kubernetes Events on the BucketClaims and
+// BucketAccesses, so that users see the outcome of the driver actions with
+// `kubectl describe`.
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	log "k8s.io/klog/v2"
+
+	"github.com/japannext/cosi-powerscale/pkg/kube"
+)
+
+const (
+	component = "cosi-powerscale"
+
+	cosiAPIVersion   = "objectstorage.k8s.io/v1alpha1"
+	kindBucketClaim  = "BucketClaim"
+	kindBucketAccess = "BucketAccess"
+
+	reviewTimeout = 10 * time.Second
+)
+
+// Recorder records the events of the driver actions.
+type Recorder interface {
+	// Eventf records an event on an object, of type corev1.EventTypeNormal
+	// or corev1.EventTypeWarning. A nil object is ignored.
+	Eventf(object *corev1.ObjectReference, eventType, reason, messageFmt string, args ...any)
+}
+
+// Discard is the Recorder of a disabled event recording.
+type Discard struct{}
+
+func (Discard) Eventf(*corev1.ObjectReference, string, string, string, ...any) {}
+
+// kubeRecorder records the events with the Kubernetes API.
+type kubeRecorder struct {
+	recorder record.EventRecorder
+}
+
+func (r *kubeRecorder) Eventf(object *corev1.ObjectReference, eventType, reason, messageFmt string, args ...any) {
+	if object == nil {
+		return
+	}
+	r.recorder.Eventf(object, eventType, reason, messageFmt, args...)
+}
+
+// New returns a Recorder sending the events to the Kubernetes API. It
+// returns Discard when the service account is not allowed to create events.
+func New(client *kube.Client, driverName string) Recorder {
+	ctx, cancel := context.WithTimeout(context.Background(), reviewTimeout)
+	defer cancel()
+	allowed, err := canCreateEvents(ctx, client)
+	if err != nil {
+		log.ErrorS(err, "Failed to check the permission to create events, events are disabled")
+		return Discard{}
+	}
+	if !allowed {
+		log.InfoS("Not allowed to create events, events are disabled")
+		return Discard{}
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.Clientset.CoreV1().Events("")})
+	source := corev1.EventSource{Component: component, Host: driverName}
+	return &kubeRecorder{recorder: broadcaster.NewRecorder(scheme.Scheme, source)}
+}
+
+// canCreateEvents reviews the permission of the driver to create events in
+// all the namespaces.
+func canCreateEvents(ctx context.Context, client *kube.Client) (bool, error) {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Verb:     "create",
+				Resource: "events",
+			},
+		},
+	}
+	review, err := client.Clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to review access: %w", err)
+	}
+	return review.Status.Allowed, nil
+}
+
+// BucketClaim returns the reference of a BucketClaim, or nil when it is
+// unknown.
+func BucketClaim(namespace, name string) *corev1.ObjectReference {
+	if name == "" {
+		return nil
+	}
+	return &corev1.ObjectReference{
+		APIVersion: cosiAPIVersion,
+		Kind:       kindBucketClaim,
+		Namespace:  namespace,
+		Name:       name,
+	}
+}
+
+// BucketAccess returns the reference of a BucketAccess, or nil when it is
+// unknown.
+func BucketAccess(namespace, name string, uid types.UID) *corev1.ObjectReference {
+	if name == "" {
+		return nil
+	}
+	return &corev1.ObjectReference{
+		APIVersion: cosiAPIVersion,
+		Kind:       kindBucketAccess,
+		Namespace:  namespace,
+		Name:       name,
+		UID:        uid,
+	}
+}
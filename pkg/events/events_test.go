@@ -0,0 +1,58 @@
+package events
+
+import (
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/japannext/cosi-powerscale/pkg/kube"
+)
+
+// fakeClient returns a client whose access reviews return allowed.
+func fakeClient(allowed bool) *kube.Client {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		review.Status.Allowed = allowed
+		return true, review, nil
+	})
+	return &kube.Client{Clientset: clientset}
+}
+
+func TestNew(t *testing.T) {
+	if _, ok := New(fakeClient(false), "test").(Discard); !ok {
+		t.Error("events must be disabled when RBAC does not allow them")
+	}
+	if _, ok := New(fakeClient(true), "test").(*kubeRecorder); !ok {
+		t.Error("events must be recorded when RBAC allows them")
+	}
+}
+
+func TestReferences(t *testing.T) {
+	if BucketClaim("default", "") != nil {
+		t.Error("an unknown BucketClaim must have no reference")
+	}
+	if BucketAccess("default", "", "") != nil {
+		t.Error("an unknown BucketAccess must have no reference")
+	}
+	ref := BucketAccess("default", "access", "1234")
+	if ref.Kind != "BucketAccess" || ref.APIVersion != "objectstorage.k8s.io/v1alpha1" || ref.Namespace != "default" || ref.UID != "1234" {
+		t.Errorf("unexpected reference %+v", ref)
+	}
+}
+
+func TestFake(t *testing.T) {
+	var recorder Recorder = &Fake{}
+	recorder.Eventf(nil, "Normal", "Ignored", "no object")
+	recorder.Eventf(BucketClaim("default", "claim"), "Warning", "Failed", "failed: %s", "error")
+	events := recorder.(*Fake).Events()
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	if events[0].Object.Name != "claim" || events[0].Reason != "Failed" || events[0].Message != "failed: error" {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+}
@@ -0,0 +1,43 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Event is an event recorded by a Fake recorder.
+type Event struct {
+	Object  corev1.ObjectReference
+	Type    string
+	Reason  string
+	Message string
+}
+
+// Fake keeps the recorded events in memory, for the tests.
+type Fake struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (f *Fake) Eventf(object *corev1.ObjectReference, eventType, reason, messageFmt string, args ...any) {
+	if object == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, Event{
+		Object:  *object,
+		Type:    eventType,
+		Reason:  reason,
+		Message: fmt.Sprintf(messageFmt, args...),
+	})
+}
+
+// Events returns the recorded events, in order.
+func (f *Fake) Events() []Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Event(nil), f.events...)
+}
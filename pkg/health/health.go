@@ -0,0 +1,169 @@
+// Package health reports whether the driver can reach OneFS, with the
+// standard grpc.health.v1 service on the gRPC socket and the optional
+// `/healthz` and `/readyz` HTTP endpoints for the Kubernetes probes.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	log "k8s.io/klog/v2"
+
+	"github.com/japannext/cosi-powerscale/pkg/config"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+)
+
+const checkTimeout = 10 * time.Second
+
+// Names of the COSI services in the grpc.health.v1 service.
+const (
+	identityService    = "cosi.v1alpha1.Identity"
+	provisionerService = "cosi.v1alpha1.Provisioner"
+)
+
+var errNotChecked = errors.New("OneFS not checked yet")
+
+// Checker periodically looks up the access zone of the driver, a cheap
+// request validating the endpoint, the credentials and the zone.
+type Checker struct {
+	powerscale *powerscale.Server
+	zone       string
+	interval   time.Duration
+	grpc       *grpchealth.Server
+
+	// validated is set by the first successful check.
+	validated atomic.Bool
+	mu        sync.Mutex
+	// err of the last check, nil when it passed.
+	err error
+}
+
+func New(cfg *config.Config, server *powerscale.Server) *Checker {
+	c := &Checker{
+		powerscale: server,
+		zone:       cfg.Zone,
+		interval:   cfg.HealthCheckInterval,
+		grpc:       grpchealth.NewServer(),
+		err:        errNotChecked,
+	}
+	c.setServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	return c
+}
+
+// Register registers the grpc.health.v1 service on the gRPC server.
+func (c *Checker) Register(server *grpc.Server) {
+	healthpb.RegisterHealthServer(server, c.grpc)
+}
+
+// Run checks OneFS every interval until the context is done.
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.check(ctx)
+		select {
+		case <-ctx.Done():
+			c.grpc.Shutdown()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Ready returns the error of the last check, nil when it passed.
+func (c *Checker) Ready() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Validate returns nil once a check passed. Until then, it checks OneFS
+// again, so that the first request does not wait for the next interval.
+func (c *Checker) Validate(ctx context.Context) error {
+	if c.validated.Load() {
+		return nil
+	}
+	return c.check(ctx)
+}
+
+func (c *Checker) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	zone, err := c.powerscale.WithContext(ctx).GetZone()
+	if err == nil && zone == nil {
+		err = fmt.Errorf("access zone %q not found", c.zone)
+	}
+	if err != nil {
+		err = fmt.Errorf("OneFS unreachable: %w", err)
+	}
+
+	c.mu.Lock()
+	previous := c.err
+	c.err = err
+	c.mu.Unlock()
+
+	switch {
+	case err != nil:
+		if previous == nil || errors.Is(previous, errNotChecked) {
+			log.ErrorS(err, "Health check failed")
+		}
+		c.setServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	default:
+		if previous != nil {
+			log.InfoS("Health check passed", "zone", zone.Name)
+		}
+		c.validated.Store(true)
+		c.setServingStatus(healthpb.HealthCheckResponse_SERVING)
+	}
+	return err
+}
+
+// setServingStatus sets the status of the server and of the Provisioner
+// service, the Identity service does not depend on OneFS.
+func (c *Checker) setServingStatus(status healthpb.HealthCheckResponse_ServingStatus) {
+	c.grpc.SetServingStatus("", status)
+	c.grpc.SetServingStatus(provisionerService, status)
+	c.grpc.SetServingStatus(identityService, healthpb.HealthCheckResponse_SERVING)
+}
+
+// Serve serves `/healthz` and `/readyz` on the address until the context is
+// done. The driver is live as long as it serves, and ready when the last
+// check of OneFS passed.
+func (c *Checker) Serve(ctx context.Context, address string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if err := c.Ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	log.InfoS("Health endpoints listening", "address", address)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
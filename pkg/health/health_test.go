@@ -0,0 +1,128 @@
+package health
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale/fake"
+)
+
+// serve starts the HTTP endpoints of the checker and returns their URL.
+func serve(t *testing.T, ctx context.Context, c *Checker) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := lis.Addr().String()
+	lis.Close()
+	go c.Serve(ctx, address)
+
+	url := "http://" + address
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(url + "/healthz")
+		if err == nil {
+			resp.Body.Close()
+			return url
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the health endpoints are not served: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestChecker(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	cfg := server.Config()
+	cfg.HealthCheckInterval = time.Minute
+	c := New(cfg, powerscale.New(cfg))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	url := serve(t, ctx, c)
+
+	expect := func(ready bool) {
+		t.Helper()
+		for _, endpoint := range []string{"/healthz", "/readyz"} {
+			resp, err := http.Get(url + endpoint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			expected := http.StatusOK
+			if endpoint == "/readyz" && !ready {
+				expected = http.StatusServiceUnavailable
+			}
+			if resp.StatusCode != expected {
+				t.Errorf("%s: expected %d, got %d: %s", endpoint, expected, resp.StatusCode, body)
+			}
+		}
+
+		expected := healthpb.HealthCheckResponse_SERVING
+		if !ready {
+			expected = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		for service, want := range map[string]healthpb.HealthCheckResponse_ServingStatus{
+			"":                 expected,
+			provisionerService: expected,
+			// The identity service does not depend on OneFS.
+			identityService: healthpb.HealthCheckResponse_SERVING,
+		} {
+			resp, err := c.grpc.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.GetStatus() != want {
+				t.Errorf("service %q: expected %s, got %s", service, want, resp.GetStatus())
+			}
+		}
+	}
+
+	// Not ready until the first check.
+	expect(false)
+	if err := c.Validate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expect(true)
+
+	server.Inject(fake.Fault{StatusCode: http.StatusServiceUnavailable})
+	if err := c.check(ctx); err == nil {
+		t.Fatal("expected the check to fail")
+	}
+	expect(false)
+	// Once validated, the identity service keeps answering.
+	if err := c.Validate(ctx); err != nil {
+		t.Errorf("unexpected validation error %v", err)
+	}
+
+	server.ClearFaults()
+	if err := c.check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expect(true)
+}
+
+func TestValidateUnreachable(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	cfg := server.Config()
+	cfg.Zone = "Missing"
+	c := New(cfg, powerscale.New(cfg))
+
+	if err := c.Validate(context.Background()); err == nil {
+		t.Fatal("expected a missing zone to fail the validation")
+	}
+	if err := c.Ready(); err == nil {
+		t.Error("expected the checker not to be ready")
+	}
+}
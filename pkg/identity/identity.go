@@ -9,15 +9,24 @@ import (
 	cosi "sigs.k8s.io/container-object-storage-interface-spec"
 )
 
+// Backend validates the storage backend of the driver.
+type Backend interface {
+	// Validate returns nil once the backend has been reached successfully.
+	Validate(ctx context.Context) error
+}
+
 type Server struct {
-	name string
+	name    string
+	backend Backend
 }
 
-func New(name string) *Server {
-	return &Server{name: name}
+func New(name string, backend Backend) *Server {
+	return &Server{name: name, backend: backend}
 }
 
-func (srv *Server) DriverGetInfo(_ context.Context,
+// DriverGetInfo fails until the backend is validated, so that the sidecar
+// does not start provisioning with an unreachable or misconfigured OneFS.
+func (srv *Server) DriverGetInfo(ctx context.Context,
 	_ *cosi.DriverGetInfoRequest,
 ) (*cosi.DriverGetInfoResponse, error) {
 
@@ -26,6 +35,11 @@ func (srv *Server) DriverGetInfo(_ context.Context,
 		return nil, status.Error(codes.InvalidArgument, "DriverName is empty")
 	}
 
+	if err := srv.backend.Validate(ctx); err != nil {
+		log.ErrorS(err, "backend not validated")
+		return nil, status.Errorf(codes.Unavailable, "backend not validated: %v", err)
+	}
+
 	return &cosi.DriverGetInfoResponse{
 		Name: srv.name,
 	}, nil
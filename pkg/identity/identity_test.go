@@ -0,0 +1,37 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+)
+
+type backend struct {
+	err error
+}
+
+func (b *backend) Validate(context.Context) error {
+	return b.err
+}
+
+func TestDriverGetInfo(t *testing.T) {
+	b := &backend{err: errors.New("OneFS unreachable")}
+	srv := New("fake.powerscale.cosi.japannext.co.jp", b)
+
+	if _, err := srv.DriverGetInfo(context.Background(), &cosi.DriverGetInfoRequest{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("expected Unavailable until the backend is validated, got %v", err)
+	}
+
+	b.err = nil
+	resp, err := srv.DriverGetInfo(context.Background(), &cosi.DriverGetInfoRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetName() != "fake.powerscale.cosi.japannext.co.jp" {
+		t.Errorf("unexpected name %s", resp.GetName())
+	}
+}
@@ -0,0 +1,117 @@
+package inventory
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+)
+
+var ErrUnknownFormat = errors.New("unknown output format")
+
+var columns = []string{"BUCKET", "PATH", "OWNER", "CLAIM", "CREATED", "GRANTEES", "QUOTA USED", "QUOTA HARD", "KEY AGES", "ERRORS"}
+
+// CheckFormat returns an error if the output format is not supported.
+func CheckFormat(format string) error {
+	switch format {
+	case FormatTable, FormatJSON, FormatCSV:
+		return nil
+	}
+	return fmt.Errorf("%w %q, expected %s, %s or %s", ErrUnknownFormat, format, FormatTable, FormatJSON, FormatCSV)
+}
+
+// Write prints the inventory in the given format.
+func Write(w io.Writer, format string, records []*Bucket) error {
+	switch format {
+	case FormatTable:
+		return writeTable(w, records)
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case FormatCSV:
+		return writeCSV(w, records)
+	default:
+		return CheckFormat(format)
+	}
+}
+
+// row returns the fields of a record, in the order of columns.
+func row(record *Bucket) []string {
+	claim := ""
+	if record.ClaimName != "" {
+		claim = record.ClaimNamespace + "/" + record.ClaimName
+	}
+	created := ""
+	switch {
+	case record.Unmarked:
+		created = "unmarked"
+	case !record.CreatedAt.IsZero():
+		created = record.CreatedAt.Format(time.RFC3339)
+	}
+
+	grantees := make([]string, 0, len(record.Grantees))
+	for _, grantee := range record.Grantees {
+		grantees = append(grantees, grantee.String())
+	}
+
+	used, hard := "", ""
+	if record.Quota != nil {
+		used = fmt.Sprint(record.Quota.Used)
+		if record.Quota.Hard != nil {
+			hard = fmt.Sprint(*record.Quota.Hard)
+		}
+	}
+
+	keys := make([]string, 0, len(record.Keys))
+	for _, key := range record.Keys {
+		keys = append(keys, fmt.Sprintf("%s=%s", key.User, key.Age))
+	}
+
+	return []string{
+		record.Name,
+		record.Path,
+		record.Owner,
+		claim,
+		created,
+		strings.Join(grantees, ";"),
+		used,
+		hard,
+		strings.Join(keys, ";"),
+		strings.Join(record.Errors, ";"),
+	}
+}
+
+func writeTable(w io.Writer, records []*Bucket) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	for _, record := range records {
+		fmt.Fprintln(tw, strings.Join(row(record), "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeCSV(w io.Writer, records []*Bucket) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := cw.Write(row(record)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,176 @@
+// Package inventory lists the buckets created by the driver, with their
+// grantees, quota usage and key ages, for audits. Buckets created before the
+// ownership markers are listed as unmarked when they are under the base path.
+package inventory
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+)
+
+// Bucket is the inventory record of a driver-managed bucket.
+type Bucket struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Owner string `json:"owner"`
+	// The bucket only has the legacy description, and may belong to another
+	// driver instance with the same base path.
+	Unmarked bool `json:"unmarked,omitempty"`
+	// From the ownership marker of the bucket.
+	CreatedAt      time.Time `json:"createdAt"`
+	ClaimNamespace string    `json:"claimNamespace,omitempty"`
+	ClaimName      string    `json:"claimName,omitempty"`
+	Grantees       []Grantee `json:"grantees"`
+	// Quota of the bucket directory, nil when it has none.
+	Quota *Quota `json:"quota,omitempty"`
+	Keys  []Key  `json:"keys"`
+	// Lookups which failed for this bucket, the other fields are partial.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Grantee is granted access to a bucket by its ACL or its policy.
+type Grantee struct {
+	// `user`, `group` or `policy`.
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	Permission string `json:"permission,omitempty"`
+}
+
+func (g Grantee) String() string {
+	if g.Permission == "" {
+		return fmt.Sprintf("%s:%s", g.Type, g.Name)
+	}
+	return fmt.Sprintf("%s:%s=%s", g.Type, g.Name, g.Permission)
+}
+
+// Quota is in bytes.
+type Quota struct {
+	Used int64  `json:"used"`
+	Hard *int64 `json:"hard,omitempty"`
+}
+
+// Key is the S3 key of a user granted access to a bucket.
+type Key struct {
+	User      string    `json:"user"`
+	AccessID  string    `json:"accessID"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Not serialized, the age is relative to the collection time.
+	Age time.Duration `json:"-"`
+}
+
+const grantPolicy = "policy"
+
+// Collect returns the inventory of the buckets owned by the driver instance.
+func Collect(server *powerscale.Server) ([]*Bucket, error) {
+	now := time.Now()
+	// Keys and group members are shared between buckets.
+	keys := make(map[string]*powerscale.Key)
+	members := make(map[string][]*powerscale.Member)
+
+	var records []*Bucket
+	it := server.Buckets(powerscale.ListOptions{})
+	for it.Next() {
+		bucket := it.Item()
+		record := &Bucket{
+			Name:  bucket.Name,
+			Path:  bucket.Path,
+			Owner: bucket.Owner,
+		}
+		switch owner := bucket.Ownership(); {
+		case server.Owns(owner):
+			record.CreatedAt = owner.CreatedAt
+			record.ClaimNamespace = owner.ClaimNamespace
+			record.ClaimName = owner.ClaimName
+		case bucket.Description == powerscale.LegacyBucketDescription && strings.HasPrefix(bucket.Path, server.BasePath()+"/"):
+			record.Unmarked = true
+		default:
+			continue
+		}
+
+		var users []string
+		for _, acl := range bucket.Acl {
+			if acl.Grantee == nil {
+				continue
+			}
+			grantee := Grantee{Type: acl.Grantee.Type, Name: acl.Grantee.Name, Permission: acl.Permission}
+			if grantee.Type == "" {
+				grantee.Type = powerscale.GranteeUser
+			}
+			record.Grantees = append(record.Grantees, grantee)
+
+			if grantee.Type != powerscale.GranteeGroup {
+				users = append(users, grantee.Name)
+				continue
+			}
+			if _, ok := members[grantee.Name]; !ok {
+				groupMembers, err := server.ListGroupMembers(grantee.Name, powerscale.ListOptions{})
+				if err != nil {
+					record.Errors = append(record.Errors, fmt.Sprintf("group %s: %v", grantee.Name, err))
+					continue
+				}
+				members[grantee.Name] = groupMembers
+			}
+			for _, member := range members[grantee.Name] {
+				users = append(users, member.Name)
+			}
+		}
+
+		// The failed lookups of the bucket are recorded, the rest of the
+		// inventory is still useful.
+		policy, err := server.GetBucketPolicy(bucket.Name)
+		if err != nil {
+			record.Errors = append(record.Errors, fmt.Sprintf("policy: %v", err))
+		}
+		if policy != nil {
+			for _, statement := range policy.Statement {
+				for _, principal := range statement.Principal.AWS {
+					grantee := Grantee{Type: grantPolicy, Name: principal}
+					if !slices.Contains(record.Grantees, grantee) {
+						record.Grantees = append(record.Grantees, grantee)
+					}
+					users = append(users, principal)
+				}
+			}
+		}
+
+		quota, err := server.GetDirectoryQuota(bucket.Path)
+		if err != nil {
+			record.Errors = append(record.Errors, fmt.Sprintf("quota: %v", err))
+		}
+		if quota != nil {
+			record.Quota = &Quota{Used: quota.Usage.FSLogical, Hard: quota.Thresholds.Hard}
+		}
+
+		slices.Sort(users)
+		for _, user := range slices.Compact(users) {
+			key, ok := keys[user]
+			if !ok {
+				key, err = server.GetKey(user)
+				if err != nil {
+					record.Errors = append(record.Errors, fmt.Sprintf("key %s: %v", user, err))
+					continue
+				}
+				keys[user] = key
+			}
+			if key == nil {
+				continue
+			}
+			record.Keys = append(record.Keys, Key{
+				User:      user,
+				AccessID:  key.AccessID,
+				CreatedAt: key.CreatedAt(),
+				Age:       now.Sub(key.CreatedAt()).Truncate(time.Second),
+			})
+		}
+
+		records = append(records, record)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
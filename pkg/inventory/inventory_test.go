@@ -0,0 +1,205 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale/fake"
+)
+
+func TestCollect(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	client := powerscale.New(server.Config())
+	other := powerscale.New(server.Config())
+	other.Name = "other"
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(client.CreateBucket("bucket-1", client.NewOwnership("1", "ns-1", "claim-1")))
+	must(client.CreateBucket("foreign", other.NewOwnership("", "", "")))
+	for _, userName := range []string{"app", "reader", "auditor"} {
+		must(client.CreateUser(userName, client.NewOwnership("", "", "")))
+		_, err := client.CreateKey(userName)
+		must(err)
+	}
+	must(client.CreateGroup("readers", client.NewOwnership("", "", "")))
+	must(client.AddGroupMember("readers", "reader"))
+	must(client.EnsureACL("bucket-1", powerscale.AclUser{Type: powerscale.GranteeUser, Name: "app"}, "FULL_CONTROL"))
+	must(client.EnsureACL("bucket-1", powerscale.AclUser{Type: powerscale.GranteeGroup, Name: "readers"}, "READ"))
+	must(client.EnsurePolicyStatements("bucket-1", powerscale.NewPolicyStatements("auditor", "bucket-1", "auditor", "", powerscale.StringList{"s3:GetObject"})...))
+	hard := int64(1 << 20)
+	server.SetQuota(fake.BasePath+"/bucket-1", powerscale.QuotaThresholds{Hard: &hard})
+	server.WriteFile(fake.BasePath+"/bucket-1/object", make([]byte, 100))
+
+	records, err := Collect(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected the bucket owned by the driver only, got %+v", records)
+	}
+	record := records[0]
+	if record.Name != "bucket-1" || record.ClaimNamespace != "ns-1" || record.ClaimName != "claim-1" || record.CreatedAt.IsZero() {
+		t.Errorf("unexpected record %+v", record)
+	}
+	grantees := []Grantee{
+		{Type: powerscale.GranteeUser, Name: "app", Permission: "FULL_CONTROL"},
+		{Type: powerscale.GranteeGroup, Name: "readers", Permission: "READ"},
+		{Type: grantPolicy, Name: "auditor"},
+	}
+	if !reflect.DeepEqual(record.Grantees, grantees) {
+		t.Errorf("unexpected grantees %+v", record.Grantees)
+	}
+	if record.Quota == nil || record.Quota.Used != 100 || *record.Quota.Hard != hard {
+		t.Errorf("unexpected quota %+v", record.Quota)
+	}
+	var keyUsers []string
+	for _, key := range record.Keys {
+		keyUsers = append(keyUsers, key.User)
+	}
+	if !reflect.DeepEqual(keyUsers, []string{"app", "auditor", "reader"}) {
+		t.Errorf("unexpected keys of %v", keyUsers)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	hard := int64(2048)
+	records := []*Bucket{{
+		Name:           "bucket-1",
+		Path:           "/ifs/data/cosi/bucket-1",
+		ClaimNamespace: "ns-1",
+		ClaimName:      "claim-1",
+		Grantees:       []Grantee{{Type: powerscale.GranteeUser, Name: "app", Permission: "FULL_CONTROL"}},
+		Quota:          &Quota{Used: 1024, Hard: &hard},
+	}, {
+		Name:     "legacy",
+		Path:     "/ifs/data/cosi/legacy",
+		Unmarked: true,
+		Errors:   []string{"quota: unavailable"},
+	}}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatCSV, records); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		columns,
+		{"bucket-1", "/ifs/data/cosi/bucket-1", "", "ns-1/claim-1", "", "user:app=FULL_CONTROL", "1024", "2048", "", ""},
+		{"legacy", "/ifs/data/cosi/legacy", "", "", "unmarked", "", "", "", "", "quota: unavailable"},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("unexpected rows %q", rows)
+	}
+
+	if err := Write(&buf, "yaml", records); err == nil {
+		t.Error("expected an unknown format error")
+	}
+}
+
+// Legacy buckets are listed as unmarked, and the lookup errors of a bucket
+// are recorded without failing the inventory.
+func TestCollectUnmarked(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	client := powerscale.New(server.Config())
+
+	if err := client.CreateBucket("bucket-1", client.NewOwnership("1", "ns-1", "claim-1")); err != nil {
+		t.Fatal(err)
+	}
+	server.AddBucket(powerscale.Bucket{Name: "legacy", Path: fake.BasePath + "/legacy", Description: powerscale.LegacyBucketDescription})
+	server.AddBucket(powerscale.Bucket{Name: "other", Path: fake.ZonePath + "/other/legacy", Description: powerscale.LegacyBucketDescription})
+	server.AddBucket(powerscale.Bucket{Name: "manual", Path: fake.BasePath + "/manual"})
+	// The quota lookup of the first bucket fails.
+	server.Inject(fake.Fault{Method: http.MethodGet, Path: "/platform/14/quota/quotas", StatusCode: http.StatusInternalServerError, Times: 1})
+
+	records, err := Collect(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]*Bucket)
+	for _, record := range records {
+		byName[record.Name] = record
+	}
+	if len(records) != 2 || byName["bucket-1"] == nil || byName["legacy"] == nil {
+		t.Fatalf("unexpected records %+v", records)
+	}
+	if record := byName["bucket-1"]; record.Unmarked || record.ClaimName != "claim-1" {
+		t.Errorf("unexpected record %+v", record)
+	}
+	if record := byName["legacy"]; !record.Unmarked {
+		t.Errorf("expected the legacy bucket to be unmarked, got %+v", record)
+	}
+	var failed []string
+	for _, record := range records {
+		if len(record.Errors) > 0 {
+			failed = append(failed, record.Name)
+			if !strings.HasPrefix(record.Errors[0], "quota: ") {
+				t.Errorf("unexpected errors %v", record.Errors)
+			}
+		}
+	}
+	if len(failed) != 1 {
+		t.Errorf("expected one bucket with a quota error, got %v", failed)
+	}
+}
+
+// The failed lookups of the group members and of the keys are recorded on
+// the bucket, the other grantees are still listed.
+func TestCollectLookupErrors(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	client := powerscale.New(server.Config())
+	owner := client.NewOwnership("", "", "")
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(client.CreateBucket("bucket-1", owner))
+	for _, userName := range []string{"app", "other"} {
+		must(client.CreateUser(userName, owner))
+		_, err := client.CreateKey(userName)
+		must(err)
+	}
+	must(client.CreateGroup("readers", owner))
+	for _, grantee := range []powerscale.AclUser{
+		{Type: powerscale.GranteeUser, Name: "app"},
+		{Type: powerscale.GranteeUser, Name: "other"},
+		{Type: powerscale.GranteeGroup, Name: "readers"},
+	} {
+		must(client.EnsureACL("bucket-1", grantee, "READ"))
+	}
+	server.Inject(fake.Fault{Method: http.MethodGet, Path: "/platform/14/auth/groups/readers/members", StatusCode: http.StatusInternalServerError})
+	server.Inject(fake.Fault{Method: http.MethodGet, Path: "/platform/14/protocols/s3/keys/app", StatusCode: http.StatusInternalServerError})
+
+	records, err := Collect(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("unexpected records %+v", records)
+	}
+	record := records[0]
+	if len(record.Grantees) != 3 || len(record.Keys) != 1 || record.Keys[0].User != "other" {
+		t.Errorf("unexpected record %+v", record)
+	}
+	if len(record.Errors) != 2 || !strings.HasPrefix(record.Errors[0], "group readers: ") || !strings.HasPrefix(record.Errors[1], "key app: ") {
+		t.Errorf("unexpected errors %q", record.Errors)
+	}
+}
@@ -0,0 +1,87 @@
+// Package kube gives the driver read access to the COSI objects of the
+// cluster, which are not part of the COSI gRPC requests.
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+var BucketAccessResource = schema.GroupVersionResource{
+	Group:    "objectstorage.k8s.io",
+	Version:  "v1alpha1",
+	Resource: "bucketaccesses",
+}
+
+var BucketResource = schema.GroupVersionResource{
+	Group:    "objectstorage.k8s.io",
+	Version:  "v1alpha1",
+	Resource: "buckets",
+}
+
+type Client struct {
+	Clientset kubernetes.Interface
+	Dynamic   dynamic.Interface
+}
+
+// NewInCluster returns a Client using the service account of the pod.
+func NewInCluster() (*Client, error) {
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load in-cluster config: %w", err)
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Clientset: clientset, Dynamic: dynamicClient}, nil
+}
+
+// ListBucketAccesses lists the BucketAccess objects of a namespace,
+// or of all namespaces when namespace is empty.
+func (c *Client) ListBucketAccesses(ctx context.Context, namespace string) ([]unstructured.Unstructured, error) {
+	list, err := c.Dynamic.Resource(BucketAccessResource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// FindBucketAccess returns the BucketAccess with the given UID, or nil.
+func (c *Client) FindBucketAccess(ctx context.Context, uid types.UID) (*unstructured.Unstructured, error) {
+	items, err := c.ListBucketAccesses(ctx, metav1.NamespaceAll)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		if items[i].GetUID() == uid {
+			return &items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// GetBucket returns the Bucket object of the given name, or nil.
+func (c *Client) GetBucket(ctx context.Context, name string) (*unstructured.Unstructured, error) {
+	bucket, err := c.Dynamic.Resource(BucketResource).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bucket, nil
+}
@@ -0,0 +1,111 @@
+// Package logging logs the gRPC requests of the sidecar with a request ID,
+// added to the contextual logger of the request so that the provisioner and
+// the OneFS client log lines of a request share it.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"runtime/debug"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	log "k8s.io/klog/v2"
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+
+	"github.com/japannext/cosi-powerscale/pkg/redact"
+)
+
+// RequestIDKey is the metadata key of the request ID, read from the request
+// when set by the caller and returned in the response headers.
+const RequestIDKey = "x-request-id"
+
+// Verbosity of the logs of the request and response bodies.
+const bodyVerbosity = 5
+
+// UnaryServerInterceptor assigns a request ID to the request, and logs its
+// start and its end, with its duration and status code.
+func UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	requestID := incomingRequestID(ctx)
+	if requestID == "" {
+		requestID = uuid.NewString()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(RequestIDKey, requestID))
+
+	method := path.Base(info.FullMethod)
+	logger := log.LoggerWithValues(log.FromContext(ctx), "requestID", requestID, "method", method)
+	ctx = log.NewContext(ctx, logger)
+	ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+
+	logger.Info("Request started", requestFields(req)...)
+	logger.V(bodyVerbosity).Info("Request", "request", req)
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	duration := time.Since(start)
+
+	code := status.Code(err)
+	if err != nil {
+		logger.Error(err, "Request failed", "code", code, "duration", duration)
+	} else {
+		logger.Info("Request finished", "code", code, "duration", duration)
+		logger.V(bodyVerbosity).Info("Response", "response", redact.Response(resp))
+	}
+	return resp, err
+}
+
+// RecoveryUnaryServerInterceptor turns the panics of the handlers into
+// Internal errors. It must be the last interceptor of the chain, so that the
+// other ones see the error.
+func RecoveryUnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.FromContext(ctx).Error(nil, "Request panicked", "panic", redact.String(fmt.Sprint(r)), "stack", string(debug.Stack()))
+			resp, err = nil, status.Errorf(codes.Internal, "internal error in %s", path.Base(info.FullMethod))
+		}
+	}()
+	return handler(ctx, req)
+}
+
+type requestIDKey struct{}
+
+// RequestID returns the ID of the gRPC request of the context, or "".
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+func incomingRequestID(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(RequestIDKey)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// requestFields returns the key fields of a request, identifying the bucket
+// and the BucketAccess. The parameters are not logged, they are only logged
+// with the request body at high verbosity.
+func requestFields(req any) []any {
+	switch r := req.(type) {
+	case *cosi.DriverCreateBucketRequest:
+		return []any{"bucket", r.GetName()}
+	case *cosi.DriverDeleteBucketRequest:
+		return []any{"bucketID", r.GetBucketId()}
+	case *cosi.DriverGrantBucketAccessRequest:
+		return []any{"bucketID", r.GetBucketId(), "bucketAccess", r.GetName(), "authenticationType", r.GetAuthenticationType()}
+	case *cosi.DriverRevokeBucketAccessRequest:
+		return []any{"bucketID", r.GetBucketId(), "accountID", r.GetAccountId()}
+	default:
+		return nil
+	}
+}
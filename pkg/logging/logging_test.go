@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	log "k8s.io/klog/v2"
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+)
+
+const testSecretKey = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+
+// captureLogs sends the logs to a buffer, at the highest verbosity.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	flags := flag.NewFlagSet("klog", flag.ContinueOnError)
+	log.InitFlags(flags)
+	for name, value := range map[string]string{"v": "10", "logtostderr": "false", "alsologtostderr": "false"} {
+		if err := flags.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() {
+		flags.Set("v", "0")
+		flags.Set("logtostderr", "true")
+		log.SetOutput(nil)
+	})
+	return &buf
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	buf := captureLogs(t)
+	info := &grpc.UnaryServerInfo{FullMethod: "/cosi.v1alpha1.Provisioner/DriverGrantBucketAccess"}
+	req := &cosi.DriverGrantBucketAccessRequest{BucketId: "test-bucket", Name: "ba-1234", AuthenticationType: cosi.AuthenticationType_Key}
+
+	var requestID string
+	handler := func(ctx context.Context, _ any) (any, error) {
+		log.FromContext(ctx).Info("Handler called")
+		requestID = incomingRequestID(ctx)
+		return &cosi.DriverGrantBucketAccessResponse{
+			AccountId: "cosi-ba-1234",
+			Credentials: map[string]*cosi.CredentialDetails{
+				"s3": {Secrets: map[string]string{"accessKeyID": "1_cosi_accid", "accessSecretKey": testSecretKey}},
+			},
+		}, nil
+	}
+	resp, err := UnaryServerInterceptor(context.Background(), req, info, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Flush()
+	logs := buf.String()
+
+	if strings.Contains(logs, testSecretKey) {
+		t.Errorf("log output contains the secret key:\n%s", logs)
+	}
+	if got := resp.(*cosi.DriverGrantBucketAccessResponse).Credentials["s3"].Secrets["accessSecretKey"]; got != testSecretKey {
+		t.Errorf("secret key = %q, want it unchanged in the response", got)
+	}
+	if requestID != "" {
+		t.Errorf("incoming request ID = %q, want none", requestID)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(logs), "\n") {
+		if !strings.Contains(line, "requestID=") {
+			t.Errorf("log line without request ID: %s", line)
+		}
+	}
+}
+
+func TestRecoveryUnaryServerInterceptor(t *testing.T) {
+	buf := captureLogs(t)
+	info := &grpc.UnaryServerInfo{FullMethod: "/cosi.v1alpha1.Provisioner/DriverCreateBucket"}
+	handler := func(context.Context, any) (any, error) {
+		panic(`unexpected key {"secret_key":"` + testSecretKey + `"}`)
+	}
+	_, err := RecoveryUnaryServerInterceptor(context.Background(), nil, info, handler)
+	if status.Code(err) != codes.Internal {
+		t.Errorf("code = %s, want %s", status.Code(err), codes.Internal)
+	}
+	if strings.Contains(err.Error(), testSecretKey) {
+		t.Errorf("error %q contains the panic value", err)
+	}
+	log.Flush()
+	if strings.Contains(buf.String(), testSecretKey) {
+		t.Errorf("log output contains the secret key:\n%s", buf)
+	}
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "k8s.io/klog/v2"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+)
+
+var (
+	managedBuckets = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "cosi_powerscale_managed_buckets",
+		Help: "Number of buckets created by the driver.",
+	})
+
+	managedUsers = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "cosi_powerscale_managed_users",
+		Help: "Number of users created by the driver.",
+	})
+
+	managedKeys = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "cosi_powerscale_managed_keys",
+		Help: "Number of S3 keys of the users created by the driver.",
+	})
+)
+
+// CountManaged updates the gauges of the objects created by the driver every
+// interval, until the context is done. Counting lists the whole zone, so it
+// is not done on every scrape.
+func CountManaged(ctx context.Context, server *powerscale.Server, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := countManaged(server); err != nil {
+			log.ErrorS(err, "Failed to count the objects managed by the driver")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func countManaged(server *powerscale.Server) error {
+	buckets := 0
+	bucketIt := server.Buckets(powerscale.ListOptions{})
+	for bucketIt.Next() {
+		if server.Owns(bucketIt.Item().Ownership()) {
+			buckets++
+		}
+	}
+	if err := bucketIt.Err(); err != nil {
+		return err
+	}
+
+	users, keys := 0, 0
+	userIt := server.Users(powerscale.ListOptions{})
+	for userIt.Next() {
+		user := userIt.Item()
+		if !server.Owns(user.Ownership()) {
+			continue
+		}
+		users++
+		key, err := server.GetKey(user.Name)
+		if err != nil {
+			return err
+		}
+		if key != nil {
+			keys++
+		}
+	}
+	if err := userIt.Err(); err != nil {
+		return err
+	}
+
+	managedBuckets.Set(float64(buckets))
+	managedUsers.Set(float64(users))
+	managedKeys.Set(float64(keys))
+	return nil
+}
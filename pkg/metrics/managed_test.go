@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale/fake"
+)
+
+func TestCountManaged(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	client := powerscale.New(server.Config())
+	other := powerscale.New(server.Config())
+	other.Name = "other"
+
+	owner := client.NewOwnership("", "", "")
+	for _, name := range []string{"bucket-1", "bucket-2"} {
+		if err := client.CreateBucket(name, owner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.CreateBucket("foreign", other.NewOwnership("", "", "")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ba-1", "ba-2", "ba-3"} {
+		if err := client.CreateUser(name, owner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.CreateUser("foreign", other.NewOwnership("", "", "")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ba-1", "foreign"} {
+		if _, err := client.CreateKey(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := countManaged(client); err != nil {
+		t.Fatal(err)
+	}
+	for name, test := range map[string]struct {
+		value    float64
+		expected float64
+	}{
+		"buckets": {testutil.ToFloat64(managedBuckets), 2},
+		"users":   {testutil.ToFloat64(managedUsers), 3},
+		"keys":    {testutil.ToFloat64(managedKeys), 1},
+	} {
+		if test.value != test.expected {
+			t.Errorf("expected %v managed %s, got %v", test.expected, name, test.value)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/cosi.v1alpha1.Provisioner/DriverCreateBucket"}
+	ok := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+	failed := func(ctx context.Context, req any) (any, error) { return nil, status.Error(codes.NotFound, "not found") }
+
+	for range 2 {
+		if _, err := UnaryServerInterceptor(context.Background(), nil, info, ok); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := UnaryServerInterceptor(context.Background(), nil, info, failed); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected the error of the handler, got %v", err)
+	}
+
+	if count := testutil.ToFloat64(rpcRequests.WithLabelValues("DriverCreateBucket", "OK")); count != 2 {
+		t.Errorf("expected 2 successful requests, got %v", count)
+	}
+	if count := testutil.ToFloat64(rpcRequests.WithLabelValues("DriverCreateBucket", "NotFound")); count != 1 {
+		t.Errorf("expected 1 failed request, got %v", count)
+	}
+}
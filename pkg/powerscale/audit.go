@@ -0,0 +1,38 @@
+package powerscale
+
+import (
+	"time"
+
+	"github.com/japannext/cosi-powerscale/pkg/audit"
+	"github.com/japannext/cosi-powerscale/pkg/logging"
+	"github.com/japannext/cosi-powerscale/pkg/redact"
+)
+
+// audit writes the audit record of a mutating operation, with its result
+// and the actor and request ID of the Server context. Failing to write the
+// record does not fail the operation.
+func (s *Server) audit(record *audit.Record, err error) {
+	if s.auditSink == nil {
+		return
+	}
+	record.Time = time.Now().UTC()
+	record.Driver = s.Name
+	if s.ctx != nil {
+		record.RequestID = logging.RequestID(s.ctx)
+		record.Actor = audit.ActorFromContext(s.ctx)
+	}
+	record.Result = audit.ResultSuccess
+	if err != nil {
+		record.Result = audit.ResultFailure
+		record.Error = redact.String(err.Error())
+	}
+	if err := s.auditSink.Write(record); err != nil {
+		auditErrors.Inc()
+		s.logger().Error(err, "Failed to write audit record", "operation", record.Operation)
+	}
+}
+
+// granteeName returns the grantee of an ACL entry in the audit records.
+func granteeName(grantee AclUser) string {
+	return grantee.Type + ":" + grantee.Name
+}
@@ -0,0 +1,125 @@
+package powerscale_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/japannext/cosi-powerscale/pkg/audit"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale/fake"
+)
+
+// auditRecord is an audit record as written in the log, with the ACLs kept
+// in their JSON form.
+type auditRecord struct {
+	audit.Record
+	Before []powerscale.ACL `json:"before"`
+	After  []powerscale.ACL `json:"after"`
+}
+
+func readAuditLog(t *testing.T, path string) []auditRecord {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var records []auditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// Failed changes are recorded with the actor they were made for, and the ACL
+// they were applied on.
+func TestAuditFailures(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	cfg := server.Config()
+	cfg.AuditLog = filepath.Join(t.TempDir(), "audit.log")
+	client := powerscale.New(cfg)
+
+	actor := &audit.Actor{Kind: audit.KindBucketAccess, Namespace: "ns-1", Name: "access-1", UID: "1", AccountID: "ba-1"}
+	scoped := client.WithContext(audit.WithActor(context.Background(), actor))
+
+	owner := client.NewOwnership("", "", "")
+	if err := client.CreateBucket("bucket-1", owner); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"user-1", "user-2"} {
+		if err := client.CreateUser(name, owner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	existing := powerscale.AclUser{Type: powerscale.GranteeUser, Name: "user-1"}
+	if err := client.EnsureACL("bucket-1", existing, "FULL_CONTROL"); err != nil {
+		t.Fatal(err)
+	}
+
+	failures := []struct {
+		operation string
+		fault     fake.Fault
+		run       func() error
+	}{
+		{"CreateBucket", fake.Fault{Method: http.MethodPost, Path: "/platform/14/protocols/s3/buckets"}, func() error {
+			return scoped.CreateBucket("bucket-2", owner)
+		}},
+		{"EnsureACL", fake.Fault{Method: http.MethodPut, Path: "/platform/14/protocols/s3/buckets/bucket-1"}, func() error {
+			return scoped.EnsureACL("bucket-1", powerscale.AclUser{Type: powerscale.GranteeUser, Name: "user-2"}, "FULL_CONTROL")
+		}},
+		{"DeleteUser", fake.Fault{Method: http.MethodDelete, Path: "/platform/14/auth/users/user-2"}, func() error {
+			return scoped.DeleteUser("user-2")
+		}},
+	}
+	for _, failure := range failures {
+		failure.fault.StatusCode = http.StatusInternalServerError
+		server.Inject(failure.fault)
+		if err := failure.run(); err == nil {
+			t.Errorf("%s: expected the injected failure", failure.operation)
+		}
+		server.ClearFaults()
+	}
+
+	recorded := make(map[string]auditRecord)
+	for _, record := range readAuditLog(t, cfg.AuditLog) {
+		if record.Result == audit.ResultFailure {
+			recorded[record.Operation] = record
+		}
+	}
+	for _, failure := range failures {
+		record, ok := recorded[failure.operation]
+		if !ok {
+			t.Errorf("%s: no failure recorded", failure.operation)
+			continue
+		}
+		if record.Error == "" || record.Driver != "fake" {
+			t.Errorf("%s: unexpected record %+v", failure.operation, record)
+		}
+		if record.Actor == nil || *record.Actor != *actor {
+			t.Errorf("%s: unexpected actor %+v", failure.operation, record.Actor)
+		}
+	}
+
+	// The ACL was left unchanged by the failed update.
+	record := recorded["EnsureACL"]
+	if len(record.Before) != 1 || record.Before[0].Grantee.Name != "user-1" {
+		t.Errorf("unexpected ACL before %+v", record.Before)
+	}
+	if len(record.After) != 1 || record.After[0].Grantee.Name != "user-1" {
+		t.Errorf("unexpected ACL after %+v", record.After)
+	}
+}
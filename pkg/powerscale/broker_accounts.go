@@ -0,0 +1,45 @@
+package powerscale
+
+// Directory under the base path holding the accounts whose keys are rotated
+// by the credential broker, one empty file per account.
+const brokerAccountsDir = ".cosi-broker"
+
+func (s *Server) brokerAccountsPath() string {
+	return s.basePath + "/" + brokerAccountsDir
+}
+
+func (s *Server) brokerAccountPath(accountID string) string {
+	return s.brokerAccountsPath() + "/" + accountID
+}
+
+// AddBrokerAccount records an account whose key is rotated by the credential
+// broker, so that the rotation resumes after a restart of the driver.
+func (s *Server) AddBrokerAccount(accountID string) error {
+	path := s.brokerAccountPath(accountID)
+	if err := s.WriteFile(path, nil); err != nil {
+		return err
+	}
+	return s.SetDirectoryOwnership(path, s.NewOwnership("", "", ""))
+}
+
+// RemoveBrokerAccount forgets an account recorded by AddBrokerAccount.
+func (s *Server) RemoveBrokerAccount(accountID string) error {
+	return s.DeleteFile(s.brokerAccountPath(accountID))
+}
+
+// ListBrokerAccounts returns the accounts recorded by AddBrokerAccount.
+func (s *Server) ListBrokerAccounts() ([]string, error) {
+	exists, err := s.DirectoryExists(s.brokerAccountsPath())
+	if err != nil || !exists {
+		return nil, err
+	}
+	entries, err := s.ListDirectory(s.brokerAccountsPath(), ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	accounts := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		accounts = append(accounts, entry.Name)
+	}
+	return accounts, nil
+}
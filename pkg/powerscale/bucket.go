@@ -8,7 +8,7 @@ import (
 	"net/http"
 	"strings"
 
-	log "k8s.io/klog/v2"
+	"github.com/japannext/cosi-powerscale/pkg/audit"
 )
 
 // getBucket is used to obtain bucket info from the Provisioner.
@@ -19,7 +19,7 @@ func (s *Server) GetBucket(bucketName string) (*Bucket, error) {
 		return nil, err
 	}
 	s.basicAuth(req)
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -32,7 +32,7 @@ func (s *Server) GetBucket(bucketName string) (*Bucket, error) {
 		return nil, err
 	}
 	if resp.StatusCode > 299 {
-		return nil, fmt.Errorf("Unexpected status code %d: %s", resp.StatusCode, body)
+		return nil, newStatusError(resp.StatusCode, body)
 	}
 
 	var bucketList BucketList
@@ -47,7 +47,12 @@ func (s *Server) GetBucket(bucketName string) (*Bucket, error) {
 }
 
 // createBucket is used to create bucket on the Provisioner.
-func (s *Server) CreateBucket(bucketName string) error {
+// The ownership marker is stored in the bucket description and on its directory.
+func (s *Server) CreateBucket(bucketName string, owner Ownership) (err error) {
+	defer func() {
+		s.audit(&audit.Record{Operation: "CreateBucket", Bucket: bucketName, Path: s.getBucketPath(bucketName)}, err)
+	}()
+
 	bucket := &Bucket{
 		Name:            bucketName,
 		Path:            s.getBucketPath(bucketName),
@@ -55,7 +60,7 @@ func (s *Server) CreateBucket(bucketName string) error {
 		ObjectACLPolicy: "replace",
 		Acl:             []ACL{},
 		Owner:           "root",
-		Description:     "Created by cosi-powerscale",
+		Description:     owner.String(),
 	}
 
 	data, err := json.Marshal(&bucket)
@@ -70,7 +75,7 @@ func (s *Server) CreateBucket(bucketName string) error {
 	}
 	req.Header.Set("Content-Type", "application/json")
 	s.basicAuth(req)
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return err
 	}
@@ -80,21 +85,28 @@ func (s *Server) CreateBucket(bucketName string) error {
 		return err
 	}
 	if resp.StatusCode > 299 {
-		return fmt.Errorf("Unexpected status code %d: %s", resp.StatusCode, body)
+		return newStatusError(resp.StatusCode, body)
+	}
+
+	// The bucket description already holds the marker, do not fail the creation.
+	if err := s.SetDirectoryOwnership(bucket.Path, owner); err != nil {
+		s.logger().Error(err, "failed to set directory ownership", "bucket", bucket.Name, "directory", bucket.Path)
 	}
 
-	log.InfoS("CreateBucket success", "bucket", bucket.Name)
+	s.logger().Info("CreateBucket success", "bucket", bucket.Name)
 	return nil
 }
 
-func (s *Server) DeleteBucket(bucketName string) error {
+func (s *Server) DeleteBucket(bucketName string) (err error) {
+	defer func() { s.audit(&audit.Record{Operation: "DeleteBucket", Bucket: bucketName}, err) }()
+
 	url := fmt.Sprintf("%s/platform/14/protocols/s3/buckets/%s?zone=%s", s.apiEndpoint, bucketName, s.zone)
 	req, err := http.NewRequest(http.MethodDelete, url, nil)
 	if err != nil {
 		return err
 	}
 	s.basicAuth(req)
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return err
 	}
@@ -104,14 +116,14 @@ func (s *Server) DeleteBucket(bucketName string) error {
 		return err
 	}
 	if resp.StatusCode == 404 {
-		log.InfoS("DeleteBucket success (not found)", "bucket", bucketName)
+		s.logger().Info("DeleteBucket success (not found)", "bucket", bucketName)
 		return nil
 	}
 	if resp.StatusCode > 299 {
-		return fmt.Errorf("Unexpected status code %d: %s", resp.StatusCode, body)
+		return newStatusError(resp.StatusCode, body)
 	}
 
-	log.InfoS("DeleteBucket success", "bucket", bucketName)
+	s.logger().Info("DeleteBucket success", "bucket", bucketName)
 
 	return nil
 }
@@ -121,14 +133,20 @@ func (s *Server) getBucketPath(bucketName string) string {
 }
 
 func (s *Server) DeleteDirectoryForBucket(bucketName string) error {
-	path := s.getBucketPath(bucketName)
-	url := fmt.Sprintf("%s/namespace/%s?recursive=true", s.apiEndpoint, path)
+	return s.DeleteDirectory(s.getBucketPath(bucketName))
+}
+
+// DeleteDirectory deletes a directory of the namespace and its content.
+func (s *Server) DeleteDirectory(path string) (err error) {
+	defer func() { s.audit(&audit.Record{Operation: "DeleteDirectory", Path: path}, err) }()
+
+	url := s.namespaceURL(path) + "?recursive=true"
 	req, err := http.NewRequest(http.MethodDelete, url, nil)
 	if err != nil {
 		return err
 	}
 	s.basicAuth(req)
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return err
 	}
@@ -138,13 +156,13 @@ func (s *Server) DeleteDirectoryForBucket(bucketName string) error {
 		return err
 	}
 	if resp.StatusCode == 404 {
-		log.InfoS("DeleteDirectory success (not found)", "directory", path)
+		s.logger().Info("DeleteDirectory success (not found)", "directory", path)
 		return nil
 	}
 	if resp.StatusCode > 299 {
-		return fmt.Errorf("Unexpected status code %d: %s", resp.StatusCode, body)
+		return newStatusError(resp.StatusCode, body)
 	}
 
-	log.InfoS("DeleteDirectory success", "directory", path)
+	s.logger().Info("DeleteDirectory success", "directory", path)
 	return nil
 }
@@ -3,16 +3,39 @@ package powerscale
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
-	log "k8s.io/klog/v2"
+	"github.com/japannext/cosi-powerscale/pkg/audit"
 )
 
+const (
+	// Number of read-modify-write attempts of a bucket ACL before giving up.
+	aclUpdateAttempts = 5
+	aclRetryInterval  = 500 * time.Millisecond
+)
+
+var ErrACLVerificationFailed = errors.New("bucket ACL does not contain the expected entries after update")
+
+// sameGrantee reports whether an ACL entry targets the given grantee.
+// Entries are keyed on type+name, a user and a group may share a name.
+func sameGrantee(acl ACL, grantee AclUser) bool {
+	if acl.Grantee == nil {
+		return false
+	}
+	granteeType := acl.Grantee.Type
+	if granteeType == "" {
+		granteeType = GranteeUser
+	}
+	return granteeType == grantee.Type && acl.Grantee.Name == grantee.Name
+}
+
 func aclInsert(acls []ACL, newAcl ACL) []ACL {
 	for i, acl := range acls {
-		if acl.Grantee.Name == newAcl.Grantee.Name {
+		if sameGrantee(acl, *newAcl.Grantee) {
 			acls[i] = newAcl
 			return acls
 		}
@@ -21,71 +44,115 @@ func aclInsert(acls []ACL, newAcl ACL) []ACL {
 	return acls
 }
 
-func (s *Server) EnsureACL(bucketName, userName, permission string) error {
-	bucket, err := s.GetBucket(bucketName)
-	if err != nil {
-		return err
-	}
-
-	newAcl := ACL{
-		Grantee:    &AclUser{Type: "user", Name: userName},
-		Permission: permission,
-	}
-	bucketUpdate := &PartialBucket{
-		Acl: aclInsert(bucket.Acl, newAcl),
-	}
-
-	data, err := json.Marshal(&bucketUpdate)
-	if err != nil {
-		return err
+// aclContains reports whether the grantee has the given permission.
+// An empty permission matches any entry of the grantee.
+func aclContains(acls []ACL, grantee AclUser, permission string) bool {
+	for _, acl := range acls {
+		if sameGrantee(acl, grantee) && (permission == "" || acl.Permission == permission) {
+			return true
+		}
 	}
+	return false
+}
 
-	url := fmt.Sprintf("%s/platform/14/protocols/s3/buckets/%s?zone=%s", s.apiEndpoint, bucketName, s.zone)
-	req, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(data))
-	if err != nil {
-		return err
-	}
-	s.basicAuth(req)
-	req.Header.Set("Content-Type", "application/json")
+// EnsureACL grants a permission on the bucket to a grantee of type
+// GranteeUser or GranteeGroup.
+//
+// Updates of the same bucket ACL are serialized within the driver, and each
+// update is verified by reading the ACL back, since a concurrent writer
+// outside of the driver may overwrite it.
+func (s *Server) EnsureACL(bucketName string, grantee AclUser, permission string) (err error) {
+	record := &audit.Record{Operation: "EnsureACL", Bucket: bucketName, Grantee: granteeName(grantee), Permission: permission}
+	defer func() { s.audit(record, err) }()
+
+	unlock := s.bucketLocks.Lock(bucketName)
+	defer unlock()
+
+	for attempt := 1; ; attempt++ {
+		bucket, err := s.GetBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if bucket == nil {
+			return fmt.Errorf("bucket %s not found", bucketName)
+		}
+		if attempt == 1 {
+			record.Before = bucket.Acl
+		}
+		record.After = bucket.Acl
+		if aclContains(bucket.Acl, grantee, permission) {
+			s.logger().Info("EnsureACL success", "bucket", bucket.Name, "granteeType", grantee.Type, "granteeName", grantee.Name, "attempt", attempt)
+			return nil
+		}
+		if attempt > aclUpdateAttempts {
+			return fmt.Errorf("%w: bucket %s, %s %s", ErrACLVerificationFailed, bucketName, grantee.Type, grantee.Name)
+		}
+		if attempt > 1 {
+			s.logger().Info("EnsureACL retrying, ACL entry missing after update", "bucket", bucketName, "granteeType", grantee.Type, "granteeName", grantee.Name, "attempt", attempt)
+			retries.WithLabelValues("EnsureACL").Inc()
+			time.Sleep(aclRetryInterval)
+		}
 
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return err
+		newAcl := ACL{
+			Grantee:    &grantee,
+			Permission: permission,
+		}
+		if err := s.putACL(bucketName, aclInsert(bucket.Acl, newAcl)); err != nil {
+			return err
+		}
 	}
+}
 
-	body, err := io.ReadAll(resp.Body)
-	defer resp.Body.Close()
-	if err != nil {
-		return err
-	}
-	if resp.StatusCode > 299 {
-		return fmt.Errorf("Unexpected status code %d: %s", resp.StatusCode, body)
-	}
+// DeleteACL removes the ACL entry of a grantee from the bucket.
+func (s *Server) DeleteACL(bucketName string, grantee AclUser) (err error) {
+	record := &audit.Record{Operation: "DeleteACL", Bucket: bucketName, Grantee: granteeName(grantee)}
+	defer func() { s.audit(record, err) }()
 
-	log.InfoS("EnsureACL success", "bucket", bucket.Name, "userName", userName)
-	return nil
-}
+	unlock := s.bucketLocks.Lock(bucketName)
+	defer unlock()
 
-func (s *Server) DeleteACL(bucketName, userName string) error {
-	bucket, err := s.GetBucket(bucketName)
-	if err != nil {
-		return err
-	}
-	if bucket == nil {
-		log.InfoS("DeleteACL success (bucket not found)", "bucket", bucketName)
-		return nil
-	}
+	for attempt := 1; ; attempt++ {
+		bucket, err := s.GetBucket(bucketName)
+		if err != nil {
+			return err
+		}
+		if bucket == nil {
+			s.logger().Info("DeleteACL success (bucket not found)", "bucket", bucketName)
+			return nil
+		}
+		if attempt == 1 {
+			record.Before = bucket.Acl
+		}
+		record.After = bucket.Acl
+		if !aclContains(bucket.Acl, grantee, "") {
+			s.logger().Info("DeleteACL success", "bucket", bucketName, "granteeType", grantee.Type, "granteeName", grantee.Name, "attempt", attempt)
+			return nil
+		}
+		if attempt > aclUpdateAttempts {
+			return fmt.Errorf("%w: bucket %s, %s %s", ErrACLVerificationFailed, bucketName, grantee.Type, grantee.Name)
+		}
+		if attempt > 1 {
+			s.logger().Info("DeleteACL retrying, ACL entry still present after update", "bucket", bucketName, "granteeType", grantee.Type, "granteeName", grantee.Name, "attempt", attempt)
+			retries.WithLabelValues("DeleteACL").Inc()
+			time.Sleep(aclRetryInterval)
+		}
 
-	newAcls := []ACL{}
-	if len(bucket.Acl) > 0 {
+		newAcls := []ACL{}
 		for _, acl := range bucket.Acl {
-			if acl.Grantee.Name != userName {
+			if !sameGrantee(acl, grantee) {
 				newAcls = append(newAcls, acl)
 			}
 		}
+		if err := s.putACL(bucketName, newAcls); err != nil {
+			return err
+		}
 	}
+}
+
+// putACL replaces the whole ACL of the bucket.
+func (s *Server) putACL(bucketName string, acls []ACL) error {
 	bucketUpdate := &PartialBucket{
-		Acl: newAcls,
+		Acl: acls,
 	}
 
 	data, err := json.Marshal(&bucketUpdate)
@@ -101,7 +168,7 @@ func (s *Server) DeleteACL(bucketName, userName string) error {
 	s.basicAuth(req)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return err
 	}
@@ -111,14 +178,13 @@ func (s *Server) DeleteACL(bucketName, userName string) error {
 	if err != nil {
 		return err
 	}
+	// The bucket vanished, the verification read will tell.
 	if resp.StatusCode == 404 {
-		log.InfoS("DeleteACL success (not found)", "bucket", bucketName, "userName", userName)
 		return nil
 	}
 	if resp.StatusCode > 299 {
-		return fmt.Errorf("Unexpected status code %d: %s", resp.StatusCode, body)
+		return newStatusError(resp.StatusCode, body)
 	}
 
-	log.InfoS("DeleteACL success", "bucket", bucket.Name, "userName", userName)
 	return nil
 }
@@ -0,0 +1,61 @@
+package powerscale_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale/fake"
+)
+
+// The fake replaces the whole ACL on update, as OneFS does: unserialized
+// read-modify-write cycles would lose entries.
+func TestEnsureACLConcurrent(t *testing.T) {
+	const grants = 20
+	server := fake.NewServer()
+	defer server.Close()
+	client := powerscale.New(server.Config())
+	owner := client.NewOwnership("", "", "")
+
+	if err := client.CreateBucket("bucket-1", owner); err != nil {
+		t.Fatal(err)
+	}
+	for i := range grants {
+		if err := client.CreateUser(fmt.Sprintf("user-%d", i), owner); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, grants)
+	for i := range grants {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			grantee := powerscale.AclUser{Type: powerscale.GranteeUser, Name: fmt.Sprintf("user-%d", i)}
+			errs <- client.EnsureACL("bucket-1", grantee, "FULL_CONTROL")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	acl := server.Bucket("bucket-1").Acl
+	names := make(map[string]bool)
+	for _, entry := range acl {
+		names[entry.Grantee.Name] = true
+	}
+	for i := range grants {
+		if name := fmt.Sprintf("user-%d", i); !names[name] {
+			t.Errorf("missing ACL entry of %s", name)
+		}
+	}
+	if len(acl) != grants {
+		t.Errorf("expected %d ACL entries, got %d", grants, len(acl))
+	}
+}
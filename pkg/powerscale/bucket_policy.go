@@ -0,0 +1,234 @@
+package powerscale
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/japannext/cosi-powerscale/pkg/audit"
+)
+
+const (
+	// Bucket policies are only exposed by recent versions of the platform API.
+	policyAPIVersion = 17
+	policyVersion    = "2012-10-17"
+)
+
+// PolicyStatementID returns the statement ID of a grant. Statement IDs only
+// allow alphanumeric characters.
+func PolicyStatementID(name string) string {
+	return strings.Map(func(r rune) rune {
+		if ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// listStatementSuffix is appended to the Sid of the ListBucket statement of
+// a prefix-scoped grant.
+const listStatementSuffix = "List"
+
+// NewPolicyStatements returns the statements allowing the actions to a user.
+//
+// Without prefix, a single statement covers the bucket and all its objects.
+// With a prefix, the actions are limited to the objects under `<prefix>/`,
+// and a second statement allows ListBucket restricted to that prefix.
+func NewPolicyStatements(sid, bucketName, userName, prefix string, actions StringList) []PolicyStatement {
+	bucketARN := fmt.Sprintf("arn:aws:s3:::%s", bucketName)
+	principal := PolicyPrincipal{AWS: StringList{userName}}
+
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return []PolicyStatement{{
+			Sid:       sid,
+			Effect:    allowEffect,
+			Principal: principal,
+			Action:    actions,
+			Resource:  StringList{bucketARN, bucketARN + "/*"},
+		}}
+	}
+
+	return []PolicyStatement{
+		{
+			Sid:       sid,
+			Effect:    allowEffect,
+			Principal: principal,
+			Action:    actions,
+			Resource:  StringList{fmt.Sprintf("%s/%s/*", bucketARN, prefix)},
+		},
+		{
+			Sid:       sid + listStatementSuffix,
+			Effect:    allowEffect,
+			Principal: principal,
+			Action:    StringList{"s3:ListBucket"},
+			Resource:  StringList{bucketARN},
+			Condition: map[string]map[string]StringList{
+				"StringLike": {"s3:prefix": StringList{prefix + "/", prefix + "/*"}},
+			},
+		},
+	}
+}
+
+func (s *Server) bucketPolicyURL(bucketName string) string {
+	return fmt.Sprintf("%s/platform/%d/protocols/s3/buckets/%s/policy?zone=%s", s.apiEndpoint, policyAPIVersion, bucketName, s.zone)
+}
+
+// GetBucketPolicy returns the policy of the bucket, or nil if it has none.
+func (s *Server) GetBucketPolicy(bucketName string) (*BucketPolicy, error) {
+	req, err := http.NewRequest(http.MethodGet, s.bucketPolicyURL(bucketName), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.basicAuth(req)
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == 404 {
+		return nil, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToCheckPolicyExists, newStatusError(resp.StatusCode, body))
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+
+	var policy BucketPolicy
+	if err := json.Unmarshal(body, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// putBucketPolicy replaces the policy of the bucket, or deletes it when it
+// has no statement left.
+func (s *Server) putBucketPolicy(bucketName string, policy *BucketPolicy) error {
+	method := http.MethodPut
+	var data []byte
+	if len(policy.Statement) == 0 {
+		method = http.MethodDelete
+	} else {
+		var err error
+		data, err = json.Marshal(policy)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrFailedToMarshalPolicy, err)
+		}
+	}
+
+	req, err := http.NewRequest(method, s.bucketPolicyURL(bucketName), bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	s.basicAuth(req)
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if method == http.MethodDelete && resp.StatusCode == 404 {
+		return nil
+	}
+	if resp.StatusCode > 299 {
+		return newStatusError(resp.StatusCode, body)
+	}
+	return nil
+}
+
+// EnsurePolicyStatements adds the statements to the bucket policy, replacing
+// the statements with the same Sid.
+func (s *Server) EnsurePolicyStatements(bucketName string, statements ...PolicyStatement) (err error) {
+	defer func() {
+		s.audit(&audit.Record{Operation: "EnsurePolicyStatements", Bucket: bucketName, Sid: statementIDs(statements)}, err)
+	}()
+
+	unlock := s.bucketLocks.Lock(bucketName)
+	defer unlock()
+
+	policy, err := s.GetBucketPolicy(bucketName)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		policy = &BucketPolicy{Version: policyVersion}
+	}
+
+	for _, statement := range statements {
+		i := slices.IndexFunc(policy.Statement, func(st PolicyStatement) bool { return st.Sid == statement.Sid })
+		if i >= 0 {
+			policy.Statement[i] = statement
+		} else {
+			policy.Statement = append(policy.Statement, statement)
+		}
+	}
+
+	if err := s.putBucketPolicy(bucketName, policy); err != nil {
+		return err
+	}
+
+	s.logger().Info("EnsurePolicyStatements success", "bucket", bucketName, "statements", len(statements))
+	return nil
+}
+
+// statementIDs returns the Sids of the statements, for the audit records.
+func statementIDs(statements []PolicyStatement) string {
+	sids := make([]string, 0, len(statements))
+	for _, statement := range statements {
+		sids = append(sids, statement.Sid)
+	}
+	return strings.Join(sids, ",")
+}
+
+// DeletePolicyStatements removes the statements of a grant, created by
+// NewPolicyStatements with the given Sid, from the bucket policy. Other
+// statements are kept.
+func (s *Server) DeletePolicyStatements(bucketName, sid string) (err error) {
+	defer func() {
+		s.audit(&audit.Record{Operation: "DeletePolicyStatements", Bucket: bucketName, Sid: sid}, err)
+	}()
+
+	unlock := s.bucketLocks.Lock(bucketName)
+	defer unlock()
+
+	policy, err := s.GetBucketPolicy(bucketName)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		s.logger().Info("DeletePolicyStatements success (no policy)", "bucket", bucketName, "sid", sid)
+		return nil
+	}
+
+	count := len(policy.Statement)
+	policy.Statement = slices.DeleteFunc(policy.Statement, func(st PolicyStatement) bool {
+		return st.Sid == sid || st.Sid == sid+listStatementSuffix
+	})
+	if len(policy.Statement) == count {
+		s.logger().Info("DeletePolicyStatements success (no statement)", "bucket", bucketName, "sid", sid)
+		return nil
+	}
+
+	if err := s.putBucketPolicy(bucketName, policy); err != nil {
+		return err
+	}
+
+	s.logger().Info("DeletePolicyStatements success", "bucket", bucketName, "sid", sid, "removed", count-len(policy.Statement))
+	return nil
+}
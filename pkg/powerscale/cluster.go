@@ -0,0 +1,88 @@
+package powerscale
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+)
+
+// GetClusterConfig returns the configuration of the cluster. Any
+// authenticated user can read it, which makes it a cheap API check.
+func (s *Server) GetClusterConfig() (*ClusterConfig, error) {
+	url := fmt.Sprintf("%s/platform/14/cluster/config", s.apiEndpoint)
+	var config ClusterConfig
+	if err := s.getJSON(url, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// GetZone returns the access zone of the driver, or nil if it does not exist.
+func (s *Server) GetZone() (*Zone, error) {
+	url := fmt.Sprintf("%s/platform/14/zones/%s", s.apiEndpoint, neturl.PathEscape(s.zone))
+	var zoneList ZoneList
+	err := s.getJSON(url, &zoneList)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(zoneList.Zones) == 0 {
+		return nil, nil
+	}
+	return zoneList.Zones[0], nil
+}
+
+// GetS3Settings returns the global S3 settings of the cluster.
+func (s *Server) GetS3Settings() (*S3Settings, error) {
+	url := fmt.Sprintf("%s/platform/14/protocols/s3/settings/global", s.apiEndpoint)
+	var settings S3GlobalSettings
+	if err := s.getJSON(url, &settings); err != nil {
+		return nil, err
+	}
+	return &settings.Settings, nil
+}
+
+// GetS3ZoneSettings returns the S3 settings of the access zone of the driver.
+func (s *Server) GetS3ZoneSettings() (*S3ZoneSettings, error) {
+	url := fmt.Sprintf("%s/platform/14/protocols/s3/settings/zone?zone=%s", s.apiEndpoint, s.zone)
+	var settings S3ZoneSettingsResponse
+	if err := s.getJSON(url, &settings); err != nil {
+		return nil, err
+	}
+	return &settings.Settings, nil
+}
+
+// GetAuthID returns the identity and the privileges of the API user.
+func (s *Server) GetAuthID() (*AuthID, error) {
+	url := fmt.Sprintf("%s/platform/14/auth/id?zone=%s", s.apiEndpoint, s.zone)
+	var id AuthIDResponse
+	if err := s.getJSON(url, &id); err != nil {
+		return nil, err
+	}
+	return &id.NToken, nil
+}
+
+// DirectoryExists reports whether a directory exists in the namespace.
+func (s *Server) DirectoryExists(path string) (bool, error) {
+	req, err := http.NewRequest(http.MethodHead, s.namespaceURL(path), nil)
+	if err != nil {
+		return false, err
+	}
+	s.basicAuth(req)
+	resp, err := s.do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 404 {
+		return false, nil
+	}
+	if resp.StatusCode > 299 {
+		return false, &StatusError{StatusCode: resp.StatusCode}
+	}
+	return true, nil
+}
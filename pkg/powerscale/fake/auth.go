@@ -0,0 +1,234 @@
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+)
+
+type group struct {
+	name string
+	// Names of the member users, in order of addition.
+	members []string
+}
+
+// AddUser adds a user to the cluster, e.g. a user of an external provider
+// such as `lsa-activedirectory-provider:CORP.EXAMPLE.COM`. The user belongs
+// to the local provider when its provider is empty.
+func (s *Server) AddUser(user powerscale.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user.Provider == "" {
+		user.Provider = LocalProvider
+	}
+	s.users[user.Name] = &user
+}
+
+// User returns a copy of a user, or nil.
+func (s *Server) User(name string) *powerscale.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[name]
+	if !ok {
+		return nil
+	}
+	copied := *user
+	return &copied
+}
+
+// GroupMembers returns the names of the members of a group, or nil when the
+// group does not exist.
+func (s *Server) GroupMembers(name string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.groups[name]
+	if !ok {
+		return nil
+	}
+	return append([]string{}, g.members...)
+}
+
+func userNotFound(name string) *apiError {
+	return notFound("Failed to find user for 'USER:%s': No such user", name)
+}
+
+func (s *Server) listUsers(r *request) (int, any, *apiError) {
+	query, offset, err := listQuery(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	users := []*powerscale.User{}
+	for _, user := range s.users {
+		if provider := query.Get("provider"); provider == "" || provider == user.Provider {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	page, resume, err := paginate(users, query, offset)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, &powerscale.UserList{Users: page, Total: len(users), Resume: resume}, nil
+}
+
+func (s *Server) getUser(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	user, ok := s.users[r.params[0]]
+	if !ok {
+		return 0, nil, userNotFound(r.params[0])
+	}
+	if provider := r.query.Get("provider"); provider != "" && provider != user.Provider {
+		return 0, nil, userNotFound(r.params[0])
+	}
+	return http.StatusOK, &powerscale.UserList{Users: []*powerscale.User{user}, Total: 1}, nil
+}
+
+func (s *Server) createUser(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	var user powerscale.User
+	if err := decode(r.Request, &user); err != nil {
+		return 0, nil, err
+	}
+	if user.Name == "" {
+		return 0, nil, badRequest("Field: name required")
+	}
+	if _, ok := s.users[user.Name]; ok {
+		return 0, nil, conflict("User '%s' already exists", user.Name)
+	}
+	user.Provider = LocalProvider
+	s.users[user.Name] = &user
+	return http.StatusCreated, map[string]string{"id": fmt.Sprintf("SID:S-1-5-21-1000-%d", s.newID())}, nil
+}
+
+func (s *Server) deleteUser(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	name := r.params[0]
+	user, ok := s.users[name]
+	if !ok {
+		return 0, nil, userNotFound(name)
+	}
+	if user.Provider != LocalProvider {
+		return 0, nil, badRequest("Cannot delete user '%s' of provider %s", name, user.Provider)
+	}
+	delete(s.users, name)
+	delete(s.keys, name)
+	for _, g := range s.groups {
+		g.members = slices.DeleteFunc(g.members, func(member string) bool { return member == name })
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+func (s *Server) getGroup(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	g, ok := s.groups[r.params[0]]
+	if !ok {
+		return 0, nil, notFound("Failed to find group for 'GROUP:%s': No such group", r.params[0])
+	}
+	return http.StatusOK, &powerscale.GroupList{Groups: []*powerscale.Group{{Name: g.name}}, Total: 1}, nil
+}
+
+func (s *Server) createGroup(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	var body powerscale.Group
+	if err := decode(r.Request, &body); err != nil {
+		return 0, nil, err
+	}
+	if body.Name == "" {
+		return 0, nil, badRequest("Field: name required")
+	}
+	if _, ok := s.groups[body.Name]; ok {
+		return 0, nil, conflict("Group '%s' already exists", body.Name)
+	}
+	s.groups[body.Name] = &group{name: body.Name}
+	return http.StatusCreated, map[string]string{"id": fmt.Sprintf("SID:S-1-5-21-1000-%d", s.newID())}, nil
+}
+
+func (s *Server) deleteGroup(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	if _, ok := s.groups[r.params[0]]; !ok {
+		return 0, nil, notFound("Failed to find group for 'GROUP:%s': No such group", r.params[0])
+	}
+	delete(s.groups, r.params[0])
+	return http.StatusNoContent, nil, nil
+}
+
+func (s *Server) listMembers(r *request) (int, any, *apiError) {
+	query, offset, err := listQuery(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	g, ok := s.groups[r.params[0]]
+	if !ok {
+		return 0, nil, notFound("Failed to find group for 'GROUP:%s': No such group", r.params[0])
+	}
+	members := []*powerscale.Member{}
+	for _, name := range g.members {
+		members = append(members, &powerscale.Member{Name: name, Type: powerscale.GranteeUser})
+	}
+	page, resume, err := paginate(members, query, offset)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, &powerscale.MemberList{Members: page, Total: len(members), Resume: resume}, nil
+}
+
+func (s *Server) addMember(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	g, ok := s.groups[r.params[0]]
+	if !ok {
+		return 0, nil, notFound("Failed to find group for 'GROUP:%s': No such group", r.params[0])
+	}
+	var member powerscale.Member
+	if err := decode(r.Request, &member); err != nil {
+		return 0, nil, err
+	}
+	if member.Type != powerscale.GranteeUser {
+		return 0, nil, badRequest("Unsupported member type '%s'", member.Type)
+	}
+	if _, ok := s.users[member.Name]; !ok {
+		return 0, nil, userNotFound(member.Name)
+	}
+	if slices.Contains(g.members, member.Name) {
+		return 0, nil, conflict("User '%s' is already a member of group '%s'", member.Name, g.name)
+	}
+	g.members = append(g.members, member.Name)
+	return http.StatusCreated, map[string]string{"id": "UID:" + member.Name}, nil
+}
+
+func (s *Server) removeMember(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	g, ok := s.groups[r.params[0]]
+	if !ok {
+		return 0, nil, notFound("Failed to find group for 'GROUP:%s': No such group", r.params[0])
+	}
+	name, ok := strings.CutPrefix(r.params[1], "USER:")
+	if !ok {
+		return 0, nil, badRequest("Invalid member '%s'", r.params[1])
+	}
+	i := slices.Index(g.members, name)
+	if i < 0 {
+		return 0, nil, notFound("User '%s' is not a member of group '%s'", name, g.name)
+	}
+	g.members = slices.Delete(g.members, i, i+1)
+	return http.StatusNoContent, nil, nil
+}
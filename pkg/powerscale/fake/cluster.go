@@ -0,0 +1,50 @@
+package fake
+
+import (
+	"net/http"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+)
+
+// Privileges of the API user.
+var Privileges = []string{
+	"ISI_PRIV_S3",
+	"ISI_PRIV_AUTH",
+	"ISI_PRIV_NS_IFS_ACCESS",
+	"ISI_PRIV_QUOTA",
+	"ISI_PRIV_SNAPSHOT",
+}
+
+func (s *Server) getClusterConfig(r *request) (int, any, *apiError) {
+	return http.StatusOK, &powerscale.ClusterConfig{
+		Name:         ClusterName,
+		OnefsVersion: powerscale.OnefsVersion{Release: Release},
+	}, nil
+}
+
+func (s *Server) getZone(r *request) (int, any, *apiError) {
+	if r.params[0] != Zone {
+		return 0, nil, notFound("Zone '%s' not found", r.params[0])
+	}
+	return http.StatusOK, &powerscale.ZoneList{Zones: []*powerscale.Zone{{Name: Zone, Path: ZonePath}}}, nil
+}
+
+func (s *Server) getAuthID(r *request) (int, any, *apiError) {
+	id := powerscale.AuthIDResponse{NToken: powerscale.AuthID{User: powerscale.AuthPersona{Name: s.username}}}
+	for _, privilege := range Privileges {
+		id.NToken.Privileges = append(id.NToken.Privileges, powerscale.Privilege{ID: privilege, Name: privilege})
+	}
+	return http.StatusOK, &id, nil
+}
+
+func (s *Server) getS3Settings(r *request) (int, any, *apiError) {
+	return http.StatusOK, &powerscale.S3GlobalSettings{Settings: powerscale.S3Settings{Service: true, HTTPSOnly: true}}, nil
+}
+
+func (s *Server) getS3ZoneSettings(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	service := true
+	return http.StatusOK, &powerscale.S3ZoneSettingsResponse{Settings: powerscale.S3ZoneSettings{RootPath: ZonePath, Service: &service}}, nil
+}
@@ -0,0 +1,355 @@
+// Package fake is an in-memory OneFS API server for the tests. It implements
+// the subset of the platform and namespace APIs used by the driver, with the
+// status codes and error bodies of OneFS, and injects faults on demand:
+//
+//	server := fake.NewServer()
+//	defer server.Close()
+//	client := powerscale.New(server.Config())
+//	server.Inject(fake.Fault{Method: http.MethodPost, Path: "/platform/14/protocols/s3/keys/", StatusCode: 503})
+package fake
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/japannext/cosi-powerscale/pkg/config"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+)
+
+// Defaults of the fake cluster.
+const (
+	Username    = "cosi"
+	Password    = "fake-password"
+	ClusterName = "fake-cluster"
+	Release     = "9.5.0.0"
+	Zone        = "System"
+	ZonePath    = "/ifs"
+	BasePath    = "/ifs/data/cosi"
+	// Provider of the users created through the API.
+	LocalProvider = "lsa-local-provider:" + Zone
+)
+
+// Server is a fake OneFS cluster with a single access zone, served by an
+// httptest.Server. Its state is shared by all the clients.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	username string
+	password string
+	users    map[string]*powerscale.User
+	groups   map[string]*group
+	keys     map[string]*powerscale.Key
+	buckets  map[string]*bucket
+	nodes    map[string]*node
+	quotas   map[string]*powerscale.Quota
+	snaps    map[string]*Snapshot
+	faults   []*Fault
+	requests []string
+	nextID   int
+}
+
+// NewServer starts a fake cluster, with the base path of Config created.
+func NewServer() *Server {
+	s := &Server{
+		username: Username,
+		password: Password,
+		users:    make(map[string]*powerscale.User),
+		groups:   make(map[string]*group),
+		keys:     make(map[string]*powerscale.Key),
+		buckets:  make(map[string]*bucket),
+		nodes:    map[string]*node{ZonePath: newDirectory()},
+		quotas:   make(map[string]*powerscale.Quota),
+		snaps:    make(map[string]*Snapshot),
+	}
+	s.mkdirAll(BasePath)
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Config returns a driver configuration targeting the fake cluster.
+func (s *Server) Config() *config.Config {
+	return &config.Config{
+		Name:        "fake",
+		ApiEndpoint: s.URL,
+		ApiUsername: Username,
+		ApiPassword: Password,
+		S3Endpoint:  "https://s3.fake.example.com:9021",
+		Zone:        Zone,
+		BasePath:    BasePath,
+	}
+}
+
+// SetCredentials changes the credentials accepted by the API, e.g. to test
+// their rotation.
+func (s *Server) SetCredentials(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.username, s.password = username, password
+}
+
+// Requests returns the requests received so far, as `METHOD /path`.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// apiError is an error of the OneFS API.
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func notFound(format string, args ...any) *apiError {
+	return &apiError{http.StatusNotFound, "AEC_NOT_FOUND", fmt.Sprintf(format, args...)}
+}
+
+func conflict(format string, args ...any) *apiError {
+	return &apiError{http.StatusConflict, "AEC_CONFLICT", fmt.Sprintf(format, args...)}
+}
+
+func badRequest(format string, args ...any) *apiError {
+	return &apiError{http.StatusBadRequest, "AEC_BAD_REQUEST", fmt.Sprintf(format, args...)}
+}
+
+// errorBody is the body of the OneFS API errors.
+type errorBody struct {
+	Errors []errorEntry `json:"errors"`
+}
+
+type errorEntry struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, err *apiError) {
+	writeJSON(w, err.status, errorBody{Errors: []errorEntry{{Code: err.code, Message: err.message}}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// decode reads the JSON body of a request.
+func decode(r *http.Request, v any) *apiError {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return badRequest("Invalid JSON in request body: %v", err)
+	}
+	return nil
+}
+
+// handler serves a request of the API, with the lock of the server held.
+// A nil body is sent as an empty response, a []byte body as is.
+type handler func(r *request) (status int, body any, err *apiError)
+
+// request is a request of the API, with the parameters of its route.
+type request struct {
+	*http.Request
+	params []string
+	query  neturl.Values
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	fault := s.fault(r)
+	s.mu.Unlock()
+
+	if fault != nil {
+		if !fault.apply(w, r) {
+			return
+		}
+		if fault.MalformedJSON {
+			rec := httptest.NewRecorder()
+			s.serveAPI(rec, r)
+			for name, values := range rec.Header() {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(rec.Code)
+			body := rec.Body.Bytes()
+			w.Write(body[:len(body)/2])
+			return
+		}
+	}
+	s.serveAPI(w, r)
+}
+
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.authenticated(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="isi_papi"`)
+		writeError(w, &apiError{http.StatusUnauthorized, "AEC_UNAUTHORIZED", "Authorization required"})
+		return
+	}
+
+	h, req, err := s.route(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	status, body, err := h(req)
+	switch {
+	case err != nil:
+		writeError(w, err)
+	case body == nil:
+		w.WriteHeader(status)
+	default:
+		if data, ok := body.([]byte); ok {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.WriteHeader(status)
+			w.Write(data)
+			return
+		}
+		writeJSON(w, status, body)
+	}
+}
+
+func (s *Server) authenticated(r *http.Request) bool {
+	username, password, ok := r.BasicAuth()
+	return ok &&
+		subtle.ConstantTimeCompare([]byte(username), []byte(s.username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) == 1
+}
+
+// route returns the handler of a request of the platform or namespace API.
+func (s *Server) route(r *http.Request) (handler, *request, *apiError) {
+	req := &request{Request: r, query: r.URL.Query()}
+	if path, ok := strings.CutPrefix(r.URL.Path, "/namespace/"); ok {
+		req.params = []string{"/" + strings.TrimSuffix(path, "/")}
+		return s.namespace, req, nil
+	}
+
+	rest, ok := strings.CutPrefix(r.URL.EscapedPath(), "/platform/")
+	if !ok {
+		return nil, nil, notFound("Path not found: %s", r.URL.Path)
+	}
+	version, rest, _ := strings.Cut(rest, "/")
+	v, err := strconv.Atoi(version)
+	if err != nil {
+		return nil, nil, notFound("Path not found: %s", r.URL.Path)
+	}
+	segments := strings.Split(strings.TrimSuffix(rest, "/"), "/")
+	for i, segment := range segments {
+		if unescaped, err := neturl.PathUnescape(segment); err == nil {
+			segments[i] = unescaped
+		}
+	}
+
+	for _, route := range s.routes() {
+		if route.method != r.Method || v < route.minVersion {
+			continue
+		}
+		if params, ok := match(route.pattern, segments); ok {
+			req.params = params
+			return route.handler, req, nil
+		}
+	}
+	return nil, nil, notFound("Path not found: %s", r.URL.Path)
+}
+
+type route struct {
+	method string
+	// Segments of the path after the version, `*` matching any segment.
+	pattern string
+	// Oldest version of the platform API exposing the route.
+	minVersion int
+	handler    handler
+}
+
+func (s *Server) routes() []route {
+	return []route{
+		{http.MethodGet, "cluster/config", 1, s.getClusterConfig},
+		{http.MethodGet, "zones/*", 1, s.getZone},
+		{http.MethodGet, "auth/id", 1, s.getAuthID},
+		{http.MethodGet, "protocols/s3/settings/global", 1, s.getS3Settings},
+		{http.MethodGet, "protocols/s3/settings/zone", 1, s.getS3ZoneSettings},
+
+		{http.MethodGet, "auth/users", 1, s.listUsers},
+		{http.MethodPost, "auth/users", 1, s.createUser},
+		{http.MethodGet, "auth/users/*", 1, s.getUser},
+		{http.MethodDelete, "auth/users/*", 1, s.deleteUser},
+		{http.MethodPost, "auth/groups", 1, s.createGroup},
+		{http.MethodGet, "auth/groups/*", 1, s.getGroup},
+		{http.MethodDelete, "auth/groups/*", 1, s.deleteGroup},
+		{http.MethodGet, "auth/groups/*/members", 1, s.listMembers},
+		{http.MethodPost, "auth/groups/*/members", 1, s.addMember},
+		{http.MethodDelete, "auth/groups/*/members/*", 1, s.removeMember},
+
+		{http.MethodGet, "protocols/s3/buckets", 1, s.listBuckets},
+		{http.MethodPost, "protocols/s3/buckets", 1, s.createBucket},
+		{http.MethodGet, "protocols/s3/buckets/*", 1, s.getBucket},
+		{http.MethodPut, "protocols/s3/buckets/*", 1, s.updateBucket},
+		{http.MethodDelete, "protocols/s3/buckets/*", 1, s.deleteBucket},
+		{http.MethodGet, "protocols/s3/buckets/*/policy", 17, s.getBucketPolicy},
+		{http.MethodPut, "protocols/s3/buckets/*/policy", 17, s.putBucketPolicy},
+		{http.MethodDelete, "protocols/s3/buckets/*/policy", 17, s.deleteBucketPolicy},
+		{http.MethodGet, "protocols/s3/keys/*", 1, s.getKey},
+		{http.MethodPost, "protocols/s3/keys/*", 1, s.createKey},
+		{http.MethodDelete, "protocols/s3/keys/*", 1, s.deleteKey},
+
+		{http.MethodGet, "quota/quotas", 1, s.listQuotas},
+		{http.MethodPost, "quota/quotas", 1, s.createQuota},
+		{http.MethodGet, "quota/quotas/*", 1, s.getQuota},
+		{http.MethodDelete, "quota/quotas/*", 1, s.deleteQuota},
+
+		{http.MethodGet, "snapshot/snapshots", 1, s.listSnapshots},
+		{http.MethodPost, "snapshot/snapshots", 1, s.createSnapshot},
+		{http.MethodGet, "snapshot/snapshots/*", 1, s.getSnapshot},
+		{http.MethodDelete, "snapshot/snapshots/*", 1, s.deleteSnapshot},
+	}
+}
+
+// match returns the segments matching the wildcards of the pattern.
+func match(pattern string, segments []string) ([]string, bool) {
+	parts := strings.Split(pattern, "/")
+	if len(parts) != len(segments) {
+		return nil, false
+	}
+	var params []string
+	for i, part := range parts {
+		switch {
+		case part == "*" && segments[i] != "":
+			params = append(params, segments[i])
+		case part != segments[i]:
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// checkZone rejects the requests of another access zone.
+func checkZone(r *request) *apiError {
+	if zone := r.query.Get("zone"); zone != "" && zone != Zone {
+		return notFound("Zone '%s' not found", zone)
+	}
+	return nil
+}
+
+// newID returns a unique ID of an object of the cluster.
+func (s *Server) newID() int {
+	s.nextID++
+	return s.nextID
+}
+
+// now is the time of the cluster, in Unix seconds.
+func now() int64 {
+	return time.Now().Unix()
+}
@@ -0,0 +1,422 @@
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+)
+
+func newClient(t *testing.T) (*Server, *powerscale.Server) {
+	t.Helper()
+	server := NewServer()
+	t.Cleanup(server.Close)
+	return server, powerscale.New(server.Config())
+}
+
+// statusCode returns the status code of a *powerscale.StatusError, or 0.
+func statusCode(err error) int {
+	var statusErr *powerscale.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+func TestBuckets(t *testing.T) {
+	server, client := newClient(t)
+	owner := client.NewOwnership("1234", "default", "claim")
+
+	if err := client.CreateBucket("bucket-1", owner); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateBucket("bucket-1", owner); statusCode(err) != http.StatusConflict {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+	if err := client.CreateBucket("Invalid_Name", owner); statusCode(err) != http.StatusBadRequest {
+		t.Errorf("expected a bad request, got %v", err)
+	}
+
+	bucket, err := client.GetBucket("bucket-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bucket == nil || bucket.Path != BasePath+"/bucket-1" || bucket.Ownership().ClaimName != "claim" {
+		t.Fatalf("unexpected bucket %+v", bucket)
+	}
+	marker, err := client.GetDirectoryOwnership(bucket.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marker == nil || marker.UID != "1234" {
+		t.Errorf("unexpected directory ownership %+v", marker)
+	}
+
+	grantee := powerscale.AclUser{Type: powerscale.GranteeUser, Name: "user-1"}
+	if err := client.EnsureACL("bucket-1", grantee, "FULL_CONTROL"); statusCode(err) != http.StatusBadRequest {
+		t.Errorf("expected the unknown grantee to be rejected, got %v", err)
+	}
+	if err := client.CreateUser("user-1", owner); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.EnsureACL("bucket-1", grantee, "FULL_CONTROL"); err != nil {
+		t.Fatal(err)
+	}
+	if acl := server.Bucket("bucket-1").Acl; len(acl) != 1 || acl[0].Grantee.Name != "user-1" {
+		t.Errorf("unexpected ACL %+v", acl)
+	}
+	if err := client.DeleteACL("bucket-1", grantee); err != nil {
+		t.Fatal(err)
+	}
+	if acl := server.Bucket("bucket-1").Acl; len(acl) != 0 {
+		t.Errorf("unexpected ACL %+v", acl)
+	}
+
+	statements := powerscale.NewPolicyStatements("grant1", "bucket-1", "user-1", "", powerscale.StringList{"s3:GetObject"})
+	if err := client.EnsurePolicyStatements("bucket-1", statements...); err != nil {
+		t.Fatal(err)
+	}
+	if policy := server.BucketPolicy("bucket-1"); policy == nil || len(policy.Statement) != 1 {
+		t.Errorf("unexpected policy %+v", policy)
+	}
+	if err := client.DeletePolicyStatements("bucket-1", "grant1"); err != nil {
+		t.Fatal(err)
+	}
+	if policy := server.BucketPolicy("bucket-1"); policy != nil {
+		t.Errorf("expected the policy to be deleted, got %+v", policy)
+	}
+
+	if err := client.DeleteBucket("bucket-1"); err != nil {
+		t.Fatal(err)
+	}
+	if !server.Exists(BasePath + "/bucket-1") {
+		t.Error("the directory of a deleted bucket must be kept")
+	}
+	if err := client.DeleteDirectoryForBucket("bucket-1"); err != nil {
+		t.Fatal(err)
+	}
+	if server.Exists(BasePath + "/bucket-1") {
+		t.Error("the directory of the bucket must be deleted")
+	}
+	if bucket, err := client.GetBucket("bucket-1"); err != nil || bucket != nil {
+		t.Errorf("expected no bucket, got %+v, %v", bucket, err)
+	}
+	// Deleting missing objects is a no-op for the client.
+	if err := client.DeleteBucket("bucket-1"); err != nil {
+		t.Error(err)
+	}
+	if err := client.DeleteDirectoryForBucket("bucket-1"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUsersAndKeys(t *testing.T) {
+	server, client := newClient(t)
+	owner := client.NewOwnership("1234", "default", "claim")
+
+	if user, err := client.GetUser("user-1"); err != nil || user != nil {
+		t.Fatalf("expected no user, got %+v, %v", user, err)
+	}
+	if _, err := client.RotateKey("user-1", 0); statusCode(err) != http.StatusNotFound {
+		t.Errorf("expected the key of an unknown user to fail, got %v", err)
+	}
+	if err := client.CreateUser("user-1", owner); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateUser("user-1", owner); statusCode(err) != http.StatusConflict {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+	user, err := client.GetUser("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.IsLocal() || !client.Owns(user.Ownership()) {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	server.AddUser(powerscale.User{Name: "ad-user", Enabled: true, Provider: "lsa-activedirectory-provider:CORP.EXAMPLE.COM"})
+	if user, err := client.FindUser("ad-user", LocalProvider); err != nil || user != nil {
+		t.Errorf("expected no user in the local provider, got %+v, %v", user, err)
+	}
+	if user, err := client.FindUser("ad-user", "lsa-activedirectory-provider:CORP.EXAMPLE.COM"); err != nil || user == nil || user.IsLocal() {
+		t.Errorf("expected the external user, got %+v, %v", user, err)
+	}
+
+	if key, err := client.GetKey("user-1"); err != nil || key != nil {
+		t.Fatalf("expected no key, got %+v, %v", key, err)
+	}
+	first, err := client.RotateKey("user-1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.AccessID == "" || first.SecretKey == "" || first.OldKeyExpiry != 0 {
+		t.Errorf("unexpected key %+v", first)
+	}
+	second, err := client.RotateKey("user-1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.AccessID == first.AccessID || second.OldKeyExpiry < time.Now().Add(59*time.Minute).Unix() {
+		t.Errorf("unexpected rotated key %+v", second)
+	}
+	key, err := client.GetKey("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key == nil || key.SecretKey != second.SecretKey {
+		t.Errorf("expected the rotated key, got %+v", key)
+	}
+
+	if err := client.DeleteKey("user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if server.Key("user-1") != nil {
+		t.Error("the key must be deleted")
+	}
+	if err := client.DeleteUser("user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if server.User("user-1") != nil {
+		t.Error("the user must be deleted")
+	}
+	if err := client.DeleteUser("user-1"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	server, client := newClient(t)
+	if err := client.CreateUser("user-1", client.NewOwnership("", "", "")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AddGroupMember("group-1", "user-1"); statusCode(err) != http.StatusNotFound {
+		t.Errorf("expected the unknown group to fail, got %v", err)
+	}
+	if err := client.EnsureGroup("group-1", client.NewOwnership("", "", "")); err != nil {
+		t.Fatal(err)
+	}
+	// Adding a member twice is a conflict, a no-op for the client.
+	for range 2 {
+		if err := client.AddGroupMember("group-1", "user-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	members, err := client.ListGroupMembers("group-1", powerscale.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].Name != "user-1" {
+		t.Errorf("unexpected members %+v", members)
+	}
+	if err := client.RemoveGroupMember("group-1", "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if members := server.GroupMembers("group-1"); len(members) != 0 {
+		t.Errorf("unexpected members %v", members)
+	}
+	if owner, err := client.GetGroupOwnership("group-1"); err != nil || !client.Owns(owner) {
+		t.Errorf("expected the group to be owned, got %+v, %v", owner, err)
+	}
+	if err := client.DeleteGroup("group-1"); err != nil {
+		t.Fatal(err)
+	}
+	if server.GroupMembers("group-1") != nil || server.Exists(BasePath+"/.cosi-groups/group-1") {
+		t.Error("the group and its marker must be deleted")
+	}
+}
+
+func TestPagination(t *testing.T) {
+	_, client := newClient(t)
+	for _, name := range []string{"user-a", "user-b", "user-c", "user-d", "user-e"} {
+		if err := client.CreateUser(name, client.NewOwnership("", "", "")); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.WriteFile(BasePath+"/dir/"+name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	users, err := client.ListUsers(powerscale.ListOptions{PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 5 || users[0].Name != "user-a" || users[4].Name != "user-e" {
+		t.Errorf("unexpected users %+v", users)
+	}
+	entries, err := client.ListDirectory(BasePath+"/dir", powerscale.ListOptions{PageSize: 2, NamePrefix: "user-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 || entries[0].Type != "object" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+}
+
+func TestPlatformResumeAlone(t *testing.T) {
+	server, client := newClient(t)
+	for _, name := range []string{"user-a", "user-b"} {
+		if err := client.CreateUser(name, client.NewOwnership("", "", "")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var page powerscale.UserList
+	if code := get(t, server, "/platform/14/auth/users?limit=1", &page); code != http.StatusOK || page.Resume == "" {
+		t.Fatalf("unexpected first page %d, %+v", code, page)
+	}
+	if code := get(t, server, "/platform/14/auth/users?limit=1&resume="+page.Resume, nil); code != http.StatusBadRequest {
+		t.Errorf("expected the resume token with a query to be rejected, got %d", code)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	server, client := newClient(t)
+	path := BasePath + "/.cosi-identities/user-1.json"
+	if data, err := client.ReadFile(path); err != nil || data != nil {
+		t.Fatalf("expected no file, got %q, %v", data, err)
+	}
+	// The parent directory is created on the first write.
+	if err := client.WriteFile(path, []byte(`{"buckets":["bucket-1"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if data := server.ReadFile(path); string(data) != `{"buckets":["bucket-1"]}` {
+		t.Errorf("unexpected file content %q", data)
+	}
+	if exists, err := client.DirectoryExists(BasePath + "/.cosi-identities"); err != nil || !exists {
+		t.Errorf("expected the directory to exist, got %v, %v", exists, err)
+	}
+	if err := client.DeleteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if server.Exists(path) {
+		t.Error("the file must be deleted")
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	server, client := newClient(t)
+	if err := client.CreateDirectory(BasePath + "/bucket-1"); err != nil {
+		t.Fatal(err)
+	}
+	hard := int64(16)
+	server.SetQuota(BasePath+"/bucket-1", powerscale.QuotaThresholds{Hard: &hard})
+
+	if err := client.WriteFile(BasePath+"/bucket-1/small", []byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	err := client.WriteFile(BasePath+"/bucket-1/large", []byte("0123456789"))
+	if statusCode(err) != http.StatusInsufficientStorage || !strings.Contains(err.Error(), "quota") {
+		t.Errorf("expected the quota to be exceeded, got %v", err)
+	}
+
+	quota, err := client.GetDirectoryQuota(BasePath + "/bucket-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quota == nil || quota.Usage.FSLogical != 10 || *quota.Thresholds.Hard != hard {
+		t.Errorf("unexpected quota %+v", quota)
+	}
+	if quota, err := client.GetDirectoryQuota(BasePath); err != nil || quota != nil {
+		t.Errorf("expected no quota, got %+v, %v", quota, err)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	server, _ := newClient(t)
+	server.WriteFile(BasePath+"/bucket-1/object", []byte("data"))
+
+	var snapshot Snapshot
+	if code := send(t, server, http.MethodPost, "/platform/1/snapshot/snapshots", `{"name":"daily","path":"/ifs/data/cosi/bucket-1"}`, &snapshot); code != http.StatusCreated {
+		t.Fatalf("unexpected status %d", code)
+	}
+	if snapshot.Name != "daily" || snapshot.Size != 4 || snapshot.State != "active" {
+		t.Errorf("unexpected snapshot %+v", snapshot)
+	}
+	if code := send(t, server, http.MethodPost, "/platform/1/snapshot/snapshots", `{"name":"daily","path":"/ifs/data/cosi/bucket-1"}`, nil); code != http.StatusConflict {
+		t.Errorf("expected a conflict, got %d", code)
+	}
+	if code := get(t, server, "/platform/1/snapshot/snapshots/daily", nil); code != http.StatusOK {
+		t.Errorf("unexpected status %d", code)
+	}
+	if code := send(t, server, http.MethodDelete, "/platform/1/snapshot/snapshots/daily", "", nil); code != http.StatusNoContent {
+		t.Errorf("unexpected status %d", code)
+	}
+	if snapshots := server.Snapshots(); len(snapshots) != 0 {
+		t.Errorf("unexpected snapshots %+v", snapshots)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	server, client := newClient(t)
+	if _, err := client.GetClusterConfig(); err != nil {
+		t.Fatal(err)
+	}
+	server.SetCredentials(Username, "rotated")
+	if _, err := client.GetClusterConfig(); statusCode(err) != http.StatusUnauthorized || !strings.Contains(err.Error(), "AEC_UNAUTHORIZED") {
+		t.Errorf("expected the old password to be rejected, got %v", err)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	server, client := newClient(t)
+
+	server.Inject(Fault{Method: http.MethodPost, Path: "/platform/14/auth/users", StatusCode: http.StatusServiceUnavailable, Times: 1})
+	if err := client.CreateUser("user-1", client.NewOwnership("", "", "")); statusCode(err) != http.StatusServiceUnavailable {
+		t.Errorf("expected a 503, got %v", err)
+	}
+	if err := client.CreateUser("user-1", client.NewOwnership("", "", "")); err != nil {
+		t.Errorf("the fault must only apply once: %v", err)
+	}
+
+	server.Inject(Fault{StatusCode: http.StatusUnauthorized, Times: 1})
+	if _, err := client.GetUser("user-1"); statusCode(err) != http.StatusUnauthorized {
+		t.Errorf("expected a 401, got %v", err)
+	}
+
+	server.Inject(Fault{Path: "/platform/14/auth/users/", MalformedJSON: true, Times: 1})
+	var syntaxErr *json.SyntaxError
+	if _, err := client.GetUser("user-1"); !errors.As(err, &syntaxErr) && !strings.Contains(fmt.Sprint(err), "unexpected end of JSON") {
+		t.Errorf("expected a JSON error, got %v", err)
+	}
+
+	server.Inject(Fault{Latency: time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.WithContext(ctx).GetUser("user-1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the request to time out, got %v", err)
+	}
+	server.ClearFaults()
+	if user, err := client.GetUser("user-1"); err != nil || user == nil {
+		t.Errorf("expected the user once the faults are cleared, got %+v, %v", user, err)
+	}
+}
+
+// get sends an authenticated GET request to the fake and decodes its body.
+func get(t *testing.T, server *Server, path string, v any) int {
+	t.Helper()
+	return send(t, server, http.MethodGet, path, "", v)
+}
+
+func send(t *testing.T, server *Server, method, path, body string, v any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth(Username, Password)
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
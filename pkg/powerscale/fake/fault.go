@@ -0,0 +1,115 @@
+package fake
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Fault is injected in the responses of the matching requests, before they
+// reach the API:
+//
+//	// The next key generation fails with a 503.
+//	server.Inject(fake.Fault{Method: http.MethodPost, Path: "/platform/14/protocols/s3/keys/", StatusCode: 503, Times: 1})
+//	// Every request is slowed down.
+//	server.Inject(fake.Fault{Latency: 2 * time.Second})
+type Fault struct {
+	// Method of the requests, empty for any method.
+	Method string
+	// Prefix of the path of the requests, empty for any path.
+	Path string
+	// Number of requests the fault applies to, 0 for all of them.
+	Times int
+	// Latency added before the response, cut short when the request is
+	// cancelled.
+	Latency time.Duration
+	// Status code of the response, instead of the response of the API.
+	StatusCode int
+	// Body of the response of StatusCode, a OneFS error body by default.
+	Body string
+	// MalformedJSON truncates the body of the response of the API.
+	MalformedJSON bool
+}
+
+// Inject adds a fault. The faults are matched in order, the first matching
+// fault applies.
+func (s *Server) Inject(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault)
+}
+
+// ClearFaults removes all the faults.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// fault returns the fault of a request, if any, and consumes it.
+func (s *Server) fault(r *http.Request) *Fault {
+	for i, fault := range s.faults {
+		if fault.Method != "" && fault.Method != r.Method {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, fault.Path) {
+			continue
+		}
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return fault
+	}
+	return nil
+}
+
+// apply waits for the latency of the fault and sends its response. It
+// returns whether the request should still be served by the API.
+func (f *Fault) apply(w http.ResponseWriter, r *http.Request) bool {
+	if f.Latency > 0 {
+		timer := time.NewTimer(f.Latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return false
+		}
+	}
+	if f.StatusCode == 0 {
+		return true
+	}
+	if f.Body != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(f.StatusCode)
+		w.Write([]byte(f.Body))
+		return false
+	}
+	if f.StatusCode == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="isi_papi"`)
+	}
+	writeError(w, &apiError{f.StatusCode, faultCode(f.StatusCode), http.StatusText(f.StatusCode)})
+	return false
+}
+
+// faultCode returns the OneFS error code of a status code.
+func faultCode(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return "AEC_UNAUTHORIZED"
+	case http.StatusForbidden:
+		return "AEC_FORBIDDEN"
+	case http.StatusNotFound:
+		return "AEC_NOT_FOUND"
+	case http.StatusConflict:
+		return "AEC_CONFLICT"
+	case http.StatusServiceUnavailable:
+		return "AEC_SYSTEM_INTERNAL_ERROR"
+	}
+	if status >= 500 {
+		return "AEC_EXCEPTION"
+	}
+	return "AEC_BAD_REQUEST"
+}
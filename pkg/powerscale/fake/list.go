@@ -0,0 +1,72 @@
+package fake
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	neturl "net/url"
+	"strconv"
+)
+
+// resumeToken is the state of a listing, handed out to fetch its next page.
+type resumeToken struct {
+	Query  string `json:"query"`
+	Offset int    `json:"offset"`
+}
+
+func (t resumeToken) String() string {
+	data, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parseResumeToken(text string) (*resumeToken, *apiError) {
+	data, err := base64.RawURLEncoding.DecodeString(text)
+	if err != nil {
+		return nil, badRequest("Invalid resume token")
+	}
+	var token resumeToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, badRequest("Invalid resume token")
+	}
+	return &token, nil
+}
+
+// listQuery returns the query of a platform API listing and the offset of
+// the requested page. As in OneFS, the resume token holds the query of the
+// first request and must be sent alone.
+func listQuery(r *request) (neturl.Values, int, *apiError) {
+	resume := r.query.Get("resume")
+	if resume == "" {
+		return r.query, 0, nil
+	}
+	if len(r.query) > 1 {
+		return nil, 0, badRequest("Resume token and other query arguments are mutually exclusive")
+	}
+	token, err := parseResumeToken(resume)
+	if err != nil {
+		return nil, 0, err
+	}
+	query, parseErr := neturl.ParseQuery(token.Query)
+	if parseErr != nil {
+		return nil, 0, badRequest("Invalid resume token")
+	}
+	return query, token.Offset, nil
+}
+
+// paginate returns the page of the items at offset, of at most the `limit`
+// of the query, and the resume token of the next page.
+func paginate[T any](items []T, query neturl.Values, offset int) ([]T, string, *apiError) {
+	limit := len(items)
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return nil, "", badRequest("Invalid limit %q", value)
+		}
+		limit = n
+	}
+	offset = min(offset, len(items))
+	end := min(offset+limit, len(items))
+	if end == len(items) {
+		return items[offset:end], "", nil
+	}
+	return items[offset:end], resumeToken{Query: query.Encode(), Offset: end}.String(), nil
+}
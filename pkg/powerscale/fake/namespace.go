@@ -0,0 +1,258 @@
+package fake
+
+import (
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+)
+
+// Size of the blocks of the physical usage of the files.
+const blockSize = 8192
+
+// node is a file or a directory of the namespace.
+type node struct {
+	dir  bool
+	data []byte
+	// User extended attributes.
+	attrs map[string]string
+}
+
+func newDirectory() *node {
+	return &node{dir: true, attrs: make(map[string]string)}
+}
+
+// Exists reports whether a file or a directory exists in the namespace.
+func (s *Server) Exists(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.nodes[path]
+	return ok
+}
+
+// ReadFile returns a copy of the content of a file, or nil.
+func (s *Server) ReadFile(path string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.nodes[path]
+	if !ok || n.dir {
+		return nil
+	}
+	return append([]byte{}, n.data...)
+}
+
+// WriteFile creates or replaces a file, creating its parent directories.
+func (s *Server) WriteFile(path string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.mkdirAll(parent(path)); err != nil {
+		panic(err)
+	}
+	s.nodes[path] = &node{data: append([]byte{}, data...), attrs: make(map[string]string)}
+}
+
+func parent(p string) string {
+	return path.Dir(p)
+}
+
+func pathNotFound(p string) *apiError {
+	return notFound("Path not found: %s", p)
+}
+
+// mkdirAll creates a directory and its parents.
+func (s *Server) mkdirAll(p string) *apiError {
+	if p == ZonePath {
+		return nil
+	}
+	if n, ok := s.nodes[p]; ok {
+		if !n.dir {
+			return badRequest("Path '%s' is not a directory", p)
+		}
+		return nil
+	}
+	if err := s.mkdirAll(parent(p)); err != nil {
+		return err
+	}
+	s.nodes[p] = newDirectory()
+	return nil
+}
+
+// children returns the sorted names of the entries of a directory.
+func (s *Server) children(dir string) []string {
+	var names []string
+	for p := range s.nodes {
+		if parent(p) == dir && p != dir {
+			names = append(names, path.Base(p))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// namespace serves the namespace API, `/namespace/<path>`.
+func (s *Server) namespace(r *request) (int, any, *apiError) {
+	p := r.params[0]
+	if path.Clean(p) != p || (p != ZonePath && !strings.HasPrefix(p, ZonePath+"/")) {
+		return 0, nil, pathNotFound(p)
+	}
+	_, metadata := r.query["metadata"]
+
+	switch r.Method {
+	case http.MethodHead:
+		if _, ok := s.nodes[p]; !ok {
+			return 0, nil, pathNotFound(p)
+		}
+		return http.StatusOK, nil, nil
+	case http.MethodGet:
+		if metadata {
+			return s.getMetadata(p)
+		}
+		n, ok := s.nodes[p]
+		if !ok {
+			return 0, nil, pathNotFound(p)
+		}
+		if !n.dir {
+			return http.StatusOK, append([]byte{}, n.data...), nil
+		}
+		return s.listDirectory(r, p)
+	case http.MethodPut:
+		if metadata {
+			return s.putMetadata(r, p)
+		}
+		if r.Header.Get("x-isi-ifs-target-type") == "container" {
+			return s.putDirectory(r, p)
+		}
+		return s.putFile(r, p)
+	case http.MethodDelete:
+		return s.deletePath(r, p)
+	}
+	return 0, nil, &apiError{http.StatusMethodNotAllowed, "AEC_BAD_REQUEST", "Method not allowed"}
+}
+
+func (s *Server) listDirectory(r *request, dir string) (int, any, *apiError) {
+	offset := 0
+	if resume := r.query.Get("resume"); resume != "" {
+		token, err := parseResumeToken(resume)
+		if err != nil {
+			return 0, nil, err
+		}
+		offset = token.Offset
+	}
+	entries := []*powerscale.DirectoryEntry{}
+	for _, name := range s.children(dir) {
+		entry := &powerscale.DirectoryEntry{Name: name}
+		if r.query.Get("detail") != "" {
+			entry.Type = "object"
+			if s.nodes[dir+"/"+name].dir {
+				entry.Type = "container"
+			}
+		}
+		entries = append(entries, entry)
+	}
+	page, resume, err := paginate(entries, r.query, offset)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, &powerscale.DirectoryChildren{Children: page, Resume: resume}, nil
+}
+
+func (s *Server) getMetadata(p string) (int, any, *apiError) {
+	n, ok := s.nodes[p]
+	if !ok {
+		return 0, nil, pathNotFound(p)
+	}
+	metadata := &powerscale.DirectoryMetadata{Attrs: []powerscale.DirectoryAttr{}}
+	for name, value := range n.attrs {
+		metadata.Attrs = append(metadata.Attrs, powerscale.DirectoryAttr{Name: name, Value: value, Namespace: "user"})
+	}
+	sort.Slice(metadata.Attrs, func(i, j int) bool { return metadata.Attrs[i].Name < metadata.Attrs[j].Name })
+	return http.StatusOK, metadata, nil
+}
+
+func (s *Server) putMetadata(r *request, p string) (int, any, *apiError) {
+	n, ok := s.nodes[p]
+	if !ok {
+		return 0, nil, pathNotFound(p)
+	}
+	var metadata powerscale.DirectoryMetadata
+	if err := decode(r.Request, &metadata); err != nil {
+		return 0, nil, err
+	}
+	for _, attr := range metadata.Attrs {
+		if attr.Namespace != "" && attr.Namespace != "user" {
+			return 0, nil, badRequest("Unsupported attribute namespace '%s'", attr.Namespace)
+		}
+		switch attr.Op {
+		case "", "update":
+			n.attrs[attr.Name] = attr.Value
+		case "delete":
+			delete(n.attrs, attr.Name)
+		default:
+			return 0, nil, badRequest("Invalid operation '%s'", attr.Op)
+		}
+	}
+	return http.StatusOK, nil, nil
+}
+
+func (s *Server) putDirectory(r *request, p string) (int, any, *apiError) {
+	if n, ok := s.nodes[p]; ok {
+		if !n.dir {
+			return 0, nil, badRequest("Path '%s' is not a directory", p)
+		}
+		return http.StatusOK, nil, nil
+	}
+	if r.query.Get("recursive") != "true" {
+		if n, ok := s.nodes[parent(p)]; !ok || !n.dir {
+			return 0, nil, pathNotFound(parent(p))
+		}
+	}
+	if err := s.mkdirAll(p); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, nil, nil
+}
+
+func (s *Server) putFile(r *request, p string) (int, any, *apiError) {
+	if n, ok := s.nodes[parent(p)]; !ok || !n.dir {
+		return 0, nil, pathNotFound(parent(p))
+	}
+	previous, ok := s.nodes[p]
+	if ok && previous.dir {
+		return 0, nil, badRequest("Path '%s' is a directory", p)
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return 0, nil, badRequest("Failed to read request body: %v", err)
+	}
+	size := int64(len(data))
+	if previous != nil {
+		size -= int64(len(previous.data))
+	}
+	if err := s.checkQuotas(p, size); err != nil {
+		return 0, nil, err
+	}
+	s.nodes[p] = &node{data: data, attrs: make(map[string]string)}
+	return http.StatusOK, nil, nil
+}
+
+func (s *Server) deletePath(r *request, p string) (int, any, *apiError) {
+	n, ok := s.nodes[p]
+	if !ok {
+		return 0, nil, pathNotFound(p)
+	}
+	if p == ZonePath {
+		return 0, nil, &apiError{http.StatusForbidden, "AEC_FORBIDDEN", "Cannot delete " + ZonePath}
+	}
+	if n.dir && len(s.children(p)) > 0 && r.query.Get("recursive") != "true" {
+		return 0, nil, conflict("Directory not empty: %s", p)
+	}
+	for other := range s.nodes {
+		if other == p || strings.HasPrefix(other, p+"/") {
+			delete(s.nodes, other)
+		}
+	}
+	return http.StatusNoContent, nil, nil
+}
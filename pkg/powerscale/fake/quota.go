@@ -0,0 +1,138 @@
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+)
+
+const directoryQuota = "directory"
+
+// SetQuota adds a directory quota with the given thresholds and returns its
+// ID. The usage of the quotas is the size of the files under their path.
+func (s *Server) SetQuota(path string, thresholds powerscale.QuotaThresholds) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	quota := &powerscale.Quota{ID: s.quotaID(), Path: path, Type: directoryQuota, Thresholds: thresholds}
+	s.quotas[quota.ID] = quota
+	return quota.ID
+}
+
+func (s *Server) quotaID() string {
+	return fmt.Sprintf("AABpAQEAAAAAAAAAAAAAQA%010X", s.newID())
+}
+
+// usage returns the usage of the files under a path.
+func (s *Server) usage(path string) powerscale.QuotaUsage {
+	var usage powerscale.QuotaUsage
+	for p, n := range s.nodes {
+		if p != path && !strings.HasPrefix(p, path+"/") {
+			continue
+		}
+		usage.Inodes++
+		size := int64(len(n.data))
+		usage.FSLogical += size
+		usage.Physical += (size + blockSize - 1) / blockSize * blockSize
+	}
+	return usage
+}
+
+// withUsage returns a copy of a quota, with its current usage.
+func (s *Server) withUsage(quota *powerscale.Quota) *powerscale.Quota {
+	copied := *quota
+	copied.Usage = s.usage(quota.Path)
+	return &copied
+}
+
+// checkQuotas rejects a write growing the files of a path by size bytes
+// beyond the hard threshold of a quota.
+func (s *Server) checkQuotas(path string, size int64) *apiError {
+	if size <= 0 {
+		return nil
+	}
+	for _, quota := range s.quotas {
+		if quota.Thresholds.Hard == nil || !strings.HasPrefix(path, quota.Path+"/") {
+			continue
+		}
+		if s.usage(quota.Path).FSLogical+size > *quota.Thresholds.Hard {
+			return &apiError{http.StatusInsufficientStorage, "AEC_EXCEEDED", fmt.Sprintf("Disk quota exceeded: %s", quota.Path)}
+		}
+	}
+	return nil
+}
+
+func (s *Server) listQuotas(r *request) (int, any, *apiError) {
+	query, offset, err := listQuery(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if zone := query.Get("zone"); zone != "" && zone != Zone {
+		return 0, nil, notFound("Zone '%s' not found", zone)
+	}
+	quotas := []*powerscale.Quota{}
+	for _, quota := range s.quotas {
+		if path := query.Get("path"); path != "" && path != quota.Path {
+			continue
+		}
+		if quotaType := query.Get("type"); quotaType != "" && quotaType != quota.Type {
+			continue
+		}
+		quotas = append(quotas, s.withUsage(quota))
+	}
+	sort.Slice(quotas, func(i, j int) bool { return quotas[i].ID < quotas[j].ID })
+	page, resume, err := paginate(quotas, query, offset)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, &powerscale.QuotaList{Quotas: page, Total: len(quotas), Resume: resume}, nil
+}
+
+// quotaCreate is the body of a quota creation.
+type quotaCreate struct {
+	Path       string                     `json:"path"`
+	Type       string                     `json:"type"`
+	Thresholds powerscale.QuotaThresholds `json:"thresholds"`
+}
+
+func (s *Server) createQuota(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	var body quotaCreate
+	if err := decode(r.Request, &body); err != nil {
+		return 0, nil, err
+	}
+	if body.Type != directoryQuota {
+		return 0, nil, badRequest("Unsupported quota type '%s'", body.Type)
+	}
+	if n, ok := s.nodes[body.Path]; !ok || !n.dir {
+		return 0, nil, badRequest("Path '%s' does not exist or is not a directory", body.Path)
+	}
+	for _, quota := range s.quotas {
+		if quota.Path == body.Path && quota.Type == body.Type {
+			return 0, nil, conflict("Quota already exists for path '%s'", body.Path)
+		}
+	}
+	quota := &powerscale.Quota{ID: s.quotaID(), Path: body.Path, Type: body.Type, Thresholds: body.Thresholds}
+	s.quotas[quota.ID] = quota
+	return http.StatusCreated, map[string]string{"id": quota.ID}, nil
+}
+
+func (s *Server) getQuota(r *request) (int, any, *apiError) {
+	quota, ok := s.quotas[r.params[0]]
+	if !ok {
+		return 0, nil, notFound("Quota '%s' not found", r.params[0])
+	}
+	return http.StatusOK, &powerscale.QuotaList{Quotas: []*powerscale.Quota{s.withUsage(quota)}, Total: 1}, nil
+}
+
+func (s *Server) deleteQuota(r *request) (int, any, *apiError) {
+	if _, ok := s.quotas[r.params[0]]; !ok {
+		return 0, nil, notFound("Quota '%s' not found", r.params[0])
+	}
+	delete(s.quotas, r.params[0])
+	return http.StatusNoContent, nil, nil
+}
@@ -0,0 +1,357 @@
+package fake
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+)
+
+// The naming rules of the S3 buckets.
+var bucketNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// Expiry of the previous key of a user when a key is generated without
+// existing_key_expiry_time.
+const defaultExistingKeyExpiry = 10 * time.Minute
+
+type bucket struct {
+	powerscale.Bucket
+	// Nil when the bucket has no policy.
+	policy *powerscale.BucketPolicy
+}
+
+// Bucket returns a copy of a bucket, or nil.
+func (s *Server) Bucket(name string) *powerscale.Bucket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[name]
+	if !ok {
+		return nil
+	}
+	copied := b.Bucket
+	copied.Acl = slices.Clone(b.Acl)
+	return &copied
+}
+
+// BucketPolicy returns the policy of a bucket, or nil.
+func (s *Server) BucketPolicy(name string) *powerscale.BucketPolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[name]
+	if !ok || b.policy == nil {
+		return nil
+	}
+	copied := *b.policy
+	copied.Statement = slices.Clone(b.policy.Statement)
+	return &copied
+}
+
+// Key returns a copy of the S3 key of a user, or nil.
+func (s *Server) Key(userName string) *powerscale.Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[userName]
+	if !ok {
+		return nil
+	}
+	copied := *k
+	return &copied
+}
+
+func bucketNotFound(name string) *apiError {
+	return notFound("Bucket '%s' not found", name)
+}
+
+// checkACL rejects the ACL entries of unknown users and groups, with a 400:
+// the client reads a 404 as a deleted bucket.
+func (s *Server) checkACL(acls []powerscale.ACL) *apiError {
+	for _, acl := range acls {
+		if acl.Grantee == nil {
+			return badRequest("Field: grantee required")
+		}
+		switch acl.Grantee.Type {
+		case "", powerscale.GranteeUser:
+			if _, ok := s.users[acl.Grantee.Name]; !ok {
+				return badRequest("Failed to find user for 'USER:%s': No such user", acl.Grantee.Name)
+			}
+		case powerscale.GranteeGroup:
+			if _, ok := s.groups[acl.Grantee.Name]; !ok {
+				return badRequest("Failed to find group for 'GROUP:%s': No such group", acl.Grantee.Name)
+			}
+		default:
+			return badRequest("Invalid grantee type '%s'", acl.Grantee.Type)
+		}
+		switch acl.Permission {
+		case "READ", "WRITE", "READ_ACP", "WRITE_ACP", "FULL_CONTROL":
+		default:
+			return badRequest("Invalid permission '%s'", acl.Permission)
+		}
+	}
+	return nil
+}
+
+func (s *Server) listBuckets(r *request) (int, any, *apiError) {
+	query, offset, err := listQuery(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	buckets := []*powerscale.Bucket{}
+	for _, b := range s.buckets {
+		buckets = append(buckets, &b.Bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Name < buckets[j].Name })
+	page, resume, err := paginate(buckets, query, offset)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, &powerscale.BucketList{Buckets: page, Total: len(buckets), Resume: resume}, nil
+}
+
+func (s *Server) getBucket(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	b, ok := s.buckets[r.params[0]]
+	if !ok {
+		return 0, nil, bucketNotFound(r.params[0])
+	}
+	return http.StatusOK, &powerscale.BucketList{Buckets: []*powerscale.Bucket{&b.Bucket}, Total: 1}, nil
+}
+
+// AddBucket adds a bucket and its directory to the cluster, e.g. a bucket
+// created by an older release of the driver.
+func (s *Server) AddBucket(b powerscale.Bucket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b.Acl == nil {
+		b.Acl = []powerscale.ACL{}
+	}
+	if _, ok := s.nodes[b.Path]; !ok {
+		_ = s.mkdirAll(b.Path)
+	}
+	s.buckets[b.Name] = &bucket{Bucket: b}
+}
+
+func (s *Server) createBucket(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	var body powerscale.Bucket
+	if err := decode(r.Request, &body); err != nil {
+		return 0, nil, err
+	}
+	if !bucketNameRegexp.MatchString(body.Name) {
+		return 0, nil, badRequest("Invalid bucket name '%s'", body.Name)
+	}
+	if _, ok := s.buckets[body.Name]; ok {
+		return 0, nil, conflict("Bucket name '%s' already in use", body.Name)
+	}
+	if body.Path == "" || path.Clean(body.Path) != body.Path || !strings.HasPrefix(body.Path, ZonePath+"/") {
+		return 0, nil, badRequest("Path '%s' is not within the zone path %s", body.Path, ZonePath)
+	}
+	if body.Acl == nil {
+		body.Acl = []powerscale.ACL{}
+	}
+	if err := s.checkACL(body.Acl); err != nil {
+		return 0, nil, err
+	}
+	if n, ok := s.nodes[body.Path]; !ok {
+		if !body.CreatePath {
+			return 0, nil, badRequest("Path '%s' does not exist", body.Path)
+		}
+		if err := s.mkdirAll(body.Path); err != nil {
+			return 0, nil, err
+		}
+	} else if !n.dir {
+		return 0, nil, badRequest("Path '%s' is not a directory", body.Path)
+	}
+	body.CreatePath = false
+	s.buckets[body.Name] = &bucket{Bucket: body}
+	return http.StatusCreated, map[string]string{"id": body.Name}, nil
+}
+
+// bucketUpdate is the body of a bucket update, nil fields are unchanged.
+type bucketUpdate struct {
+	Acl             *[]powerscale.ACL `json:"acl"`
+	Description     *string           `json:"description"`
+	ObjectACLPolicy *string           `json:"object_acl_policy"`
+}
+
+func (s *Server) updateBucket(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	b, ok := s.buckets[r.params[0]]
+	if !ok {
+		return 0, nil, bucketNotFound(r.params[0])
+	}
+	var update bucketUpdate
+	if err := decode(r.Request, &update); err != nil {
+		return 0, nil, err
+	}
+	if update.Acl != nil {
+		if err := s.checkACL(*update.Acl); err != nil {
+			return 0, nil, err
+		}
+		b.Acl = *update.Acl
+	}
+	if update.Description != nil {
+		b.Description = *update.Description
+	}
+	if update.ObjectACLPolicy != nil {
+		b.ObjectACLPolicy = *update.ObjectACLPolicy
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+// deleteBucket keeps the directory of the bucket, as OneFS does.
+func (s *Server) deleteBucket(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	if _, ok := s.buckets[r.params[0]]; !ok {
+		return 0, nil, bucketNotFound(r.params[0])
+	}
+	delete(s.buckets, r.params[0])
+	return http.StatusNoContent, nil, nil
+}
+
+// getBucketPolicy returns an empty body when the bucket has no policy.
+func (s *Server) getBucketPolicy(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	b, ok := s.buckets[r.params[0]]
+	if !ok {
+		return 0, nil, bucketNotFound(r.params[0])
+	}
+	if b.policy == nil {
+		return http.StatusOK, nil, nil
+	}
+	return http.StatusOK, b.policy, nil
+}
+
+func (s *Server) putBucketPolicy(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	b, ok := s.buckets[r.params[0]]
+	if !ok {
+		return 0, nil, bucketNotFound(r.params[0])
+	}
+	var policy powerscale.BucketPolicy
+	if err := decode(r.Request, &policy); err != nil {
+		return 0, nil, err
+	}
+	if len(policy.Statement) == 0 {
+		return 0, nil, badRequest("Policy has no statement")
+	}
+	for _, statement := range policy.Statement {
+		if len(statement.Principal.AWS) == 0 || len(statement.Action) == 0 || len(statement.Resource) == 0 {
+			return 0, nil, badRequest("Statement '%s' requires a principal, an action and a resource", statement.Sid)
+		}
+		for _, principal := range statement.Principal.AWS {
+			if _, ok := s.users[principal]; !ok && principal != "*" {
+				return 0, nil, badRequest("Invalid principal '%s' in statement '%s'", principal, statement.Sid)
+			}
+		}
+	}
+	b.policy = &policy
+	return http.StatusNoContent, nil, nil
+}
+
+func (s *Server) deleteBucketPolicy(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	b, ok := s.buckets[r.params[0]]
+	if !ok {
+		return 0, nil, bucketNotFound(r.params[0])
+	}
+	if b.policy == nil {
+		return 0, nil, notFound("Bucket '%s' has no policy", b.Name)
+	}
+	b.policy = nil
+	return http.StatusNoContent, nil, nil
+}
+
+// keyResponse returns the key of a user as sent by OneFS, without the expiry
+// of its previous key once expired.
+func keyResponse(k *powerscale.Key) *powerscale.Keys {
+	if k == nil {
+		return &powerscale.Keys{}
+	}
+	keys := &powerscale.Keys{Keys: *k}
+	if keys.Keys.OldKeyExpiry < now() {
+		keys.Keys.OldKeyExpiry = 0
+	}
+	return keys
+}
+
+func (s *Server) getKey(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	if _, ok := s.users[r.params[0]]; !ok {
+		return 0, nil, userNotFound(r.params[0])
+	}
+	return http.StatusOK, keyResponse(s.keys[r.params[0]]), nil
+}
+
+func (s *Server) createKey(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	name := r.params[0]
+	if _, ok := s.users[name]; !ok {
+		return 0, nil, userNotFound(name)
+	}
+	var body powerscale.KeyCreate
+	if r.ContentLength != 0 {
+		if err := decode(r.Request, &body); err != nil {
+			return 0, nil, err
+		}
+	}
+	expiry := defaultExistingKeyExpiry
+	if body.ExistingKeyExpiryTime > 0 {
+		expiry = time.Duration(body.ExistingKeyExpiryTime) * time.Minute
+	}
+
+	secret := make([]byte, 21)
+	if _, err := rand.Read(secret); err != nil {
+		return 0, nil, &apiError{http.StatusInternalServerError, "AEC_EXCEPTION", err.Error()}
+	}
+	k := &powerscale.Key{
+		AccessID:           fmt.Sprintf("%d_%s_accid", s.newID(), name),
+		SecretKey:          base64.StdEncoding.EncodeToString(secret),
+		SecretKeyTimestamp: now(),
+	}
+	if _, ok := s.keys[name]; ok {
+		k.OldKeyExpiry = now() + int64(expiry/time.Second)
+	}
+	s.keys[name] = k
+	return http.StatusOK, keyResponse(k), nil
+}
+
+func (s *Server) deleteKey(r *request) (int, any, *apiError) {
+	if err := checkZone(r); err != nil {
+		return 0, nil, err
+	}
+	name := r.params[0]
+	if _, ok := s.users[name]; !ok {
+		return 0, nil, userNotFound(name)
+	}
+	if _, ok := s.keys[name]; !ok {
+		return 0, nil, notFound("No key found for user '%s'", name)
+	}
+	delete(s.keys, name)
+	return http.StatusNoContent, nil, nil
+}
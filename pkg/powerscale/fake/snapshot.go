@@ -0,0 +1,126 @@
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Snapshot is a SnapshotIQ snapshot of a directory. The driver does not
+// manage snapshots, the model is only part of the fake.
+type Snapshot struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Created int64  `json:"created"`
+	// Unix time of the expiry, 0 when it does not expire.
+	Expires int64  `json:"expires,omitempty"`
+	State   string `json:"state"`
+	// Logical size of the files at the creation of the snapshot.
+	Size int64 `json:"size"`
+}
+
+type snapshotList struct {
+	Snapshots []*Snapshot `json:"snapshots"`
+	Total     int         `json:"total"`
+	Resume    string      `json:"resume,omitempty"`
+}
+
+// snapshotCreate is the body of a snapshot creation.
+type snapshotCreate struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Expires int64  `json:"expires,omitempty"`
+}
+
+// Snapshots returns copies of the snapshots, ordered by ID.
+func (s *Server) Snapshots() []Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshots := make([]Snapshot, 0, len(s.snaps))
+	for _, snapshot := range s.sortedSnapshots() {
+		snapshots = append(snapshots, *snapshot)
+	}
+	return snapshots
+}
+
+func (s *Server) sortedSnapshots() []*Snapshot {
+	snapshots := make([]*Snapshot, 0, len(s.snaps))
+	for _, snapshot := range s.snaps {
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ID < snapshots[j].ID })
+	return snapshots
+}
+
+// snapshot returns a snapshot by ID or by name.
+func (s *Server) snapshot(idOrName string) (*Snapshot, *apiError) {
+	if snapshot, ok := s.snaps[idOrName]; ok {
+		return snapshot, nil
+	}
+	for _, snapshot := range s.snaps {
+		if snapshot.Name == idOrName {
+			return snapshot, nil
+		}
+	}
+	return nil, notFound("Snapshot '%s' not found", idOrName)
+}
+
+func (s *Server) listSnapshots(r *request) (int, any, *apiError) {
+	query, offset, err := listQuery(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	snapshots := s.sortedSnapshots()
+	page, resume, err := paginate(snapshots, query, offset)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, &snapshotList{Snapshots: page, Total: len(snapshots), Resume: resume}, nil
+}
+
+func (s *Server) createSnapshot(r *request) (int, any, *apiError) {
+	var body snapshotCreate
+	if err := decode(r.Request, &body); err != nil {
+		return 0, nil, err
+	}
+	if n, ok := s.nodes[body.Path]; !ok || !n.dir {
+		return 0, nil, badRequest("Path '%s' does not exist or is not a directory", body.Path)
+	}
+	id := s.newID()
+	if body.Name == "" {
+		body.Name = fmt.Sprintf("s%d", id)
+	}
+	if _, err := s.snapshot(body.Name); err == nil {
+		return 0, nil, conflict("Snapshot name '%s' already in use", body.Name)
+	}
+	snapshot := &Snapshot{
+		ID:      id,
+		Name:    body.Name,
+		Path:    body.Path,
+		Created: now(),
+		Expires: body.Expires,
+		State:   "active",
+		Size:    s.usage(body.Path).FSLogical,
+	}
+	s.snaps[strconv.Itoa(id)] = snapshot
+	return http.StatusCreated, snapshot, nil
+}
+
+func (s *Server) getSnapshot(r *request) (int, any, *apiError) {
+	snapshot, err := s.snapshot(r.params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, &snapshotList{Snapshots: []*Snapshot{snapshot}, Total: 1}, nil
+}
+
+func (s *Server) deleteSnapshot(r *request) (int, any, *apiError) {
+	snapshot, err := s.snapshot(r.params[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	delete(s.snaps, strconv.Itoa(snapshot.ID))
+	return http.StatusNoContent, nil, nil
+}
@@ -0,0 +1,220 @@
+package powerscale
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+
+	"github.com/japannext/cosi-powerscale/pkg/audit"
+)
+
+func (s *Server) GetGroup(groupName string) (*Group, error) {
+	url := fmt.Sprintf("%s/platform/14/auth/groups/%s?zone=%s", s.apiEndpoint, neturl.PathEscape(groupName), s.zone)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.basicAuth(req)
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == 404 {
+		return nil, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode > 299 {
+		return nil, newStatusError(resp.StatusCode, body)
+	}
+	var groupList GroupList
+	if err := json.Unmarshal(body, &groupList); err != nil {
+		return nil, err
+	}
+	if len(groupList.Groups) == 0 {
+		return nil, nil
+	}
+	return groupList.Groups[0], nil
+}
+
+// Directory under the base path holding the ownership markers of the groups,
+// one empty file per group: groups have no field to store them.
+const groupMarkersDir = ".cosi-groups"
+
+func (s *Server) groupMarkerPath(groupName string) string {
+	return s.basePath + "/" + groupMarkersDir + "/" + groupName
+}
+
+// GetGroupOwnership returns the ownership marker of a group, or nil if it has
+// none.
+func (s *Server) GetGroupOwnership(groupName string) (*Ownership, error) {
+	return s.GetDirectoryOwnership(s.groupMarkerPath(groupName))
+}
+
+// CreateGroup creates a group, after recording its ownership marker so that a
+// group left behind by a failed creation is still attributed to the driver.
+func (s *Server) CreateGroup(groupName string, owner Ownership) (err error) {
+	defer func() { s.audit(&audit.Record{Operation: "CreateGroup", Group: groupName}, err) }()
+
+	marker := s.groupMarkerPath(groupName)
+	if err := s.WriteFile(marker, nil); err != nil {
+		return err
+	}
+	if err := s.SetDirectoryOwnership(marker, owner); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(&Group{Name: groupName})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/platform/14/auth/groups?zone=%s", s.apiEndpoint, s.zone)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	s.basicAuth(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	// Created by a concurrent grant on the same bucket.
+	if resp.StatusCode == 409 {
+		s.logger().Info("CreateGroup success (already exists)", "groupName", groupName)
+		return nil
+	}
+	if resp.StatusCode > 299 {
+		return newStatusError(resp.StatusCode, body)
+	}
+
+	s.logger().Info("CreateGroup success", "groupName", groupName)
+	return nil
+}
+
+// EnsureGroup creates the group if it does not exist yet.
+func (s *Server) EnsureGroup(groupName string, owner Ownership) error {
+	group, err := s.GetGroup(groupName)
+	if err != nil {
+		return err
+	}
+	if group != nil {
+		return nil
+	}
+	return s.CreateGroup(groupName, owner)
+}
+
+func (s *Server) DeleteGroup(groupName string) (err error) {
+	defer func() { s.audit(&audit.Record{Operation: "DeleteGroup", Group: groupName}, err) }()
+
+	url := fmt.Sprintf("%s/platform/14/auth/groups/%s?zone=%s", s.apiEndpoint, neturl.PathEscape(groupName), s.zone)
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+	s.basicAuth(req)
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == 404 {
+		s.logger().Info("DeleteGroup success (not found)", "groupName", groupName)
+		return nil
+	}
+	if resp.StatusCode > 299 {
+		return newStatusError(resp.StatusCode, body)
+	}
+
+	if err := s.DeleteFile(s.groupMarkerPath(groupName)); err != nil {
+		return err
+	}
+
+	s.logger().Info("DeleteGroup success", "groupName", groupName)
+	return nil
+}
+
+// AddGroupMember adds a user to a group. Adding an existing member is a no-op.
+func (s *Server) AddGroupMember(groupName, userName string) (err error) {
+	defer func() { s.audit(&audit.Record{Operation: "AddGroupMember", Group: groupName, User: userName}, err) }()
+
+	data, err := json.Marshal(&Member{Name: userName, Type: GranteeUser})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/platform/14/auth/groups/%s/members?zone=%s", s.apiEndpoint, neturl.PathEscape(groupName), s.zone)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	s.basicAuth(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == 409 {
+		s.logger().Info("AddGroupMember success (already member)", "groupName", groupName, "userName", userName)
+		return nil
+	}
+	if resp.StatusCode > 299 {
+		return newStatusError(resp.StatusCode, body)
+	}
+
+	s.logger().Info("AddGroupMember success", "groupName", groupName, "userName", userName)
+	return nil
+}
+
+// RemoveGroupMember removes a user from a group. A missing group or member is a no-op.
+func (s *Server) RemoveGroupMember(groupName, userName string) (err error) {
+	defer func() { s.audit(&audit.Record{Operation: "RemoveGroupMember", Group: groupName, User: userName}, err) }()
+
+	url := fmt.Sprintf("%s/platform/14/auth/groups/%s/members/%s?zone=%s",
+		s.apiEndpoint, neturl.PathEscape(groupName), neturl.PathEscape("USER:"+userName), s.zone)
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+	s.basicAuth(req)
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == 404 {
+		s.logger().Info("RemoveGroupMember success (not found)", "groupName", groupName, "userName", userName)
+		return nil
+	}
+	if resp.StatusCode > 299 {
+		return newStatusError(resp.StatusCode, body)
+	}
+
+	s.logger().Info("RemoveGroupMember success", "groupName", groupName, "userName", userName)
+	return nil
+}
@@ -0,0 +1,188 @@
+package powerscale
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// Directory under the base path holding the references of the identities.
+const identityRefsDir = ".cosi-identities"
+
+// IdentityRefs lists the BucketAccesses granted an identity, by bucket. The
+// identity is deleted once no BucketAccess references it anymore. The
+// BucketAccess names are kept instead of a counter, so that retried grants
+// and revokes stay idempotent.
+type IdentityRefs struct {
+	Grants map[string][]string `json:"grants"`
+	// Buckets granted before the BucketAccesses were recorded, released by
+	// the first revoke on the bucket.
+	Buckets []string `json:"buckets,omitempty"`
+	// Ownership marker of the file, also set as its extended attribute.
+	Owner *Ownership `json:"owner,omitempty"`
+}
+
+// IdentityRelease is the outcome of a revoke on a bucket of an identity.
+type IdentityRelease struct {
+	// BucketAccesses whose grant on the bucket is released.
+	BucketAccesses []string
+	// No BucketAccess of the identity is left on the bucket.
+	Bucket bool
+	// No BucketAccess of the identity is left at all.
+	Identity bool
+}
+
+func (s *Server) identityRefsPath(userName string) string {
+	return strings.Join([]string{s.basePath, identityRefsDir, userName + ".json"}, "/")
+}
+
+// GetIdentityRefs returns the references of an identity, or nil if none were
+// recorded.
+func (s *Server) GetIdentityRefs(userName string) (*IdentityRefs, error) {
+	data, err := s.ReadFile(s.identityRefsPath(userName))
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var refs IdentityRefs
+	if err := json.Unmarshal(data, &refs); err != nil {
+		return nil, err
+	}
+	if refs.Grants == nil {
+		refs.Grants = make(map[string][]string)
+	}
+	return &refs, nil
+}
+
+// putIdentityRefs writes the references of an identity with their ownership
+// marker, which keeps its creation time across updates.
+func (s *Server) putIdentityRefs(userName string, refs *IdentityRefs) error {
+	if refs.Owner == nil {
+		owner := s.NewOwnership("", "", "")
+		refs.Owner = &owner
+	}
+	data, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
+	path := s.identityRefsPath(userName)
+	if err := s.WriteFile(path, data); err != nil {
+		return err
+	}
+	return s.SetDirectoryOwnership(path, *refs.Owner)
+}
+
+// AcquireIdentity adds the reference of a BucketAccess on a bucket to an
+// identity. The ensure function creates the user if needed, it is
+// called while holding the lock of the identity so that a concurrent
+// release cannot delete the user.
+func (s *Server) AcquireIdentity(userName, bucketName, bucketAccess string, ensure func() error) error {
+	unlock := s.identityLocks.Lock(userName)
+	defer unlock()
+
+	refs, err := s.GetIdentityRefs(userName)
+	if err != nil {
+		return err
+	}
+	if refs == nil {
+		refs = &IdentityRefs{Grants: make(map[string][]string)}
+	}
+	if !slices.Contains(refs.Grants[bucketName], bucketAccess) {
+		refs.Grants[bucketName] = append(refs.Grants[bucketName], bucketAccess)
+	}
+	// References are recorded before the user is created, so a failed grant
+	// is released by its revoke.
+	if err := s.putIdentityRefs(userName, refs); err != nil {
+		return err
+	}
+	if err := ensure(); err != nil {
+		return err
+	}
+
+	s.logger().Info("AcquireIdentity success", "userName", userName, "bucket", bucketName, "bucketAccess", bucketAccess, "refs", len(refs.Grants[bucketName]))
+	return nil
+}
+
+// ReleaseIdentity removes the references on a bucket of the BucketAccesses
+// which are no longer live, as reported by the live function. The release
+// function revokes their grants, then the references are updated, so that
+// a failed release is retried by the next revoke. It returns false if no
+// references were recorded for the user, in which case nothing is done.
+func (s *Server) ReleaseIdentity(userName, bucketName string, live func(bucketAccess string) (bool, error), release func(*IdentityRelease) error) (bool, error) {
+	unlock := s.identityLocks.Lock(userName)
+	defer unlock()
+
+	refs, err := s.GetIdentityRefs(userName)
+	if err != nil {
+		return false, err
+	}
+	if refs == nil {
+		return false, nil
+	}
+
+	r := &IdentityRelease{}
+	var kept []string
+	for _, bucketAccess := range refs.Grants[bucketName] {
+		ok, err := live(bucketAccess)
+		if err != nil {
+			return true, err
+		}
+		if ok {
+			kept = append(kept, bucketAccess)
+		} else {
+			r.BucketAccesses = append(r.BucketAccesses, bucketAccess)
+		}
+	}
+	if len(kept) > 0 {
+		refs.Grants[bucketName] = kept
+	} else {
+		delete(refs.Grants, bucketName)
+	}
+	refs.Buckets = slices.DeleteFunc(refs.Buckets, func(name string) bool { return name == bucketName })
+	r.Bucket = len(kept) == 0
+	r.Identity = len(refs.Grants) == 0 && len(refs.Buckets) == 0
+
+	if err := release(r); err != nil {
+		return true, err
+	}
+	if !r.Identity {
+		if err := s.putIdentityRefs(userName, refs); err != nil {
+			return true, err
+		}
+		s.logger().Info("ReleaseIdentity success (still referenced)", "userName", userName, "bucket", bucketName, "released", r.BucketAccesses, "bucketRefs", len(kept))
+		return true, nil
+	}
+	if err := s.DeleteFile(s.identityRefsPath(userName)); err != nil {
+		return true, err
+	}
+	s.logger().Info("ReleaseIdentity success (last reference)", "userName", userName, "bucket", bucketName, "released", r.BucketAccesses)
+	return true, nil
+}
+
+// DeleteIdentity deletes a user and, if deleteKey is set, its S3 key. The
+// check function confirms that the user can still be deleted, it is called
+// while holding the lock of the identity so that a concurrent grant cannot
+// reference the user between the check and the deletion. It returns false if
+// the check declined the deletion, in which case nothing is done.
+func (s *Server) DeleteIdentity(userName string, deleteKey bool, check func() (bool, error)) (bool, error) {
+	unlock := s.identityLocks.Lock(userName)
+	defer unlock()
+
+	ok, err := check()
+	if err != nil || !ok {
+		return false, err
+	}
+	if deleteKey {
+		if err := s.DeleteKey(userName); err != nil {
+			return true, err
+		}
+	}
+	if err := s.DeleteUser(userName); err != nil {
+		return true, err
+	}
+
+	s.logger().Info("DeleteIdentity success", "userName", userName, "key", deleteKey)
+	return true, nil
+}
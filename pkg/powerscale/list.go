@@ -0,0 +1,281 @@
+package powerscale
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+// Default number of objects requested per page.
+const listPageSize = 1000
+
+// ListOptions filters the objects returned by a listing. Filters are applied
+// by the client, OneFS does not filter these collections.
+type ListOptions struct {
+	// Only return the objects whose name starts with NamePrefix.
+	NamePrefix string
+	// Only return the buckets and directory entries whose path starts with
+	// PathPrefix.
+	PathPrefix string
+	// Number of objects requested per page, defaults to listPageSize.
+	PageSize int
+}
+
+func (o ListOptions) limit() int {
+	if o.PageSize > 0 {
+		return o.PageSize
+	}
+	return listPageSize
+}
+
+// matchPath reports whether a path is under the path prefix of the options.
+func (o ListOptions) matchPath(path string) bool {
+	prefix := strings.TrimSuffix(o.PathPrefix, "/")
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// fetchPage returns the objects of a page, the total reported by the API
+// and the token of the next page, empty on the last page.
+type fetchPage[T any] func(resume string) (items []T, total int, next string, err error)
+
+// Iterator walks through a listing page per page, following the `resume`
+// tokens of OneFS:
+//
+//	it := s.Buckets(ListOptions{NamePrefix: "team-"})
+//	for it.Next() {
+//		bucket := it.Item()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator[T any] struct {
+	fetch fetchPage[T]
+	match func(T) bool
+
+	page    []T
+	item    T
+	resume  string
+	started bool
+	total   int
+	err     error
+}
+
+func newIterator[T any](fetch fetchPage[T], match func(T) bool) *Iterator[T] {
+	return &Iterator[T]{fetch: fetch, match: match}
+}
+
+// Next advances to the next object, fetching the next page when needed.
+// It returns false at the end of the listing or on error.
+func (it *Iterator[T]) Next() bool {
+	for {
+		for len(it.page) > 0 {
+			it.item, it.page = it.page[0], it.page[1:]
+			if it.match == nil || it.match(it.item) {
+				return true
+			}
+		}
+		if it.err != nil || (it.started && it.resume == "") {
+			return false
+		}
+		var page []T
+		page, it.total, it.resume, it.err = it.fetch(it.resume)
+		it.started = true
+		if it.err != nil {
+			return false
+		}
+		it.page = page
+	}
+}
+
+// Item returns the current object.
+func (it *Iterator[T]) Item() T {
+	return it.item
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// Total returns the number of objects reported by the API, before filtering.
+// It is only known once the first page is fetched, and not all collections
+// report it.
+func (it *Iterator[T]) Total() int {
+	return it.total
+}
+
+// All returns the remaining objects of the listing.
+func (it *Iterator[T]) All() ([]T, error) {
+	var items []T
+	for it.Next() {
+		items = append(items, it.Item())
+	}
+	return items, it.Err()
+}
+
+// getJSON fetches an API URL and decodes its JSON body into v.
+func (s *Server) getJSON(url string, v any) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	s.basicAuth(req)
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode > 299 {
+		return newStatusError(resp.StatusCode, body)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// pageURL returns the URL of a page of a platform API collection. The resume
+// token holds the query of the first request and must be sent alone.
+func pageURL(url string, query neturl.Values, resume string) string {
+	if resume != "" {
+		return url + "?" + neturl.Values{"resume": {resume}}.Encode()
+	}
+	return url + "?" + query.Encode()
+}
+
+// Buckets iterates over the S3 buckets of the zone.
+func (s *Server) Buckets(opts ListOptions) *Iterator[*Bucket] {
+	url := fmt.Sprintf("%s/platform/14/protocols/s3/buckets", s.apiEndpoint)
+	query := neturl.Values{"zone": {s.zone}, "limit": {fmt.Sprint(opts.limit())}}
+	return newIterator(func(resume string) ([]*Bucket, int, string, error) {
+		var bucketList BucketList
+		if err := s.getJSON(pageURL(url, query, resume), &bucketList); err != nil {
+			return nil, 0, "", err
+		}
+		return bucketList.Buckets, bucketList.Total, bucketList.Resume, nil
+	}, func(bucket *Bucket) bool {
+		return strings.HasPrefix(bucket.Name, opts.NamePrefix) && opts.matchPath(bucket.Path)
+	})
+}
+
+// ListBuckets returns the S3 buckets of the zone.
+func (s *Server) ListBuckets(opts ListOptions) ([]*Bucket, error) {
+	return s.Buckets(opts).All()
+}
+
+// userPages fetches the pages of the users of the local provider of the zone.
+func (s *Server) userPages(opts ListOptions) fetchPage[*User] {
+	url := fmt.Sprintf("%s/platform/14/auth/users", s.apiEndpoint)
+	query := neturl.Values{
+		"zone":     {s.zone},
+		"provider": {localProviderPrefix + ":" + s.zone},
+		"limit":    {fmt.Sprint(opts.limit())},
+	}
+	return func(resume string) ([]*User, int, string, error) {
+		var userList UserList
+		if err := s.getJSON(pageURL(url, query, resume), &userList); err != nil {
+			return nil, 0, "", err
+		}
+		return userList.Users, userList.Total, userList.Resume, nil
+	}
+}
+
+// Users iterates over the users of the local provider of the zone.
+func (s *Server) Users(opts ListOptions) *Iterator[*User] {
+	return newIterator(s.userPages(opts), func(user *User) bool {
+		return strings.HasPrefix(user.Name, opts.NamePrefix)
+	})
+}
+
+// ListUsers returns the users of the local provider of the zone.
+func (s *Server) ListUsers(opts ListOptions) ([]*User, error) {
+	return s.Users(opts).All()
+}
+
+// UserKey is the S3 key of a user.
+type UserKey struct {
+	User string
+	Key  *Key
+}
+
+// Keys iterates over the S3 keys of the users of the local provider of the
+// zone. OneFS has no collection of the keys, so the key of every user of a
+// page is fetched, and the users without key are skipped.
+func (s *Server) Keys(opts ListOptions) *Iterator[*UserKey] {
+	userPages := s.userPages(opts)
+	return newIterator(func(resume string) ([]*UserKey, int, string, error) {
+		users, _, next, err := userPages(resume)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		var keys []*UserKey
+		for _, user := range users {
+			if !strings.HasPrefix(user.Name, opts.NamePrefix) {
+				continue
+			}
+			key, err := s.GetKey(user.Name)
+			if err != nil {
+				return nil, 0, "", err
+			}
+			if key != nil {
+				keys = append(keys, &UserKey{User: user.Name, Key: key})
+			}
+		}
+		return keys, 0, next, nil
+	}, nil)
+}
+
+// ListKeys returns the S3 keys of the users of the local provider of the zone.
+func (s *Server) ListKeys(opts ListOptions) ([]*UserKey, error) {
+	return s.Keys(opts).All()
+}
+
+// GroupMembers iterates over the members of a group.
+func (s *Server) GroupMembers(groupName string, opts ListOptions) *Iterator[*Member] {
+	url := fmt.Sprintf("%s/platform/14/auth/groups/%s/members", s.apiEndpoint, neturl.PathEscape(groupName))
+	query := neturl.Values{"zone": {s.zone}, "limit": {fmt.Sprint(opts.limit())}}
+	return newIterator(func(resume string) ([]*Member, int, string, error) {
+		var memberList MemberList
+		if err := s.getJSON(pageURL(url, query, resume), &memberList); err != nil {
+			return nil, 0, "", err
+		}
+		return memberList.Members, memberList.Total, memberList.Resume, nil
+	}, func(member *Member) bool {
+		return strings.HasPrefix(member.Name, opts.NamePrefix)
+	})
+}
+
+// ListGroupMembers returns the members of a group.
+func (s *Server) ListGroupMembers(groupName string, opts ListOptions) ([]*Member, error) {
+	return s.GroupMembers(groupName, opts).All()
+}
+
+// DirectoryEntries iterates over the entries of a directory of the namespace.
+// The path prefix of the options applies to the full path of the entries.
+func (s *Server) DirectoryEntries(path string, opts ListOptions) *Iterator[*DirectoryEntry] {
+	dir := strings.TrimSuffix(path, "/")
+	return newIterator(func(resume string) ([]*DirectoryEntry, int, string, error) {
+		// Unlike the platform API, the namespace API expects the query
+		// along with the resume token.
+		query := neturl.Values{"detail": {"type"}, "limit": {fmt.Sprint(opts.limit())}}
+		if resume != "" {
+			query.Set("resume", resume)
+		}
+		var children DirectoryChildren
+		if err := s.getJSON(s.namespaceURL(dir)+"?"+query.Encode(), &children); err != nil {
+			return nil, 0, "", err
+		}
+		return children.Children, 0, children.Resume, nil
+	}, func(entry *DirectoryEntry) bool {
+		return strings.HasPrefix(entry.Name, opts.NamePrefix) && opts.matchPath(dir+"/"+entry.Name)
+	})
+}
+
+// ListDirectory returns the entries of a directory of the namespace.
+func (s *Server) ListDirectory(path string, opts ListOptions) ([]*DirectoryEntry, error) {
+	return s.DirectoryEntries(path, opts).All()
+}
@@ -0,0 +1,109 @@
+package powerscale_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale/fake"
+)
+
+// The listings follow the resume tokens across pages smaller than the
+// collections, and filter the objects on the client side.
+func TestListPages(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	client := powerscale.New(server.Config())
+	owner := client.NewOwnership("", "", "")
+	opts := powerscale.ListOptions{PageSize: 2}
+
+	for i := range 5 {
+		name := fmt.Sprintf("team-%d", i)
+		if err := client.CreateBucket(name, owner); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.CreateUser(name, owner); err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 0 {
+			if _, err := client.CreateKey(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := client.CreateBucket("other", owner); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateGroup("readers", client.NewOwnership("", "", "")); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		if err := client.AddGroupMember("readers", fmt.Sprintf("team-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	it := client.Buckets(opts)
+	var bucketNames []string
+	for it.Next() {
+		bucketNames = append(bucketNames, it.Item().Name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(bucketNames) != 6 || it.Total() != 6 {
+		t.Errorf("unexpected buckets %v, total %d", bucketNames, it.Total())
+	}
+
+	buckets, err := client.ListBuckets(powerscale.ListOptions{NamePrefix: "team-", PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 5 {
+		t.Errorf("expected 5 buckets, got %d", len(buckets))
+	}
+	buckets, err = client.ListBuckets(powerscale.ListOptions{PathPrefix: fake.BasePath + "/other/", PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 1 || buckets[0].Name != "other" {
+		t.Errorf("unexpected buckets %+v", buckets)
+	}
+
+	users, err := client.ListUsers(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 5 {
+		t.Errorf("expected 5 users, got %d", len(users))
+	}
+
+	keys, err := client.ListKeys(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keyUsers []string
+	for _, key := range keys {
+		keyUsers = append(keyUsers, key.User)
+	}
+	if !reflect.DeepEqual(keyUsers, []string{"team-0", "team-2", "team-4"}) {
+		t.Errorf("unexpected keys of %v", keyUsers)
+	}
+
+	members, err := client.ListGroupMembers("readers", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 5 {
+		t.Errorf("expected 5 members, got %d", len(members))
+	}
+
+	entries, err := client.ListDirectory(fake.BasePath, powerscale.ListOptions{NamePrefix: "team-", PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 || entries[0].Type != "container" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+}
@@ -0,0 +1,111 @@
+package powerscale
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "k8s.io/klog/v2"
+
+	"github.com/japannext/cosi-powerscale/pkg/redact"
+)
+
+var (
+	apiRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cosi_powerscale_api_requests_total",
+		Help: "Number of OneFS API requests, by method, endpoint and status code.",
+	}, []string{"method", "endpoint", "code"})
+
+	apiDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cosi_powerscale_api_request_duration_seconds",
+		Help:    "Latency of the OneFS API requests, by method and endpoint.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "endpoint"})
+
+	auditErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cosi_powerscale_audit_errors_total",
+		Help: "Number of audit records that could not be written.",
+	})
+
+	retries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cosi_powerscale_retries_total",
+		Help: "Number of retried OneFS operations, by operation.",
+	}, []string{"operation"})
+)
+
+// Collections of the platform API whose members are named in the URL.
+var apiCollections = []string{
+	"auth/groups",
+	"auth/users",
+	"protocols/s3/buckets",
+	"protocols/s3/keys",
+	"quota/quotas",
+	"zones",
+}
+
+// endpointLabel returns the path of a request with the names of the objects
+// replaced by `{name}`, to keep the cardinality of the metrics low.
+func endpointLabel(path string) string {
+	if strings.HasPrefix(path, "/namespace/") {
+		return "/namespace/{path}"
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) < 3 || segments[0] != "platform" {
+		return path
+	}
+	rest := strings.Join(segments[2:], "/")
+	for _, collection := range apiCollections {
+		if rest != collection && !strings.HasPrefix(rest, collection+"/") {
+			continue
+		}
+		label := []string{"", "platform", segments[1], collection}
+		names := strings.Split(strings.TrimPrefix(rest, collection), "/")[1:]
+		for i, name := range names {
+			// Object names alternate with the names of their sub-collections,
+			// e.g. groups/{name}/members/{name}.
+			if i%2 == 0 {
+				name = "{name}"
+			}
+			label = append(label, name)
+		}
+		return strings.Join(label, "/")
+	}
+	return path
+}
+
+// Verbosity of the logs of the OneFS API requests, without their bodies.
+const debugVerbosity = 6
+
+// instrumentedTransport records the metrics and the spans of the OneFS API
+// requests.
+type instrumentedTransport struct {
+	next http.RoundTripper
+	// Access zone of the Server, recorded in the spans.
+	zone string
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := endpointLabel(req.URL.Path)
+	ctx, span := startSpan(req.Context(), req, endpoint, t.zone)
+	defer span.End()
+
+	logger := log.FromContext(req.Context()).V(debugVerbosity)
+	logger.Info("OneFS request", "method", req.Method, "url", redact.String(req.URL.String()), "header", redact.Header(req.Header))
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	apiDuration.WithLabelValues(req.Method, endpoint).Observe(time.Since(start).Seconds())
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	apiRequests.WithLabelValues(req.Method, endpoint, code).Inc()
+	endSpan(span, resp, err)
+	if err == nil {
+		logger.Info("OneFS response", "method", req.Method, "url", redact.String(req.URL.String()), "status", resp.StatusCode, "header", redact.Header(resp.Header))
+	}
+	return resp, err
+}
@@ -0,0 +1,19 @@
+package powerscale
+
+import "testing"
+
+func TestEndpointLabel(t *testing.T) {
+	tests := map[string]string{
+		"/platform/14/protocols/s3/buckets":                 "/platform/14/protocols/s3/buckets",
+		"/platform/14/protocols/s3/buckets/bucket-1":        "/platform/14/protocols/s3/buckets/{name}",
+		"/platform/17/protocols/s3/buckets/bucket-1/policy": "/platform/17/protocols/s3/buckets/{name}/policy",
+		"/platform/14/auth/groups/group-1/members/ba-1":     "/platform/14/auth/groups/{name}/members/{name}",
+		"/platform/14/cluster/config":                       "/platform/14/cluster/config",
+		"/namespace/ifs/data/cosi/bucket-1":                 "/namespace/{path}",
+	}
+	for path, expected := range tests {
+		if label := endpointLabel(path); label != expected {
+			t.Errorf("endpointLabel(%q) = %q, expected %q", path, label, expected)
+		}
+	}
+}
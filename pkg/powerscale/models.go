@@ -1,8 +1,40 @@
 package powerscale
 
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/japannext/cosi-powerscale/pkg/redact"
+)
+
+const localProviderPrefix = "lsa-local-provider"
+
+// Grantee types of a bucket ACL entry.
+const (
+	GranteeUser  = "user"
+	GranteeGroup = "group"
+)
+
 type User struct {
 	Name    string `json:"name"`
 	Enabled bool   `json:"enabled"`
+	// Provider is only returned by OneFS, e.g. `lsa-local-provider:System`
+	// or `lsa-activedirectory-provider:CORP.EXAMPLE.COM`.
+	Provider string `json:"provider,omitempty"`
+	// Holds the Ownership marker of the users created by the driver.
+	Gecos string `json:"gecos,omitempty"`
+}
+
+// Ownership returns the ownership marker of the user, or nil.
+func (u *User) Ownership() *Ownership {
+	return ParseOwnership(u.Gecos)
+}
+
+// IsLocal reports whether the user belongs to the local provider of the zone,
+// meaning it may have been created by the driver.
+func (u *User) IsLocal() bool {
+	return u.Provider == "" || strings.HasPrefix(u.Provider, localProviderPrefix)
 }
 
 type ACL struct {
@@ -26,6 +58,11 @@ type Bucket struct {
 	Name            string `json:"name"`
 }
 
+// Ownership returns the ownership marker of the bucket, or nil.
+func (b *Bucket) Ownership() *Ownership {
+	return ParseOwnership(b.Description)
+}
+
 type PartialBucket struct {
 	Acl []ACL `json:"acl"`
 }
@@ -33,11 +70,39 @@ type PartialBucket struct {
 type BucketList struct {
 	Buckets []*Bucket `json:"buckets"`
 	Total   int       `json:"total"`
+	// Token of the next page, empty on the last page.
+	Resume string `json:"resume,omitempty"`
 }
 
 type Key struct {
 	AccessID  string `json:"access_id"`
 	SecretKey string `json:"secret_key"`
+	// Unix time of the key generation.
+	SecretKeyTimestamp int64 `json:"secret_key_timestamp,omitempty"`
+	// Unix time at which the previous key expires.
+	OldKeyExpiry int64 `json:"old_key_expiry,omitempty"`
+}
+
+// loggedKey is a Key without the MarshalLog method.
+type loggedKey Key
+
+// MarshalLog hides the secret key from the logs.
+func (k Key) MarshalLog() any {
+	if k.SecretKey != "" {
+		k.SecretKey = redact.Placeholder
+	}
+	return loggedKey(k)
+}
+
+// CreatedAt returns the generation time of the key.
+func (k *Key) CreatedAt() time.Time {
+	return time.Unix(k.SecretKeyTimestamp, 0)
+}
+
+// KeyCreate is the body of a key generation request.
+type KeyCreate struct {
+	// Minutes until the existing key expires.
+	ExistingKeyExpiryTime int `json:"existing_key_expiry_time,omitempty"`
 }
 
 type Keys struct {
@@ -45,6 +110,181 @@ type Keys struct {
 }
 
 type UserList struct {
-	Users []*User `json:"users"`
-	Total int     `json:"total"`
+	Users  []*User `json:"users"`
+	Total  int     `json:"total"`
+	Resume string  `json:"resume,omitempty"`
+}
+
+type Group struct {
+	Name string `json:"name"`
+}
+
+type GroupList struct {
+	Groups []*Group `json:"groups"`
+	Total  int      `json:"total"`
+}
+
+// Member is a persona added to a group.
+type Member struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// BucketPolicy is an S3 bucket policy document.
+type BucketPolicy struct {
+	Version   string            `json:"Version"`
+	Statement []PolicyStatement `json:"Statement"`
+}
+
+type PolicyStatement struct {
+	Sid       string          `json:"Sid"`
+	Effect    string          `json:"Effect"`
+	Principal PolicyPrincipal `json:"Principal"`
+	Action    StringList      `json:"Action"`
+	Resource  StringList      `json:"Resource"`
+	// Condition operator -> condition key -> values.
+	Condition map[string]map[string]StringList `json:"Condition,omitempty"`
+}
+
+type PolicyPrincipal struct {
+	AWS StringList `json:"AWS"`
+}
+
+// StringList is a list of strings in a policy, which may also be written
+// as a single string.
+type StringList []string
+
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = StringList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// DirectoryAttr is an extended attribute of the namespace API.
+type DirectoryAttr struct {
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	Namespace string `json:"namespace,omitempty"`
+	Op        string `json:"op,omitempty"`
+}
+
+type DirectoryMetadata struct {
+	Action string          `json:"action,omitempty"`
+	Attrs  []DirectoryAttr `json:"attrs"`
+}
+
+type MemberList struct {
+	Members []*Member `json:"members"`
+	Total   int       `json:"total"`
+	Resume  string    `json:"resume,omitempty"`
+}
+
+// DirectoryEntry is an entry of a directory listing of the namespace API.
+type DirectoryEntry struct {
+	Name string `json:"name"`
+	// `container` for directories, `object` for files.
+	Type string `json:"type,omitempty"`
+}
+
+type DirectoryChildren struct {
+	Children []*DirectoryEntry `json:"children"`
+	Resume   string            `json:"resume,omitempty"`
+}
+
+// Quota is a SmartQuotas quota.
+type Quota struct {
+	ID         string          `json:"id"`
+	Path       string          `json:"path"`
+	Type       string          `json:"type"`
+	Thresholds QuotaThresholds `json:"thresholds"`
+	Usage      QuotaUsage      `json:"usage"`
+}
+
+// QuotaThresholds are in bytes, nil when not set.
+type QuotaThresholds struct {
+	Hard     *int64 `json:"hard,omitempty"`
+	Soft     *int64 `json:"soft,omitempty"`
+	Advisory *int64 `json:"advisory,omitempty"`
+}
+
+// QuotaUsage is in bytes, except Inodes.
+type QuotaUsage struct {
+	// Logical size of the files, as seen by the clients.
+	FSLogical int64 `json:"fslogical"`
+	Physical  int64 `json:"physical"`
+	Inodes    int64 `json:"inodes"`
+}
+
+type QuotaList struct {
+	Quotas []*Quota `json:"quotas"`
+	Total  int      `json:"total"`
+	Resume string   `json:"resume,omitempty"`
+}
+
+type ClusterConfig struct {
+	Name         string       `json:"name"`
+	OnefsVersion OnefsVersion `json:"onefs_version"`
+}
+
+type OnefsVersion struct {
+	Release string `json:"release"`
+}
+
+type Zone struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type ZoneList struct {
+	Zones []*Zone `json:"zones"`
+}
+
+type S3Settings struct {
+	// Whether the S3 service is enabled.
+	Service   bool `json:"service"`
+	HTTPSOnly bool `json:"https_only"`
+}
+
+type S3GlobalSettings struct {
+	Settings S3Settings `json:"settings"`
+}
+
+type S3ZoneSettings struct {
+	RootPath string `json:"root_path"`
+	// Whether S3 is enabled in the zone, nil when the release only has the
+	// global flag.
+	Service *bool `json:"service,omitempty"`
+}
+
+type S3ZoneSettingsResponse struct {
+	Settings S3ZoneSettings `json:"settings"`
+}
+
+// Privilege is a RBAC privilege of the API user.
+type Privilege struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+// AuthID is the access token of the API user.
+type AuthID struct {
+	User       AuthPersona `json:"user"`
+	Privileges []Privilege `json:"privilege"`
+}
+
+type AuthPersona struct {
+	Name string `json:"name"`
+}
+
+type AuthIDResponse struct {
+	NToken AuthID `json:"ntoken"`
 }
@@ -0,0 +1,217 @@
+package powerscale
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/japannext/cosi-powerscale/pkg/audit"
+)
+
+// namespaceURL returns the URL of a path of the OneFS namespace API.
+func (s *Server) namespaceURL(path string) string {
+	return fmt.Sprintf("%s/namespace/%s", s.apiEndpoint, strings.TrimPrefix(path, "/"))
+}
+
+// ReadFile returns the content of a file, or nil if it does not exist.
+func (s *Server) ReadFile(path string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, s.namespaceURL(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.basicAuth(req)
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == 404 {
+		return nil, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode > 299 {
+		return nil, newStatusError(resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+// WriteFile creates or replaces a file, creating its parent directory if needed.
+func (s *Server) WriteFile(path string, data []byte) (err error) {
+	defer func() { s.audit(&audit.Record{Operation: "WriteFile", Path: path}, err) }()
+
+	status, body, err := s.putFile(path, data)
+	if err != nil {
+		return err
+	}
+	// The parent directory is created by the first write, which is not a
+	// retry of a failed write.
+	if status == 404 {
+		if err := s.CreateDirectory(path[:strings.LastIndex(path, "/")]); err != nil {
+			return err
+		}
+		status, body, err = s.putFile(path, data)
+		if err != nil {
+			return err
+		}
+	}
+	if status > 299 {
+		return newStatusError(status, body)
+	}
+	return nil
+}
+
+func (s *Server) putFile(path string, data []byte) (int, []byte, error) {
+	req, err := http.NewRequest(http.MethodPut, s.namespaceURL(path), bytes.NewBuffer(data))
+	if err != nil {
+		return 0, nil, err
+	}
+	s.basicAuth(req)
+	req.Header.Set("x-isi-ifs-target-type", "object")
+	req.Header.Set("x-isi-ifs-access-control", "0600")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := s.do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, body, nil
+}
+
+// CreateDirectory creates a directory and its parents.
+func (s *Server) CreateDirectory(path string) (err error) {
+	defer func() { s.audit(&audit.Record{Operation: "CreateDirectory", Path: path}, err) }()
+
+	req, err := http.NewRequest(http.MethodPut, s.namespaceURL(path)+"?recursive=true", nil)
+	if err != nil {
+		return err
+	}
+	s.basicAuth(req)
+	req.Header.Set("x-isi-ifs-target-type", "container")
+	req.Header.Set("x-isi-ifs-access-control", "0700")
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode > 299 {
+		return newStatusError(resp.StatusCode, body)
+	}
+	return nil
+}
+
+// DeleteFile deletes a file. A missing file is a no-op.
+func (s *Server) DeleteFile(path string) (err error) {
+	defer func() { s.audit(&audit.Record{Operation: "DeleteFile", Path: path}, err) }()
+
+	req, err := http.NewRequest(http.MethodDelete, s.namespaceURL(path), nil)
+	if err != nil {
+		return err
+	}
+	s.basicAuth(req)
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == 404 {
+		return nil
+	}
+	if resp.StatusCode > 299 {
+		return newStatusError(resp.StatusCode, body)
+	}
+	return nil
+}
+
+// Name of the user extended attribute holding the ownership marker of a directory.
+const ownershipAttr = "cosi-powerscale.ownership"
+
+// SetDirectoryOwnership stores the ownership marker in an extended attribute of the directory.
+func (s *Server) SetDirectoryOwnership(path string, owner Ownership) (err error) {
+	defer func() { s.audit(&audit.Record{Operation: "SetDirectoryOwnership", Path: path}, err) }()
+
+	data, err := json.Marshal(&DirectoryMetadata{
+		Action: "update",
+		Attrs: []DirectoryAttr{{
+			Name:      ownershipAttr,
+			Value:     owner.String(),
+			Namespace: "user",
+			Op:        "update",
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, s.namespaceURL(path)+"?metadata", bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	s.basicAuth(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode > 299 {
+		return newStatusError(resp.StatusCode, body)
+	}
+	return nil
+}
+
+// GetDirectoryOwnership returns the ownership marker of the directory, or nil.
+func (s *Server) GetDirectoryOwnership(path string) (*Ownership, error) {
+	req, err := http.NewRequest(http.MethodGet, s.namespaceURL(path)+"?metadata", nil)
+	if err != nil {
+		return nil, err
+	}
+	s.basicAuth(req)
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == 404 {
+		return nil, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode > 299 {
+		return nil, newStatusError(resp.StatusCode, body)
+	}
+
+	var metadata DirectoryMetadata
+	if err := json.Unmarshal(body, &metadata); err != nil {
+		return nil, err
+	}
+	for _, attr := range metadata.Attrs {
+		if attr.Name == ownershipAttr && (attr.Namespace == "" || attr.Namespace == "user") {
+			return ParseOwnership(attr.Value), nil
+		}
+	}
+	return nil, nil
+}
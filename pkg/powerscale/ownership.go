@@ -0,0 +1,70 @@
+package powerscale
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// ownershipCreator marks the objects created by this driver.
+const ownershipCreator = "cosi-powerscale"
+
+// LegacyBucketDescription is the description of the buckets created before
+// the ownership markers, which does not tell the driver instance.
+const LegacyBucketDescription = "Created by cosi-powerscale"
+
+// Ownership is the marker stored on every object created by the driver:
+// in the bucket description, the user gecos field and an extended attribute
+// of the bucket directory, of the state files and of the group marker files.
+// Cleanup tooling must check it before deleting.
+type Ownership struct {
+	CreatedBy string `json:"createdBy"`
+	// Name of the driver instance.
+	Driver string `json:"driver"`
+	// UID of the Kubernetes object (Bucket or BucketAccess).
+	UID       string    `json:"uid,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// BucketClaim of the bucket or of the BucketAccess.
+	ClaimNamespace string `json:"claimNamespace,omitempty"`
+	ClaimName      string `json:"claimName,omitempty"`
+}
+
+// NewOwnership returns the ownership marker of an object created now.
+func (s *Server) NewOwnership(uid, claimNamespace, claimName string) Ownership {
+	return Ownership{
+		CreatedBy:      ownershipCreator,
+		Driver:         s.Name,
+		UID:            uid,
+		CreatedAt:      time.Now().UTC().Truncate(time.Second),
+		ClaimNamespace: claimNamespace,
+		ClaimName:      claimName,
+	}
+}
+
+func (o Ownership) String() string {
+	data, _ := json.Marshal(o)
+	return string(data)
+}
+
+// ParseOwnership returns the ownership marker of a text field, or nil if it
+// does not hold one.
+func ParseOwnership(text string) *Ownership {
+	if !strings.HasPrefix(strings.TrimSpace(text), "{") {
+		return nil
+	}
+	var o Ownership
+	if err := json.Unmarshal([]byte(text), &o); err != nil || o.CreatedBy != ownershipCreator {
+		return nil
+	}
+	return &o
+}
+
+// OwnedBy reports whether the marker was set by the given driver instance.
+func (o *Ownership) OwnedBy(driver string) bool {
+	return o != nil && o.CreatedBy == ownershipCreator && o.Driver == driver
+}
+
+// Owns reports whether the ownership marker is the one of this driver instance.
+func (s *Server) Owns(o *Ownership) bool {
+	return o.OwnedBy(s.Name)
+}
@@ -0,0 +1,23 @@
+package powerscale
+
+import (
+	"fmt"
+	neturl "net/url"
+)
+
+// GetDirectoryQuota returns the directory quota of a path, or nil if the path
+// has no quota.
+func (s *Server) GetDirectoryQuota(path string) (*Quota, error) {
+	query := neturl.Values{"path": {path}, "type": {"directory"}, "zone": {s.zone}}
+	url := fmt.Sprintf("%s/platform/14/quota/quotas?%s", s.apiEndpoint, query.Encode())
+	var quotaList QuotaList
+	if err := s.getJSON(url, &quotaList); err != nil {
+		return nil, err
+	}
+	for _, quota := range quotaList.Quotas {
+		if quota.Path == path {
+			return quota, nil
+		}
+	}
+	return nil, nil
+}
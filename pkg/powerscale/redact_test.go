@@ -0,0 +1,132 @@
+package powerscale
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "k8s.io/klog/v2"
+
+	"github.com/japannext/cosi-powerscale/pkg/config"
+)
+
+const (
+	testPassword  = "Pa55w0rd-do-not-log"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+)
+
+// captureLogs sends the logs to a buffer, at the highest verbosity.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	flags := flag.NewFlagSet("klog", flag.ContinueOnError)
+	log.InitFlags(flags)
+	for name, value := range map[string]string{"v": "10", "logtostderr": "false", "alsologtostderr": "false"} {
+		if err := flags.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() {
+		flags.Set("v", "0")
+		flags.Set("logtostderr", "true")
+		log.SetOutput(nil)
+	})
+	return &buf
+}
+
+// secrets are the credentials that must not be logged.
+func secrets() []string {
+	return []string{
+		testPassword,
+		testSecretKey,
+		base64.StdEncoding.EncodeToString([]byte("cosi:" + testPassword)),
+	}
+}
+
+func assertNoSecret(t *testing.T, what, text string) {
+	t.Helper()
+	for _, secret := range secrets() {
+		if strings.Contains(text, secret) {
+			t.Errorf("%s contains %q:\n%s", what, secret, text)
+		}
+	}
+}
+
+func newTestServer(t *testing.T, handler http.HandlerFunc) *Server {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	return New(&config.Config{
+		Name:        "test",
+		ApiEndpoint: ts.URL,
+		ApiUsername: "cosi",
+		ApiPassword: testPassword,
+		Zone:        "System",
+		BasePath:    "/ifs/data/cosi",
+	})
+}
+
+func TestCredentialsNotLogged(t *testing.T) {
+	buf := captureLogs(t)
+	keyBody := fmt.Sprintf(`{"keys":{"access_id":"1_cosi-user_accid","secret_key":%q,"secret_key_timestamp":1700000000}}`, testSecretKey)
+	s := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "isisessid=2e0f1b3c-9d4a-4b9e")
+		fmt.Fprint(w, keyBody)
+	})
+
+	key, err := s.RotateKey("cosi-user", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.SecretKey != testSecretKey {
+		t.Fatalf("secret key = %q, want %q", key.SecretKey, testSecretKey)
+	}
+	if _, err := s.GetKey("cosi-user"); err != nil {
+		t.Fatal(err)
+	}
+	log.InfoS("Key fetched", "key", key)
+	log.Flush()
+
+	if !strings.Contains(buf.String(), "OneFS request") {
+		t.Fatalf("the OneFS requests are not logged at high verbosity:\n%s", buf)
+	}
+	assertNoSecret(t, "log output", buf.String())
+}
+
+func TestErrorBodiesRedacted(t *testing.T) {
+	// OneFS echoes the invalid input in its error messages.
+	errorBody := fmt.Sprintf(`{"errors":[{"code":"AEC_BAD_REQUEST","message":"Invalid input {\"password\":\"%s\",\"secret_key\":\"%s\"}"}]}`, testPassword, testSecretKey)
+	s := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, errorBody, http.StatusBadRequest)
+	})
+
+	errs := map[string]error{}
+	_, errs["GetKey"] = s.GetKey("cosi-user")
+	_, errs["RotateKey"] = s.RotateKey("cosi-user", 0)
+	errs["CreateUser"] = s.CreateUser("cosi-user", Ownership{})
+	_, errs["ListUsers"] = s.ListUsers(ListOptions{})
+
+	for name, err := range errs {
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+			continue
+		}
+		assertNoSecret(t, name+" error", err.Error())
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			t.Errorf("%s: error %v is not a StatusError", name, err)
+			continue
+		}
+		if statusErr.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status code = %d, want %d", name, statusErr.StatusCode, http.StatusBadRequest)
+		}
+		assertNoSecret(t, name+" error body", string(statusErr.Body))
+	}
+}
@@ -0,0 +1,181 @@
+package powerscale
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "k8s.io/klog/v2"
+
+	"github.com/japannext/cosi-powerscale/pkg/config"
+)
+
+// Delay between a file change and the reload, as Kubernetes updates the
+// files of a volume in several steps.
+const reloadDelay = 2 * time.Second
+
+type credentials struct {
+	username string
+	password string
+}
+
+// reloadableTransport sends the requests through a transport that can be
+// swapped, so that new TLS material applies to the new connections while
+// the requests in flight complete on the previous transport.
+type reloadableTransport struct {
+	current atomic.Pointer[http.Transport]
+	// Serializes the reloads.
+	mu sync.Mutex
+	// Digest of the TLS files of the current transport.
+	digest []byte
+}
+
+func (t *reloadableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.current.Load().RoundTrip(req)
+}
+
+func (t *reloadableTransport) swap(next *http.Transport) {
+	previous := t.current.Swap(next)
+	previous.CloseIdleConnections()
+}
+
+// tlsFiles returns the TLS files of the configuration.
+func tlsFiles(cfg *config.Config) []string {
+	var files []string
+	for _, file := range []string{cfg.TlsCacert, cfg.TlsClientCert, cfg.TlsClientKey} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// digestFiles returns a digest of the content of the files.
+func digestFiles(files []string) ([]byte, error) {
+	h := sha256.New()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(data)
+	}
+	return h.Sum(nil), nil
+}
+
+// Reload re-reads the API credentials files and the TLS files of the
+// configuration, and swaps them when they changed. On error, the current
+// credentials and TLS configuration are kept.
+func (s *Server) Reload(cfg *config.Config) error {
+	s.transport.mu.Lock()
+	defer s.transport.mu.Unlock()
+
+	creds := &credentials{username: cfg.ApiUsername, password: cfg.ApiPassword}
+	if cfg.ApiUsernameFile != "" {
+		username, err := config.ReadSecretFile(cfg.ApiUsernameFile)
+		if err != nil {
+			return err
+		}
+		creds.username = username
+	}
+	if cfg.ApiPasswordFile != "" {
+		password, err := config.ReadSecretFile(cfg.ApiPasswordFile)
+		if err != nil {
+			return err
+		}
+		creds.password = password
+	}
+
+	digest, err := digestFiles(tlsFiles(cfg))
+	if err != nil {
+		return err
+	}
+	var tlsTransport *http.Transport
+	if !bytes.Equal(digest, s.transport.digest) {
+		tlsConfig, err := NewTLSConfig(cfg)
+		if err != nil {
+			return err
+		}
+		tlsTransport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+
+	if *creds != *s.credentials.Load() {
+		s.credentials.Store(creds)
+		log.InfoS("API credentials reloaded", "username", creds.username)
+	}
+	if tlsTransport != nil {
+		s.transport.swap(tlsTransport)
+		s.transport.digest = digest
+		log.InfoS("TLS configuration reloaded", "files", tlsFiles(cfg))
+	}
+	return nil
+}
+
+// WatchFiles reloads the API credentials and the TLS material whenever their
+// files change, until the context is done.
+func (s *Server) WatchFiles(ctx context.Context, cfg *config.Config) error {
+	files := tlsFiles(cfg)
+	for _, file := range []string{cfg.ApiUsernameFile, cfg.ApiPasswordFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	// Record the digest of the TLS files loaded by New.
+	digest, err := digestFiles(tlsFiles(cfg))
+	if err != nil {
+		return err
+	}
+	s.transport.mu.Lock()
+	s.transport.digest = digest
+	s.transport.mu.Unlock()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// Kubernetes replaces the files of secret and configmap volumes by
+	// swapping a symlink, so the directories are watched.
+	dirs := make(map[string]bool)
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if dirs[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			return err
+		}
+		dirs[dir] = true
+	}
+	log.InfoS("Watching credentials and TLS files", "files", files)
+
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-watcher.Events:
+			log.V(4).InfoS("File changed", "file", event.Name, "op", event.Op)
+			timer.Reset(reloadDelay)
+		case err := <-watcher.Errors:
+			log.ErrorS(err, "Failed to watch credentials and TLS files")
+		case <-timer.C:
+			if err := s.Reload(cfg); err != nil {
+				log.ErrorS(err, "Failed to reload credentials and TLS files, keeping the current ones")
+			}
+		}
+	}
+}
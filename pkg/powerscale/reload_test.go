@@ -0,0 +1,85 @@
+package powerscale_test
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale/fake"
+)
+
+// writeCA writes the certificate of a throwaway TLS server as a CA file.
+func writeCA(t *testing.T, file string) {
+	t.Helper()
+	tlsServer := httptest.NewTLSServer(nil)
+	tlsServer.Close()
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeFile(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchFiles(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	dir := t.TempDir()
+	cfg := server.Config()
+	cfg.ApiPasswordFile = filepath.Join(dir, "password")
+	cfg.TlsCacert = filepath.Join(dir, "ca.crt")
+	writeFile(t, cfg.ApiPasswordFile, fake.Password+"\n")
+	writeCA(t, cfg.TlsCacert)
+	client := powerscale.New(cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- client.WatchFiles(ctx, cfg) }()
+	// Let the watcher start before the files change.
+	time.Sleep(100 * time.Millisecond)
+
+	// The password is rotated on the cluster, then in the secret volume.
+	server.SetCredentials(fake.Username, "rotated")
+	if _, err := client.GetClusterConfig(); err == nil {
+		t.Fatal("expected the previous password to be rejected")
+	}
+	writeFile(t, cfg.ApiPasswordFile, "rotated\n")
+	writeCA(t, cfg.TlsCacert)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		_, err := client.GetClusterConfig()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the credentials were not reloaded: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// An invalid TLS file rejects the whole reload.
+	writeFile(t, cfg.ApiPasswordFile, "next\n")
+	writeFile(t, cfg.TlsCacert, "not a certificate")
+	if err := client.Reload(cfg); err == nil {
+		t.Error("expected the invalid CA file to be rejected")
+	}
+	if _, err := client.GetClusterConfig(); err != nil {
+		t.Errorf("the current credentials must be kept: %v", err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
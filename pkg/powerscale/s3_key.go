@@ -1,24 +1,27 @@
 package powerscale
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"time"
 
 	"github.com/aws/aws-sdk-go/service/iam"
 
-	log "k8s.io/klog/v2"
+	"github.com/japannext/cosi-powerscale/pkg/audit"
 )
 
 func (s *Server) GetKey(userName string) (*Key, error) {
-	url := fmt.Sprintf("%s/platform/14/protocols/s3/keys/%s?zone=%s", s.apiEndpoint, userName, s.zone)
+	url := fmt.Sprintf("%s/platform/14/protocols/s3/keys/%s?zone=%s", s.apiEndpoint, neturl.PathEscape(userName), s.zone)
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
 	s.basicAuth(req)
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +34,7 @@ func (s *Server) GetKey(userName string) (*Key, error) {
 		return nil, err
 	}
 	if resp.StatusCode > 299 {
-		return nil, fmt.Errorf("Unexpected status code %d: %s", resp.StatusCode, body)
+		return nil, newStatusError(resp.StatusCode, body)
 	}
 	var keys Keys
 	if err := json.Unmarshal(body, &keys); err != nil {
@@ -44,14 +47,44 @@ func (s *Server) GetKey(userName string) (*Key, error) {
 }
 
 func (s *Server) CreateKey(userName string) (*iam.CreateAccessKeyOutput, error) {
+	key, err := s.RotateKey(userName, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	accessKey := &iam.CreateAccessKeyOutput{AccessKey: &iam.AccessKey{
+		AccessKeyId:     &key.AccessID,
+		SecretAccessKey: &key.SecretKey,
+	}}
+	return accessKey, nil
+}
+
+// RotateKey generates a new S3 key for the user. The previous key, if any,
+// stays valid for existingKeyExpiry (rounded up to the minute), or for the
+// OneFS default when existingKeyExpiry is zero.
+func (s *Server) RotateKey(userName string, existingKeyExpiry time.Duration) (_ *Key, err error) {
+	defer func() { s.audit(&audit.Record{Operation: "RotateKey", User: userName}, err) }()
 
-	url := fmt.Sprintf("%s/platform/14/protocols/s3/keys/%s?zone=%s", s.apiEndpoint, userName, s.zone)
-	req, err := http.NewRequest(http.MethodPost, url, nil)
+	var data []byte
+	if existingKeyExpiry > 0 {
+		minutes := int((existingKeyExpiry + time.Minute - 1) / time.Minute)
+		var err error
+		data, err = json.Marshal(&KeyCreate{ExistingKeyExpiryTime: minutes})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	url := fmt.Sprintf("%s/platform/14/protocols/s3/keys/%s?zone=%s", s.apiEndpoint, neturl.PathEscape(userName), s.zone)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, err
 	}
 	s.basicAuth(req)
-	resp, err := s.client.Do(req)
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +94,7 @@ func (s *Server) CreateKey(userName string) (*iam.CreateAccessKeyOutput, error)
 		return nil, err
 	}
 	if resp.StatusCode > 299 {
-		return nil, fmt.Errorf("Unexpected status code %d: %s", resp.StatusCode, body)
+		return nil, newStatusError(resp.StatusCode, body)
 	}
 
 	var keys Keys
@@ -69,22 +102,20 @@ func (s *Server) CreateKey(userName string) (*iam.CreateAccessKeyOutput, error)
 		return nil, err
 	}
 
-	accessKey := &iam.CreateAccessKeyOutput{AccessKey: &iam.AccessKey{
-		AccessKeyId:     &keys.Keys.AccessID,
-		SecretAccessKey: &keys.Keys.SecretKey,
-	}}
-	log.InfoS("CreateKey success", "userName", userName)
-	return accessKey, nil
+	s.logger().Info("CreateKey success", "userName", userName, "existingKeyExpiry", existingKeyExpiry)
+	return &keys.Keys, nil
 }
 
-func (s *Server) DeleteKey(userName string) error {
-	url := fmt.Sprintf("%s/platform/14/protocols/s3/keys/%s?zone=%s", s.apiEndpoint, userName, s.zone)
+func (s *Server) DeleteKey(userName string) (err error) {
+	defer func() { s.audit(&audit.Record{Operation: "DeleteKey", User: userName}, err) }()
+
+	url := fmt.Sprintf("%s/platform/14/protocols/s3/keys/%s?zone=%s", s.apiEndpoint, neturl.PathEscape(userName), s.zone)
 	req, err := http.NewRequest(http.MethodDelete, url, nil)
 	if err != nil {
 		return err
 	}
 	s.basicAuth(req)
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return err
 	}
@@ -94,13 +125,13 @@ func (s *Server) DeleteKey(userName string) error {
 		return err
 	}
 	if resp.StatusCode == 404 {
-		log.InfoS("DeleteKey success (not found)", "user", userName)
+		s.logger().Info("DeleteKey success (not found)", "user", userName)
 		return nil
 	}
 	if resp.StatusCode > 299 {
-		return fmt.Errorf("Unexpected status code %d: %s", resp.StatusCode, body)
+		return newStatusError(resp.StatusCode, body)
 	}
-	log.InfoS("DeleteKey success", "user", userName)
+	s.logger().Info("DeleteKey success", "user", userName)
 
 	return nil
 }
@@ -1,17 +1,22 @@
 package powerscale
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	log "k8s.io/klog/v2"
 
+	"github.com/japannext/cosi-powerscale/pkg/audit"
 	"github.com/japannext/cosi-powerscale/pkg/config"
+	"github.com/japannext/cosi-powerscale/pkg/redact"
 )
 
 const (
@@ -33,6 +38,23 @@ var (
 	defaultTimeout               = time.Second * 20
 )
 
+// StatusError is returned for the unexpected status codes of the API.
+type StatusError struct {
+	StatusCode int
+	// Body of the response, without its credentials.
+	Body []byte
+}
+
+// newStatusError returns the error of an unexpected status code. The error
+// bodies of OneFS may echo the request, e.g. a key or a password.
+func newStatusError(statusCode int, body []byte) *StatusError {
+	return &StatusError{StatusCode: statusCode, Body: redact.Bytes(body)}
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Unexpected status code %d: %s", e.StatusCode, e.Body)
+}
+
 // Server is implementation of driver.Driver interface for ObjectScale platform.
 type Server struct {
 	Name        string
@@ -41,19 +63,68 @@ type Server struct {
 	apiEndpoint string
 	cacert      string
 	zone        string
-	username    string
-	password    string
-	client      *http.Client
+	// API credentials, swapped when reloaded.
+	credentials *atomic.Pointer[credentials]
+	// Its transport is swapped when the TLS material is reloaded.
+	transport *reloadableTransport
+	client    *http.Client
 	// The path base to use in OneFS, so all buckets are in <basePath>/<bucketName>
 	basePath string
+	// Serializes the read-modify-write of bucket ACLs, keyed by bucket name.
+	bucketLocks *keyedMutex
+	// Serializes the updates of shared identity references, keyed by user name.
+	identityLocks *keyedMutex
+	// Audit log of the mutating operations, nil when disabled.
+	auditSink audit.Sink
+	// Context of the requests, set by WithContext. The state above is
+	// shared by the copies of the Server.
+	ctx context.Context
+}
+
+// BasePath returns the directory holding the bucket directories.
+func (s *Server) BasePath() string {
+	return s.basePath
+}
+
+// BucketPath returns the directory of a bucket.
+func (s *Server) BucketPath(bucketName string) string {
+	return s.getBucketPath(bucketName)
+}
+
+// WithContext returns a copy of the Server sending its requests with the
+// context, so that they are traced and cancelled with the gRPC request.
+func (s *Server) WithContext(ctx context.Context) *Server {
+	c := *s
+	c.ctx = ctx
+	return &c
+}
+
+// logger returns the logger of the Server context, with the request ID of
+// the gRPC request when there is one.
+func (s *Server) logger() log.Logger {
+	if s.ctx == nil {
+		return log.Background()
+	}
+	return log.FromContext(s.ctx)
+}
+
+// do sends a request with the context of the Server.
+func (s *Server) do(req *http.Request) (*http.Response, error) {
+	if s.ctx != nil {
+		req = req.WithContext(s.ctx)
+	}
+	return s.client.Do(req)
 }
 
 func (s *Server) basicAuth(req *http.Request) {
-	auth := base64.StdEncoding.EncodeToString([]byte(s.username + ":" + s.password))
+	creds := s.credentials.Load()
+	auth := base64.StdEncoding.EncodeToString([]byte(creds.username + ":" + creds.password))
 	req.Header.Add("Authorization", "Basic "+auth)
 }
 
-func New(cfg *config.Config) *Server {
+// NewTLSConfig returns the TLS configuration of the API client: the CA
+// certificates and the client certificate of the configuration.
+func NewTLSConfig(cfg *config.Config) (*tls.Config, error) {
 	tlsConfig := &tls.Config{
 		InsecureSkipVerify: cfg.TlsInsecureSkipVerify,
 	}
@@ -61,31 +132,50 @@ func New(cfg *config.Config) *Server {
 		rootCAs := x509.NewCertPool()
 		pem, err := ioutil.ReadFile(cfg.TlsCacert)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
 		if ok := rootCAs.AppendCertsFromPEM(pem); !ok {
-			log.Errorf("No cert found in %s", cfg.TlsCacert)
+			return nil, fmt.Errorf("no cert found in %s", cfg.TlsCacert)
 		}
 		tlsConfig.RootCAs = rootCAs
 	}
 	if cfg.TlsClientCert != "" && cfg.TlsClientKey != "" {
 		cert, err := tls.LoadX509KeyPair(cfg.TlsClientCert, cfg.TlsClientKey)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
 		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
-	return &Server{
+	return tlsConfig, nil
+}
+
+func New(cfg *config.Config) *Server {
+	tlsConfig, err := NewTLSConfig(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	auditSink, err := audit.New(cfg.AuditLog)
+	if err != nil {
+		log.Fatal(err)
+	}
+	transport := &reloadableTransport{}
+	transport.current.Store(&http.Transport{TLSClientConfig: tlsConfig})
+	s := &Server{
 		Name:        cfg.Name,
 		apiEndpoint: cfg.ApiEndpoint,
-		username:    cfg.ApiUsername,
-		password:    cfg.ApiPassword,
 		zone:        cfg.Zone,
 		S3Endpoint:  cfg.S3Endpoint,
 		S3Region:    cfg.S3Region,
 		basePath:    cfg.BasePath,
+		transport:   transport,
 		client: &http.Client{
-			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+			Transport: &instrumentedTransport{next: transport, zone: cfg.Zone},
 		},
+		credentials:   &atomic.Pointer[credentials]{},
+		bucketLocks:   &keyedMutex{},
+		identityLocks: &keyedMutex{},
+		auditSink:     auditSink,
 	}
+	s.credentials.Store(&credentials{username: cfg.ApiUsername, password: cfg.ApiPassword})
+	return s
 }
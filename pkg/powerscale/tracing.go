@@ -0,0 +1,42 @@
+package powerscale
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The spans are no-ops unless a tracer provider is registered.
+var tracer = otel.Tracer("github.com/japannext/cosi-powerscale/pkg/powerscale")
+
+// startSpan starts the span of a OneFS API request, a child of the span of
+// the gRPC request when the Server has its context.
+func startSpan(ctx context.Context, req *http.Request, endpoint, zone string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, fmt.Sprintf("OneFS %s %s", req.Method, endpoint),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.path", req.URL.Path),
+			attribute.String("server.address", req.URL.Hostname()),
+			attribute.String("powerscale.zone", zone),
+		))
+}
+
+// endSpan records the outcome of a OneFS API request. Client errors are not
+// span errors, as the driver expects some of them (e.g. 404 on lookups).
+func endSpan(span trace.Span, resp *http.Response, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+}
@@ -6,18 +6,28 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 
-	log "k8s.io/klog/v2"
+	"github.com/japannext/cosi-powerscale/pkg/audit"
 )
 
 func (s *Server) GetUser(userName string) (*User, error) {
-	url := fmt.Sprintf("%s/platform/14/auth/users/%s?zone=%s", s.apiEndpoint, userName, s.zone)
+	return s.FindUser(userName, "")
+}
+
+// FindUser looks up an existing user, optionally restricted to an auth
+// provider of the zone (e.g. `lsa-activedirectory-provider:CORP.EXAMPLE.COM`).
+func (s *Server) FindUser(userName, provider string) (*User, error) {
+	url := fmt.Sprintf("%s/platform/14/auth/users/%s?zone=%s", s.apiEndpoint, neturl.PathEscape(userName), s.zone)
+	if provider != "" {
+		url += "&provider=" + neturl.QueryEscape(provider)
+	}
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
 	s.basicAuth(req)
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -30,7 +40,7 @@ func (s *Server) GetUser(userName string) (*User, error) {
 		return nil, err
 	}
 	if resp.StatusCode > 299 {
-		return nil, fmt.Errorf("Unexpected status code %d: %s", resp.StatusCode, body)
+		return nil, newStatusError(resp.StatusCode, body)
 	}
 	var userList UserList
 	if err := json.Unmarshal(body, &userList); err != nil {
@@ -42,10 +52,14 @@ func (s *Server) GetUser(userName string) (*User, error) {
 	return userList.Users[0], nil
 }
 
-func (s *Server) CreateUser(userName string) error {
+// CreateUser creates a local user, with the ownership marker in its gecos field.
+func (s *Server) CreateUser(userName string, owner Ownership) (err error) {
+	defer func() { s.audit(&audit.Record{Operation: "CreateUser", User: userName}, err) }()
+
 	data, err := json.Marshal(&User{
 		Name:    userName,
 		Enabled: true,
+		Gecos:   owner.String(),
 	})
 	if err != nil {
 		return err
@@ -57,7 +71,7 @@ func (s *Server) CreateUser(userName string) error {
 		return err
 	}
 	s.basicAuth(req)
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return err
 	}
@@ -67,21 +81,23 @@ func (s *Server) CreateUser(userName string) error {
 		return err
 	}
 	if resp.StatusCode > 299 {
-		return fmt.Errorf("Unexpected status code %d: %s", resp.StatusCode, body)
+		return newStatusError(resp.StatusCode, body)
 	}
 
-	log.InfoS("CreateUser success", "userName", userName)
+	s.logger().Info("CreateUser success", "userName", userName)
 	return nil
 }
 
-func (s *Server) DeleteUser(userName string) error {
-	url := fmt.Sprintf("%s/platform/14/auth/users/%s?zone=%s", s.apiEndpoint, userName, s.zone)
+func (s *Server) DeleteUser(userName string) (err error) {
+	defer func() { s.audit(&audit.Record{Operation: "DeleteUser", User: userName}, err) }()
+
+	url := fmt.Sprintf("%s/platform/14/auth/users/%s?zone=%s", s.apiEndpoint, neturl.PathEscape(userName), s.zone)
 	req, err := http.NewRequest(http.MethodDelete, url, nil)
 	if err != nil {
 		return err
 	}
 	s.basicAuth(req)
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return err
 	}
@@ -91,13 +107,13 @@ func (s *Server) DeleteUser(userName string) error {
 		return err
 	}
 	if resp.StatusCode == 404 {
-		log.InfoS("DeleteUser success (not found)", "userName", userName)
+		s.logger().Info("DeleteUser success (not found)", "userName", userName)
 		return nil
 	}
 	if resp.StatusCode > 299 {
-		return fmt.Errorf("Unexpected status code %d: %s", resp.StatusCode, body)
+		return newStatusError(resp.StatusCode, body)
 	}
 
-	log.InfoS("DeleteUser success", "userName", userName)
+	s.logger().Info("DeleteUser success", "userName", userName)
 	return nil
 }
@@ -0,0 +1,109 @@
+package provisioner
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/japannext/cosi-powerscale/pkg/broker"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+)
+
+// Authenticator issues and revokes the credentials of a BucketAccess for one
+// authentication type. The grant flow resolves the user and its ACLs, then
+// delegates the credentials to the authenticator of the requested type.
+type Authenticator interface {
+	// Grant returns the credentials allowing userName to access bucketName.
+	Grant(ctx context.Context, userName, bucketName string) (map[string]*cosi.CredentialDetails, error)
+	// Revoke invalidates every credential previously granted to userName.
+	// It must succeed when there is nothing to revoke.
+	Revoke(ctx context.Context, userName string) error
+	// Release stops managing the credentials of userName without
+	// invalidating them, for the users the driver does not own.
+	Release(ctx context.Context, userName string) error
+}
+
+// keyAuthenticator implements the KEY authentication type with static
+// S3 keys generated by OneFS.
+type keyAuthenticator struct {
+	powerscale *powerscale.Server
+}
+
+// Grant reuses the current key of the user, if any, so that retried grants
+// and users shared between BucketAccesses do not invalidate issued keys.
+func (a *keyAuthenticator) Grant(ctx context.Context, userName, bucketName string) (map[string]*cosi.CredentialDetails, error) {
+	server := a.powerscale.WithContext(ctx)
+	key, err := server.GetKey(userName)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil && key.SecretKey != "" {
+		accessKey := &iam.CreateAccessKeyOutput{AccessKey: &iam.AccessKey{
+			AccessKeyId:     &key.AccessID,
+			SecretAccessKey: &key.SecretKey,
+		}}
+		return assembleCredentials(accessKey, a.powerscale.S3Endpoint, userName, bucketName), nil
+	}
+
+	accessKey, err := server.CreateKey(userName)
+	if err != nil {
+		return nil, err
+	}
+	return assembleCredentials(accessKey, a.powerscale.S3Endpoint, userName, bucketName), nil
+}
+
+func (a *keyAuthenticator) Revoke(ctx context.Context, userName string) error {
+	server := a.powerscale.WithContext(ctx)
+	key, err := server.GetKey(userName)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return nil
+	}
+	return server.DeleteKey(userName)
+}
+
+// Release has nothing to do, static keys are not managed after the grant.
+func (a *keyAuthenticator) Release(ctx context.Context, userName string) error {
+	return nil
+}
+
+// brokerAuthenticator implements the KEY authentication type with short-lived
+// keys, refreshed by the credential broker. The key stored in the secret
+// expires after the broker TTL, pods fetch the current one from the broker.
+type brokerAuthenticator struct {
+	keyAuthenticator
+	broker *broker.Broker
+}
+
+// NewBrokerAuthenticator returns an Authenticator issuing keys through the broker.
+func NewBrokerAuthenticator(server *powerscale.Server, b *broker.Broker) Authenticator {
+	return &brokerAuthenticator{keyAuthenticator: keyAuthenticator{powerscale: server}, broker: b}
+}
+
+func (a *brokerAuthenticator) Grant(ctx context.Context, userName, bucketName string) (map[string]*cosi.CredentialDetails, error) {
+	creds, err := a.broker.Issue(userName)
+	if err != nil {
+		return nil, err
+	}
+	accessKey := &iam.CreateAccessKeyOutput{AccessKey: &iam.AccessKey{
+		AccessKeyId:     &creds.AccessKeyID,
+		SecretAccessKey: &creds.AccessSecretKey,
+	}}
+	return assembleCredentials(accessKey, a.powerscale.S3Endpoint, userName, bucketName), nil
+}
+
+func (a *brokerAuthenticator) Revoke(ctx context.Context, userName string) error {
+	if err := a.broker.Forget(ctx, userName); err != nil {
+		return err
+	}
+	return a.keyAuthenticator.Revoke(ctx, userName)
+}
+
+// Release stops the rotation of the key, which stays valid until the user
+// rotates or deletes it.
+func (a *brokerAuthenticator) Release(ctx context.Context, userName string) error {
+	return a.broker.Forget(ctx, userName)
+}
@@ -7,6 +7,8 @@ import (
 
 	log "k8s.io/klog/v2"
 	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+
+	"github.com/japannext/cosi-powerscale/pkg/audit"
 )
 
 // All errors that can be returned by DriverCreateBucket.
@@ -19,22 +21,31 @@ var (
 func (p *Provisioner) DriverCreateBucket(
 	ctx context.Context,
 	req *cosi.DriverCreateBucketRequest,
-) (*cosi.DriverCreateBucketResponse, error) {
+) (resp *cosi.DriverCreateBucketResponse, err error) {
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
+	logger := log.FromContext(ctx)
+	server := p.Powerscale.WithContext(ctx)
 	bucketName := req.GetName()
 
 	// Check if bucket name is not empty.
 	if bucketName == "" {
-		log.Errorf("empty bucket name", "action", "DriverCreateBucket", "bucket", bucketName)
+		logger.Error(ErrEmptyBucketName, "empty bucket name", "action", "DriverCreateBucket", "bucket", bucketName)
 		return nil, fmt.Errorf("Empty bucket name")
 	}
 
+	owner := p.bucketOwnership(ctx, bucketName)
+	defer func() {
+		p.recordOutcome(bucketClaimReference(owner), err,
+			ReasonBucketCreated, "Created bucket "+bucketName,
+			ReasonCreateBucketFailed, "Failed to create bucket "+bucketName)
+	}()
+
 	// Check if bucket exist
-	bucket, err := p.Powerscale.GetBucket(bucketName)
+	bucket, err := server.GetBucket(bucketName)
 	if err != nil {
-		log.ErrorS(err, "error attempting to fetch bucket", "action", "DriverCreateBucket", "bucket", bucketName)
+		logger.Error(err, "error attempting to fetch bucket", "action", "DriverCreateBucket", "bucket", bucketName)
 		return nil, err
 	}
 	if bucket != nil {
@@ -42,9 +53,10 @@ func (p *Provisioner) DriverCreateBucket(
 	}
 
 	// Create bucket.
-	err = p.Powerscale.CreateBucket(bucketName)
+	server = p.Powerscale.WithContext(audit.WithActor(ctx, bucketActor(bucketName, owner)))
+	err = server.CreateBucket(bucketName, owner)
 	if err != nil {
-		log.ErrorS(err, "error creating bucket", "action", "DriverCreateBucket", "bucket", bucketName)
+		logger.Error(err, "error creating bucket", "action", "DriverCreateBucket", "bucket", bucketName)
 		return nil, err
 	}
 
@@ -7,6 +7,9 @@ import (
 
 	log "k8s.io/klog/v2"
 	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+
+	"github.com/japannext/cosi-powerscale/pkg/audit"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
 )
 
 // All errors that can be returned by DriverDeleteBucket.
@@ -15,30 +18,64 @@ var ErrFailedToDeleteBucket = errors.New("bucket was not successfully deleted")
 // DriverDeleteBucket deletes Bucket on specific Object Storage Platform.
 func (p *Provisioner) DriverDeleteBucket(ctx context.Context,
 	req *cosi.DriverDeleteBucketRequest,
-) (*cosi.DriverDeleteBucketResponse, error) {
+) (resp *cosi.DriverDeleteBucketResponse, err error) {
+	logger := log.FromContext(ctx)
 
 	// Check if bucketID is not empty.
 	if req.GetBucketId() == "" {
-		log.Errorf("empty bucket ID", "action", "DriverDeleteBucket", "bucketID", req.BucketId)
+		logger.Error(ErrEmptyBucketID, "empty bucket ID", "action", "DriverDeleteBucket", "bucketID", req.BucketId)
 		return nil, fmt.Errorf("Empty bucket ID")
 	}
 
 	// Extract bucket name from bucketID.
 	bucketName, err := getBucketName(req.BucketId)
 	if err != nil {
-		log.ErrorS(err, "error extracting bucket name", "action", "DriverDeleteBucket", "bucketID", req.BucketId)
+		logger.Error(err, "error extracting bucket name", "action", "DriverDeleteBucket", "bucketID", req.BucketId)
 		return nil, err
 	}
 
+	// The claim of the bucket is read from its ownership marker, for the audit log.
+	var owner powerscale.Ownership
+	if bucket, err := p.Powerscale.WithContext(ctx).GetBucket(bucketName); err == nil && bucket != nil {
+		if marker := bucket.Ownership(); marker != nil {
+			owner = *marker
+		}
+	}
+	server := p.Powerscale.WithContext(audit.WithActor(ctx, bucketActor(bucketName, owner)))
+	defer func() {
+		p.recordOutcome(bucketClaimReference(owner), err,
+			ReasonBucketDeleted, "Deleted bucket "+bucketName,
+			ReasonDeleteBucketFailed, "Failed to delete bucket "+bucketName)
+	}()
+
 	// Delete the directory
-	if err := p.Powerscale.DeleteDirectoryForBucket(bucketName); err != nil {
-		log.ErrorS(err, "error deleting directory", "action", "DriverDeleteBucket", "bucketID", req.BucketId)
+	if err := server.DeleteDirectoryForBucket(bucketName); err != nil {
+		logger.Error(err, "error deleting directory", "action", "DriverDeleteBucket", "bucketID", req.BucketId)
 		return &cosi.DriverDeleteBucketResponse{}, err
 	}
 
 	// Delete bucket.
-	if err := p.Powerscale.DeleteBucket(bucketName); err != nil {
-		log.ErrorS(err, "error deleting bucket", "action", "DriverDeleteBucket", "bucketID", req.BucketId)
+	if err := server.DeleteBucket(bucketName); err != nil {
+		logger.Error(err, "error deleting bucket", "action", "DriverDeleteBucket", "bucketID", req.BucketId)
+		return &cosi.DriverDeleteBucketResponse{}, err
+	}
+
+	// Delete the group used by group-based ACLs, if any. Groups without the
+	// marker of the driver are not the driver's, or do not exist.
+	groupName := p.bucketGroupName(bucketName)
+	groupOwner, err := server.GetGroupOwnership(groupName)
+	if err != nil {
+		logger.Error(err, "error fetching group ownership", "action", "DriverDeleteBucket", "bucketID", req.BucketId, "groupName", groupName)
+		return &cosi.DriverDeleteBucketResponse{}, err
+	}
+	if !server.Owns(groupOwner) {
+		if groupOwner != nil {
+			logger.Info("group not owned by the driver, keeping it", "action", "DriverDeleteBucket", "bucketID", req.BucketId, "groupName", groupName)
+		}
+		return &cosi.DriverDeleteBucketResponse{}, nil
+	}
+	if err := server.DeleteGroup(groupName); err != nil {
+		logger.Error(err, "error deleting group", "action", "DriverDeleteBucket", "bucketID", req.BucketId, "groupName", groupName)
 		return &cosi.DriverDeleteBucketResponse{}, err
 	}
 
@@ -13,6 +13,12 @@ var (
 	ErrUnknownAuthenticationType        = errors.New("unknown authentication type")
 	ErrBucketNotFound                   = errors.New("bucket not found")
 	ErrFailedToCreateUser               = errors.New("failed to create user")
+	ErrEmptyUserName                    = errors.New("empty user name")
+	ErrUserNotFound                     = errors.New("user not found")
+	ErrInvalidACLGrantee                = errors.New("invalid ACL grantee type")
+	ErrInvalidPrefix                    = errors.New("invalid prefix")
+	ErrInvalidIdentityPrefix            = errors.New("invalid identity prefix")
+	ErrKubernetesUnavailable            = errors.New("kubernetes API unavailable")
 	ErrFailedToDecodePolicy             = errors.New("failed to decode bucket policy")
 	ErrFailedToUpdatePolicy             = errors.New("failed to update bucket policy")
 	ErrFailedToCreateAccessKey          = errors.New("failed to create access key")
@@ -0,0 +1,81 @@
+package provisioner
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/japannext/cosi-powerscale/pkg/events"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+	"github.com/japannext/cosi-powerscale/pkg/redact"
+)
+
+// Reasons of the events recorded on the BucketClaims and BucketAccesses.
+const (
+	ReasonBucketCreated      = "BucketCreated"
+	ReasonCreateBucketFailed = "CreateBucketFailed"
+	ReasonBucketDeleted      = "BucketDeleted"
+	ReasonDeleteBucketFailed = "DeleteBucketFailed"
+	ReasonAccessGranted      = "AccessGranted"
+	ReasonGrantAccessFailed  = "GrantAccessFailed"
+	ReasonAccessRevoked      = "AccessRevoked"
+	ReasonRevokeAccessFailed = "RevokeAccessFailed"
+	// Override the failure reasons of the errors the users can act on.
+	ReasonQuotaExceeded = "QuotaExceeded"
+	ReasonConflict      = "Conflict"
+)
+
+// recordOutcome records the outcome of an action on a BucketClaim or a
+// BucketAccess: a Normal event when err is nil, a Warning event with the
+// error otherwise.
+func (p *Provisioner) recordOutcome(object *corev1.ObjectReference, err error,
+	success, successMessage, failure, failureMessage string,
+) {
+	if err == nil {
+		p.Events.Eventf(object, corev1.EventTypeNormal, success, "%s", successMessage)
+		return
+	}
+	p.Events.Eventf(object, corev1.EventTypeWarning, failureReason(err, failure), "%s: %s", failureMessage, redact.String(err.Error()))
+}
+
+// failureReason returns the reason of the event of an error, the given
+// reason unless it is a quota or conflict error.
+func failureReason(err error, reason string) string {
+	var statusErr *powerscale.StatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode == http.StatusConflict:
+			return ReasonConflict
+		case statusErr.StatusCode == http.StatusInsufficientStorage,
+			strings.Contains(strings.ToLower(string(statusErr.Body)), "quota"):
+			return ReasonQuotaExceeded
+		}
+		return reason
+	}
+	switch status.Code(err) {
+	case codes.AlreadyExists, codes.Aborted:
+		return ReasonConflict
+	case codes.ResourceExhausted:
+		return ReasonQuotaExceeded
+	}
+	return reason
+}
+
+// bucketClaimReference returns the reference of the BucketClaim of a bucket,
+// or nil when it is unknown.
+func bucketClaimReference(owner powerscale.Ownership) *corev1.ObjectReference {
+	return events.BucketClaim(owner.ClaimNamespace, owner.ClaimName)
+}
+
+// bucketAccessReference returns the reference of a BucketAccess, or nil.
+func bucketAccessReference(bucketAccess *unstructured.Unstructured) *corev1.ObjectReference {
+	if bucketAccess == nil {
+		return nil
+	}
+	return events.BucketAccess(bucketAccess.GetNamespace(), bucketAccess.GetName(), bucketAccess.GetUID())
+}
@@ -0,0 +1,66 @@
+package provisioner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/japannext/cosi-powerscale/pkg/events"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+)
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{errors.New("connection refused"), ReasonCreateBucketFailed},
+		{&powerscale.StatusError{StatusCode: 500, Body: []byte(`{"errors":[{"message":"internal error"}]}`)}, ReasonCreateBucketFailed},
+		{&powerscale.StatusError{StatusCode: 409, Body: []byte(`{"errors":[{"message":"bucket already exists"}]}`)}, ReasonConflict},
+		{fmt.Errorf("wrapped: %w", &powerscale.StatusError{StatusCode: 409}), ReasonConflict},
+		{&powerscale.StatusError{StatusCode: 507}, ReasonQuotaExceeded},
+		{&powerscale.StatusError{StatusCode: 400, Body: []byte(`{"errors":[{"message":"Quota limit exceeded"}]}`)}, ReasonQuotaExceeded},
+		{status.Error(codes.ResourceExhausted, "too many keys"), ReasonQuotaExceeded},
+		{status.Error(codes.AlreadyExists, "exists"), ReasonConflict},
+		{status.Error(codes.InvalidArgument, "invalid"), ReasonCreateBucketFailed},
+	}
+	for _, test := range tests {
+		if got := failureReason(test.err, ReasonCreateBucketFailed); got != test.want {
+			t.Errorf("failureReason(%v) = %s, want %s", test.err, got, test.want)
+		}
+	}
+}
+
+func TestRecordOutcome(t *testing.T) {
+	recorder := &events.Fake{}
+	p := &Provisioner{Events: recorder}
+	claim := events.BucketClaim("default", "claim")
+
+	p.recordOutcome(claim, nil, ReasonBucketCreated, "Created bucket b", ReasonCreateBucketFailed, "Failed to create bucket b")
+	err := &powerscale.StatusError{StatusCode: 400, Body: []byte(`{"message":"invalid","password":"hunter2"}`)}
+	p.recordOutcome(claim, err, ReasonBucketCreated, "Created bucket b", ReasonCreateBucketFailed, "Failed to create bucket b")
+	p.recordOutcome(nil, err, ReasonBucketCreated, "Created bucket b", ReasonCreateBucketFailed, "Failed to create bucket b")
+
+	recorded := recorder.Events()
+	if len(recorded) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(recorded))
+	}
+	if recorded[0].Type != corev1.EventTypeNormal || recorded[0].Reason != ReasonBucketCreated {
+		t.Errorf("unexpected success event %+v", recorded[0])
+	}
+	failure := recorded[1]
+	if failure.Type != corev1.EventTypeWarning || failure.Reason != ReasonCreateBucketFailed {
+		t.Errorf("unexpected failure event %+v", failure)
+	}
+	if !strings.HasPrefix(failure.Message, "Failed to create bucket b: Unexpected status code 400") {
+		t.Errorf("unexpected failure message %q", failure.Message)
+	}
+	if strings.Contains(failure.Message, "hunter2") {
+		t.Errorf("failure message leaks a secret: %q", failure.Message)
+	}
+}
@@ -3,8 +3,15 @@ package provisioner
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/japannext/cosi-powerscale/pkg/audit"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/container-object-storage-interface-provisioner-sidecar/pkg/consts"
 
 	log "k8s.io/klog/v2"
@@ -12,6 +19,7 @@ import (
 )
 
 const (
+	// Maximum length of the names of the identities created by the driver.
 	maxUsernameLength = 64
 )
 
@@ -20,59 +28,212 @@ const (
 func (p *Provisioner) DriverGrantBucketAccess(
 	ctx context.Context,
 	req *cosi.DriverGrantBucketAccessRequest,
-) (*cosi.DriverGrantBucketAccessResponse, error) {
+) (resp *cosi.DriverGrantBucketAccessResponse, err error) {
+	logger := log.FromContext(ctx)
 
 	// Check if bucketID is not empty.
 	if req.GetBucketId() == "" {
-		log.Errorf("empty bucket ID", "action", "DriverGrantBucketAccess")
+		logger.Error(ErrEmptyBucketID, "empty bucket ID", "action", "DriverGrantBucketAccess")
 		return nil, fmt.Errorf("empty bucket ID")
 	}
 
 	// Check if bucket access name is not empty.
 	if req.GetName() == "" {
-		log.Errorf("empty bucket access name", "action", "DriverGrantBucketAccess", "bucketID", req.GetBucketId())
+		logger.Error(ErrEmptyBucketAccessName, "empty bucket access name", "action", "DriverGrantBucketAccess", "bucketID", req.GetBucketId())
 		return nil, fmt.Errorf("empty bucket access name")
 	}
 
+	params := p.accessParameters(req.GetParameters())
+
+	// Fetch the BucketAccess object for the details missing from the request.
+	// Failing to fetch it only fails the grant when the parameters of the
+	// class depend on it, the ownership marker is otherwise left without claim.
+	var bucketAccess *unstructured.Unstructured
+	if p.Kube != nil {
+		bucketAccess, err = p.findBucketAccess(ctx, req.GetName())
+		if err != nil {
+			if _, ok := params[ParamPrefix]; ok || params[ParamSharedIdentity] != "" {
+				logger.Error(err, "failed to fetch BucketAccess", "action", "DriverGrantBucketAccess", "bucketID", req.GetBucketId(), "bucketAccess", req.GetName())
+				return nil, err
+			}
+			logger.Error(err, "failed to fetch BucketAccess, ownership marker without claim", "action", "DriverGrantBucketAccess", "bucketID", req.GetBucketId(), "bucketAccess", req.GetName())
+		}
+	}
+	var bucketName string
+	defer func() {
+		p.recordOutcome(bucketAccessReference(bucketAccess), err,
+			ReasonAccessGranted, "Granted access to bucket "+bucketName,
+			ReasonGrantAccessFailed, "Failed to grant access to bucket "+bucketName)
+	}()
+
+	// Only authentication types with a registered Authenticator are supported.
+	auth, err := p.authenticator(req.GetAuthenticationType())
+	if err != nil {
+		logger.Error(err, "unsupported authentication type", "action", "DriverGrantBucketAccess", "bucketID", req.GetBucketId(), "authenticationType", req.GetAuthenticationType())
+		return nil, status.Errorf(codes.InvalidArgument, "%v, the BucketAccessClass must use authenticationType: KEY", err)
+	}
+
 	// Get bucket name from bucketID.
-	bucketName, err := getBucketName(req.GetBucketId())
+	bucketName, err = getBucketName(req.GetBucketId())
 	if err != nil {
-		log.ErrorS(err, "failed to convert bucket name", "action", "DriverGrantBucketAccess", "bucketID", req.GetBucketId())
+		logger.Error(err, "failed to convert bucket name", "action", "DriverGrantBucketAccess", "bucketID", req.GetBucketId())
 		return nil, err
 	}
 
-	// Equals to "ba-<uid>" with <uid> being the UID of the BucketAccess object.
-	userName := req.GetName()
-	user, err := p.Powerscale.GetUser(userName)
+	owner := p.accessOwnership(req.GetName(), bucketAccess)
+	ctx = audit.WithActor(ctx, accessActor(req.GetName(), bucketAccess))
+	server := p.Powerscale.WithContext(ctx)
+
+	prefix, err := grantPrefix(params, bucketAccess)
 	if err != nil {
-		log.ErrorS(err, "failed to fetch user", "action", "DriverGrantBucketAccess", "bucket", bucketName, "userName", userName)
+		logger.Error(err, "invalid prefix", "action", "DriverGrantBucketAccess", "bucket", bucketName, "bucketAccess", req.GetName())
 		return nil, err
 	}
 
-	// Create user
-	if user == nil {
-		if err := p.Powerscale.CreateUser(userName); err != nil {
-			log.ErrorS(err, "failed to create user", "action", "DriverGrantBucketAccess", "bucket", bucketName, "userName", userName)
-			return nil, fmt.Errorf("failed while creating user %s: %w", userName, err)
+	// Equals to "<prefix>ba-<uid>" with <uid> being the UID of the BucketAccess object.
+	userName := p.identityName(req.GetName())
+	// Creates the user of the grant, if the driver manages it.
+	ensure := func() error { return p.ensureUser(server, userName, owner) }
+	if provider := params[ParamAuthProvider]; provider != "" {
+		// Map the BucketAccess to an existing user of the provider.
+		userName = params[ParamUserName]
+		if userName == "" {
+			logger.Error(ErrEmptyUserName, "missing parameter", "action", "DriverGrantBucketAccess", "bucket", bucketName, "parameter", ParamUserName)
+			return nil, status.Errorf(codes.InvalidArgument, "parameter %s is required when %s is set", ParamUserName, ParamAuthProvider)
+		}
+		user, err := server.FindUser(userName, provider)
+		if err != nil {
+			logger.Error(err, "failed to fetch user", "action", "DriverGrantBucketAccess", "bucket", bucketName, "userName", userName, "provider", provider)
+			return nil, err
+		}
+		if user == nil {
+			logger.Error(ErrUserNotFound, "user not found in provider", "action", "DriverGrantBucketAccess", "bucket", bucketName, "userName", userName, "provider", provider)
+			return nil, status.Errorf(codes.NotFound, "user %s not found in provider %s", userName, provider)
 		}
+		userName = user.Name
+		ensure = func() error { return nil }
+	} else if identity := params[ParamSharedIdentity]; identity != "" {
+		// Share one user between the BucketAccesses of the namespace.
+		if bucketAccess == nil {
+			logger.Error(ErrKubernetesUnavailable, "failed to resolve namespace", "action", "DriverGrantBucketAccess", "bucket", bucketName, "bucketAccess", req.GetName())
+			return nil, status.Errorf(codes.FailedPrecondition, "parameter %s requires access to the Kubernetes API", ParamSharedIdentity)
+		}
+		userName = p.identityName(fmt.Sprintf("%s-%s", identity, bucketAccess.GetNamespace()))
+		// The user is not tied to a single BucketAccess.
+		owner.UID = ""
 	}
 
-	if err := p.Powerscale.EnsureACL(bucketName, userName, "FULL_CONTROL"); err != nil {
-		log.ErrorS(err, "failed to add ACL", "action", "DriverGrantBucketAccess", "bucket", bucketName, "userName", userName)
-		return nil, err
+	// The BucketAccesses granted a user are recorded, as the revoke request
+	// only names the user and the bucket.
+	if err := server.AcquireIdentity(userName, bucketName, req.GetName(), ensure); err != nil {
+		logger.Error(err, "failed to acquire identity", "action", "DriverGrantBucketAccess", "bucket", bucketName, "userName", userName)
+		return nil, fmt.Errorf("failed while creating user %s: %w", userName, err)
+	}
+
+	// A bucket ACL grants access to the whole bucket, prefix-scoped access
+	// is only granted by the bucket policy.
+	switch granteeType := params[ParamACLGrantee]; {
+	case prefix != "" && granteeType == ACLGranteeGroup:
+		logger.Error(ErrInvalidPrefix, "invalid parameter", "action", "DriverGrantBucketAccess", "bucket", bucketName, "parameter", ParamACLGrantee, "value", granteeType)
+		return nil, status.Errorf(codes.InvalidArgument, "%s %q cannot be used with %s", ParamACLGrantee, granteeType, ParamPrefix)
+	case prefix != "":
+		logger.Info("prefix-scoped access, skipping bucket ACL", "action", "DriverGrantBucketAccess", "bucket", bucketName, "userName", userName, "prefix", prefix)
+	case granteeType == "", granteeType == ACLGranteeUser:
+		grantee := powerscale.AclUser{Type: powerscale.GranteeUser, Name: userName}
+		if err := server.EnsureACL(bucketName, grantee, "FULL_CONTROL"); err != nil {
+			logger.Error(err, "failed to add ACL", "action", "DriverGrantBucketAccess", "bucket", bucketName, "userName", userName)
+			return nil, err
+		}
+	case granteeType == ACLGranteeGroup:
+		groupName := p.bucketGroupName(bucketName)
+		if err := server.EnsureGroup(groupName, p.Powerscale.NewOwnership("", "", "")); err != nil {
+			logger.Error(err, "failed to create group", "action", "DriverGrantBucketAccess", "bucket", bucketName, "groupName", groupName)
+			return nil, err
+		}
+		grantee := powerscale.AclUser{Type: powerscale.GranteeGroup, Name: groupName}
+		if err := server.EnsureACL(bucketName, grantee, "FULL_CONTROL"); err != nil {
+			logger.Error(err, "failed to add ACL", "action", "DriverGrantBucketAccess", "bucket", bucketName, "groupName", groupName)
+			return nil, err
+		}
+		if err := server.AddGroupMember(groupName, userName); err != nil {
+			logger.Error(err, "failed to add group member", "action", "DriverGrantBucketAccess", "bucket", bucketName, "groupName", groupName, "userName", userName)
+			return nil, err
+		}
+	default:
+		logger.Error(ErrInvalidACLGrantee, "invalid parameter", "action", "DriverGrantBucketAccess", "bucket", bucketName, "parameter", ParamACLGrantee, "value", granteeType)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid %s %q, expected %q or %q", ParamACLGrantee, granteeType, ACLGranteeUser, ACLGranteeGroup)
 	}
 
-	// Create Key
-	accessKey, err := p.Powerscale.CreateKey(userName)
+	if params[ParamBucketPolicy] == "true" || prefix != "" {
+		statements := powerscale.NewPolicyStatements(powerscale.PolicyStatementID(req.GetName()), bucketName, userName,
+			prefix, policyActions(params))
+		if err := server.EnsurePolicyStatements(bucketName, statements...); err != nil {
+			logger.Error(err, "failed to update bucket policy", "action", "DriverGrantBucketAccess", "bucket", bucketName, "userName", userName)
+			return nil, fmt.Errorf("%w: %w", ErrFailedToUpdatePolicy, err)
+		}
+	}
+
+	credentials, err := auth.Grant(ctx, userName, bucketName)
 	if err != nil {
-		log.ErrorS(err, "failed to create s3 key", "action", "DriverGrantBucketAccess", "bucket", bucketName, "userName", userName)
+		logger.Error(err, "failed to grant credentials", "action", "DriverGrantBucketAccess", "bucket", bucketName, "userName", userName, "authenticationType", req.GetAuthenticationType())
 		return nil, err
 	}
 
-	credentials := assembleCredentials(accessKey, p.Powerscale.S3Endpoint, userName, bucketName)
 	return &cosi.DriverGrantBucketAccessResponse{AccountId: userName, Credentials: credentials}, nil
 }
 
+// ensureUser creates the local user if it does not exist yet.
+func (p *Provisioner) ensureUser(server *powerscale.Server, userName string, owner powerscale.Ownership) error {
+	user, err := server.GetUser(userName)
+	if err != nil {
+		return err
+	}
+	if user != nil {
+		return nil
+	}
+	return server.CreateUser(userName, owner)
+}
+
+// findBucketAccess returns the BucketAccess granted the account "ba-<uid>",
+// whose namespace and metadata are not part of the COSI request.
+func (p *Provisioner) findBucketAccess(ctx context.Context, accountName string) (*unstructured.Unstructured, error) {
+	uid := strings.TrimPrefix(accountName, consts.AccountNamePrefix)
+	bucketAccess, err := p.Kube.FindBucketAccess(ctx, types.UID(uid))
+	if err != nil {
+		return nil, err
+	}
+	if bucketAccess == nil {
+		return nil, status.Errorf(codes.NotFound, "BucketAccess with UID %s not found", uid)
+	}
+	return bucketAccess, nil
+}
+
+// grantPrefix returns the key prefix the grant is limited to, if any. The
+// PrefixAnnotation of the BucketAccess narrows the class ParamPrefix to one of
+// its sub-prefixes.
+func grantPrefix(params map[string]string, bucketAccess *unstructured.Unstructured) (string, error) {
+	prefix := strings.Trim(params[ParamPrefix], "/")
+	if err := validatePrefix(prefix); err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if bucketAccess == nil {
+		return prefix, nil
+	}
+	value, ok := bucketAccess.GetAnnotations()[PrefixAnnotation]
+	if !ok {
+		return prefix, nil
+	}
+	narrowed := strings.Trim(value, "/")
+	if err := validatePrefix(narrowed); err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if prefix != "" && narrowed != prefix && !strings.HasPrefix(narrowed, prefix+"/") {
+		return "", status.Errorf(codes.InvalidArgument, "%v %q: annotation %s must be within the prefix %q of the class",
+			ErrInvalidPrefix, value, PrefixAnnotation, prefix)
+	}
+	return narrowed, nil
+}
+
 // assembleCredentials assembles credentials details and adds them to the credentialRepo.
 func assembleCredentials(
 	accessKey *iam.CreateAccessKeyOutput,
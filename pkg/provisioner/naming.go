@@ -0,0 +1,44 @@
+package provisioner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/japannext/cosi-powerscale/pkg/config"
+)
+
+// Length of the hash suffix of shortened identity names.
+const nameHashLength = 8
+
+// identityPrefix returns the prefix of every identity created by the driver,
+// so that several driver instances can share a zone. It defaults to
+// `<name>-`, see config.ValidateIdentityPrefix for the configured ones.
+func identityPrefix(name, prefix string) (string, error) {
+	if prefix == "" {
+		prefix = name + "-"
+	}
+	if err := config.ValidateIdentityPrefix(name, prefix); err != nil {
+		return "", fmt.Errorf("%w %q: %w", ErrInvalidIdentityPrefix, prefix, err)
+	}
+	return prefix, nil
+}
+
+// identityName returns the name of an identity (user or group) created by the
+// driver. Names longer than maxUsernameLength are truncated and suffixed with
+// a hash of the full name, so that they stay unique and deterministic.
+func (p *Provisioner) identityName(name string) string {
+	fullName := p.identityPrefix + name
+	if len(fullName) <= maxUsernameLength {
+		return fullName
+	}
+	sum := sha256.Sum256([]byte(fullName))
+	suffix := "-" + hex.EncodeToString(sum[:])[:nameHashLength]
+	return fullName[:maxUsernameLength-len(suffix)] + suffix
+}
+
+// bucketGroupName returns the name of the driver-owned group granted access
+// to a bucket when group-based ACLs are used.
+func (p *Provisioner) bucketGroupName(bucketName string) string {
+	return p.identityName("grp-" + bucketName)
+}
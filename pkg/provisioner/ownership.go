@@ -0,0 +1,63 @@
+package provisioner
+
+import (
+	"context"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	log "k8s.io/klog/v2"
+	"sigs.k8s.io/container-object-storage-interface-provisioner-sidecar/pkg/consts"
+
+	"github.com/japannext/cosi-powerscale/pkg/audit"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+)
+
+// bucketOwnership returns the ownership marker of a new bucket. The claim
+// is read from the Bucket object when the Kubernetes API is available.
+func (p *Provisioner) bucketOwnership(ctx context.Context, bucketName string) powerscale.Ownership {
+	if p.Kube == nil {
+		return p.Powerscale.NewOwnership("", "", "")
+	}
+	bucket, err := p.Kube.GetBucket(ctx, bucketName)
+	if err != nil || bucket == nil {
+		log.FromContext(ctx).Error(err, "failed to fetch Bucket, ownership marker without claim", "bucket", bucketName)
+		return p.Powerscale.NewOwnership("", "", "")
+	}
+	namespace, _, _ := unstructured.NestedString(bucket.Object, "spec", "bucketClaim", "namespace")
+	name, _, _ := unstructured.NestedString(bucket.Object, "spec", "bucketClaim", "name")
+	return p.Powerscale.NewOwnership(string(bucket.GetUID()), namespace, name)
+}
+
+// accessOwnership returns the ownership marker of the user of a BucketAccess.
+func (p *Provisioner) accessOwnership(accountName string, bucketAccess *unstructured.Unstructured) powerscale.Ownership {
+	uid := strings.TrimPrefix(accountName, consts.AccountNamePrefix)
+	if bucketAccess == nil {
+		return p.Powerscale.NewOwnership(uid, "", "")
+	}
+	claimName, _, _ := unstructured.NestedString(bucketAccess.Object, "spec", "bucketClaimName")
+	return p.Powerscale.NewOwnership(uid, bucketAccess.GetNamespace(), claimName)
+}
+
+// bucketActor returns the actor of the operations on a bucket in the audit
+// log: its BucketClaim, or the bucket when the claim is unknown.
+func bucketActor(bucketName string, owner powerscale.Ownership) *audit.Actor {
+	if owner.ClaimName == "" {
+		return &audit.Actor{Kind: audit.KindBucket, Name: bucketName, UID: owner.UID}
+	}
+	return &audit.Actor{Kind: audit.KindBucketClaim, Namespace: owner.ClaimNamespace, Name: owner.ClaimName}
+}
+
+// accessActor returns the actor of the operations of a BucketAccess in the
+// audit log.
+func accessActor(accountName string, bucketAccess *unstructured.Unstructured) *audit.Actor {
+	actor := &audit.Actor{
+		Kind:      audit.KindBucketAccess,
+		UID:       strings.TrimPrefix(accountName, consts.AccountNamePrefix),
+		AccountID: accountName,
+	}
+	if bucketAccess != nil {
+		actor.Namespace = bucketAccess.GetNamespace()
+		actor.Name = bucketAccess.GetName()
+	}
+	return actor
+}
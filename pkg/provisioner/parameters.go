@@ -0,0 +1,91 @@
+package provisioner
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// Parameters that can be set on a BucketAccessClass.
+const (
+	// ParamAuthProvider names an existing OneFS auth provider of the zone
+	// (e.g. `lsa-activedirectory-provider:CORP.EXAMPLE.COM`). When set, the
+	// grant maps the BucketAccess to an existing user of that provider
+	// instead of creating a local user.
+	ParamAuthProvider = "authProvider"
+	// ParamUserName is the name of the existing user to resolve in the
+	// provider given by ParamAuthProvider.
+	ParamUserName = "userName"
+	// ParamACLGrantee selects how the bucket ACL is granted: `user` (default)
+	// adds an ACL entry for the user, `group` adds the user to a driver-owned
+	// group of the bucket, which holds the ACL entry.
+	ParamACLGrantee = "aclGrantee"
+	// ParamSharedIdentity makes every BucketAccess of a namespace using the
+	// class share the user `<sharedIdentity>-<namespace>` and its key. The
+	// user is deleted once its last bucket grant is revoked.
+	ParamSharedIdentity = "sharedIdentity"
+	// ParamBucketPolicy set to `true` adds a statement for each BucketAccess
+	// to the bucket policy, in addition to the ACL.
+	ParamBucketPolicy = "bucketPolicy"
+	// ParamPolicyActions is a comma-separated list of the S3 actions allowed
+	// by the policy statement. Defaults to `s3:*`.
+	ParamPolicyActions = "policyActions"
+	// ParamPrefix limits the grant to a key prefix of the bucket: object
+	// actions on `<prefix>/*` and ListBucket on that prefix. It implies
+	// ParamBucketPolicy, and no bucket ACL is granted.
+	ParamPrefix = "prefix"
+)
+
+// PrefixAnnotation on a BucketAccess narrows the ParamPrefix of its class to
+// a sub-prefix. It is only read when the class sets ParamPrefix, possibly
+// empty to start from the whole bucket.
+const PrefixAnnotation = "powerscale.cosi.japannext.co.jp/prefix"
+
+const defaultPolicyAction = "s3:*"
+
+// policyActions parses ParamPolicyActions.
+func policyActions(parameters map[string]string) []string {
+	actions := []string{}
+	for _, action := range strings.Split(parameters[ParamPolicyActions], ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			actions = append(actions, action)
+		}
+	}
+	if len(actions) == 0 {
+		actions = append(actions, defaultPolicyAction)
+	}
+	return actions
+}
+
+// Values of ParamACLGrantee.
+const (
+	ACLGranteeUser  = "user"
+	ACLGranteeGroup = "group"
+)
+
+// validatePrefix checks a key prefix, already trimmed of its slashes.
+func validatePrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	if strings.ContainsAny(prefix, "*?$") {
+		return fmt.Errorf("%w %q: wildcards are not allowed", ErrInvalidPrefix, prefix)
+	}
+	for _, segment := range strings.Split(prefix, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("%w %q: empty, . and .. path segments are not allowed", ErrInvalidPrefix, prefix)
+		}
+	}
+	return nil
+}
+
+// accessParameters returns the parameters of a BucketAccessClass, on top of
+// the defaults of the configuration.
+func (p *Provisioner) accessParameters(params map[string]string) map[string]string {
+	if len(p.defaultParameters) == 0 {
+		return params
+	}
+	merged := maps.Clone(p.defaultParameters)
+	maps.Copy(merged, params)
+	return merged
+}
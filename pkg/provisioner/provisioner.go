@@ -5,7 +5,10 @@ import (
 	"time"
 
 	"github.com/japannext/cosi-powerscale/pkg/config"
+	"github.com/japannext/cosi-powerscale/pkg/events"
+	"github.com/japannext/cosi-powerscale/pkg/kube"
 	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
 )
 
 const (
@@ -14,12 +17,51 @@ const (
 
 type Provisioner struct {
 	Powerscale *powerscale.Server
+	// Authenticators by supported authentication type.
+	Authenticators map[cosi.AuthenticationType]Authenticator
+	// Kubernetes API client, nil when running outside of a cluster.
+	Kube *kube.Client
+	// Records the outcome of the requests on the BucketClaims and BucketAccesses.
+	Events events.Recorder
+	// Prefix of the names of the users and groups created by the driver.
+	identityPrefix string
+	// Defaults of the BucketAccessClass parameters.
+	defaultParameters map[string]string
 }
 
-func New(cfg *config.Config) *Provisioner {
+func New(cfg *config.Config, kubeClient *kube.Client) (*Provisioner, error) {
+	prefix, err := identityPrefix(cfg.Name, cfg.IdentityPrefix)
+	if err != nil {
+		return nil, err
+	}
+	server := powerscale.New(cfg)
 	return &Provisioner{
-		Powerscale: powerscale.New(cfg),
+		Powerscale:        server,
+		Kube:              kubeClient,
+		Events:            events.Discard{},
+		identityPrefix:    prefix,
+		defaultParameters: cfg.AccessParameters,
+		Authenticators: map[cosi.AuthenticationType]Authenticator{
+			cosi.AuthenticationType_Key: &keyAuthenticator{powerscale: server},
+		},
+	}, nil
+}
+
+// authenticator returns the Authenticator handling the authentication type.
+func (p *Provisioner) authenticator(authType cosi.AuthenticationType) (Authenticator, error) {
+	switch authType {
+	case cosi.AuthenticationType_Key, cosi.AuthenticationType_IAM:
+		// Supported by the COSI spec.
+	case cosi.AuthenticationType_UnknownAuthenticationType:
+		return nil, ErrUnknownAuthenticationType
+	default:
+		return nil, ErrInvalidAuthenticationType
+	}
+	auth, ok := p.Authenticators[authType]
+	if !ok {
+		return nil, ErrAuthenticationTypeNotImplemented
 	}
+	return auth, nil
 }
 
 func (p *Provisioner) ID() string {
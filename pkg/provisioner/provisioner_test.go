@@ -0,0 +1,971 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/container-object-storage-interface-provisioner-sidecar/pkg/consts"
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+
+	"github.com/japannext/cosi-powerscale/pkg/audit"
+	"github.com/japannext/cosi-powerscale/pkg/broker"
+	"github.com/japannext/cosi-powerscale/pkg/kube"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale/fake"
+)
+
+const adProvider = "lsa-activedirectory-provider:CORP.EXAMPLE.COM"
+
+func newTestProvisioner(t *testing.T) (*fake.Server, *Provisioner) {
+	t.Helper()
+	server := fake.NewServer()
+	t.Cleanup(server.Close)
+	p, err := New(server.Config(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, p
+}
+
+// newBucketAccess returns a BucketAccess object granted the account "ba-<uid>".
+func newBucketAccess(namespace, name, uid string) *unstructured.Unstructured {
+	bucketAccess := &unstructured.Unstructured{}
+	bucketAccess.SetAPIVersion("objectstorage.k8s.io/v1alpha1")
+	bucketAccess.SetKind("BucketAccess")
+	bucketAccess.SetNamespace(namespace)
+	bucketAccess.SetName(name)
+	bucketAccess.SetUID(types.UID(uid))
+	return bucketAccess
+}
+
+// newTestKube returns a Kubernetes client serving the given objects.
+func newTestKube(objects ...runtime.Object) *kube.Client {
+	listKinds := map[schema.GroupVersionResource]string{
+		kube.BucketAccessResource: "BucketAccessList",
+		kube.BucketResource:       "BucketList",
+	}
+	return &kube.Client{Dynamic: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...)}
+}
+
+func TestBucketLifecycle(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	ctx := context.Background()
+
+	created, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.GetBucketId() != "fake-bucket-1" || server.Bucket("bucket-1") == nil {
+		t.Fatalf("unexpected bucket %s", created.GetBucketId())
+	}
+
+	granted, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+		BucketId:           created.GetBucketId(),
+		Name:               "ba-1234",
+		AuthenticationType: cosi.AuthenticationType_Key,
+		Parameters:         map[string]string{ParamBucketPolicy: "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userName := granted.GetAccountId()
+	if userName != "fake-ba-1234" || server.User(userName) == nil {
+		t.Fatalf("unexpected account %s", userName)
+	}
+	secrets := granted.GetCredentials()[consts.S3Key].GetSecrets()
+	if key := server.Key(userName); key == nil || secrets[consts.S3SecretAccessKeyID] != key.AccessID {
+		t.Errorf("unexpected credentials %v", secrets)
+	}
+	if acl := server.Bucket("bucket-1").Acl; len(acl) != 1 || acl[0].Grantee.Name != userName {
+		t.Errorf("unexpected ACL %+v", acl)
+	}
+	if policy := server.BucketPolicy("bucket-1"); policy == nil || len(policy.Statement) != 1 {
+		t.Errorf("unexpected policy %+v", policy)
+	}
+
+	if _, err := p.DriverRevokeBucketAccess(ctx, &cosi.DriverRevokeBucketAccessRequest{
+		BucketId:  created.GetBucketId(),
+		AccountId: userName,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if server.User(userName) != nil || server.Key(userName) != nil {
+		t.Error("the user and its key must be deleted")
+	}
+	if acl := server.Bucket("bucket-1").Acl; len(acl) != 0 {
+		t.Errorf("unexpected ACL %+v", acl)
+	}
+	if policy := server.BucketPolicy("bucket-1"); policy != nil {
+		t.Errorf("unexpected policy %+v", policy)
+	}
+
+	if _, err := p.DriverDeleteBucket(ctx, &cosi.DriverDeleteBucketRequest{BucketId: created.GetBucketId()}); err != nil {
+		t.Fatal(err)
+	}
+	if server.Bucket("bucket-1") != nil || server.Exists(fake.BasePath+"/bucket-1") {
+		t.Error("the bucket and its directory must be deleted")
+	}
+}
+
+func TestOwnershipMarkers(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	bucket := &unstructured.Unstructured{}
+	bucket.SetAPIVersion("objectstorage.k8s.io/v1alpha1")
+	bucket.SetKind("Bucket")
+	bucket.SetName("bucket-1")
+	bucket.SetUID("bucket-uid")
+	_ = unstructured.SetNestedField(bucket.Object, "app-ns", "spec", "bucketClaim", "namespace")
+	_ = unstructured.SetNestedField(bucket.Object, "claim-1", "spec", "bucketClaim", "name")
+	bucketAccess := newBucketAccess("app-ns", "access-1", "1234")
+	_ = unstructured.SetNestedField(bucketAccess.Object, "claim-1", "spec", "bucketClaimName")
+	p.Kube = newTestKube(bucket, bucketAccess)
+	ctx := context.Background()
+
+	if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	owner := server.Bucket("bucket-1").Ownership()
+	if !p.Powerscale.Owns(owner) || owner.UID != "bucket-uid" || owner.ClaimNamespace != "app-ns" || owner.ClaimName != "claim-1" {
+		t.Errorf("unexpected bucket ownership %+v", owner)
+	}
+	owner, err := p.Powerscale.GetDirectoryOwnership(fake.BasePath + "/bucket-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Powerscale.Owns(owner) || owner.UID != "bucket-uid" {
+		t.Errorf("unexpected directory ownership %+v", owner)
+	}
+
+	granted, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+		BucketId:           "fake-bucket-1",
+		Name:               "ba-1234",
+		AuthenticationType: cosi.AuthenticationType_Key,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner = server.User(granted.GetAccountId()).Ownership()
+	if !p.Powerscale.Owns(owner) || owner.UID != "1234" || owner.ClaimNamespace != "app-ns" || owner.ClaimName != "claim-1" {
+		t.Errorf("unexpected user ownership %+v", owner)
+	}
+
+	// Another driver instance does not own the objects.
+	other := powerscale.New(server.Config())
+	other.Name = "other"
+	if other.Owns(owner) {
+		t.Error("the objects must only be owned by the driver instance which created them")
+	}
+}
+
+// The changes are recorded in the audit log with the BucketClaim or the
+// BucketAccess they were made for.
+func TestAuditActors(t *testing.T) {
+	server := fake.NewServer()
+	t.Cleanup(server.Close)
+	cfg := server.Config()
+	cfg.AuditLog = filepath.Join(t.TempDir(), "audit.log")
+	p, err := New(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket := &unstructured.Unstructured{}
+	bucket.SetAPIVersion("objectstorage.k8s.io/v1alpha1")
+	bucket.SetKind("Bucket")
+	bucket.SetName("bucket-1")
+	_ = unstructured.SetNestedField(bucket.Object, "app-ns", "spec", "bucketClaim", "namespace")
+	_ = unstructured.SetNestedField(bucket.Object, "claim-1", "spec", "bucketClaim", "name")
+	p.Kube = newTestKube(bucket, newBucketAccess("app-ns", "access-1", "1234"))
+	ctx := context.Background()
+
+	if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+		BucketId:           "fake-bucket-1",
+		Name:               "ba-1234",
+		AuthenticationType: cosi.AuthenticationType_Key,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DriverDeleteBucket(ctx, &cosi.DriverDeleteBucketRequest{BucketId: "fake-bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	claim := audit.Actor{Kind: audit.KindBucketClaim, Namespace: "app-ns", Name: "claim-1"}
+	access := audit.Actor{Kind: audit.KindBucketAccess, Namespace: "app-ns", Name: "access-1", UID: "1234", AccountID: "ba-1234"}
+	expected := map[string]audit.Actor{
+		"CreateBucket": claim,
+		"CreateUser":   access,
+		"EnsureACL":    access,
+		"DeleteBucket": claim,
+	}
+	data, err := os.ReadFile(cfg.AuditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record audit.Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid audit line %q: %v", line, err)
+		}
+		if record.Actor == nil {
+			t.Errorf("%s recorded without an actor", record.Operation)
+			continue
+		}
+		if actor, ok := expected[record.Operation]; ok {
+			if *record.Actor != actor {
+				t.Errorf("%s: unexpected actor %+v", record.Operation, *record.Actor)
+			}
+			delete(expected, record.Operation)
+		}
+	}
+	if len(expected) != 0 {
+		t.Errorf("missing audit records %v", expected)
+	}
+}
+
+func TestCreateBucketFailure(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	server.Inject(fake.Fault{Method: http.MethodPost, Path: "/platform/14/protocols/s3/buckets", StatusCode: http.StatusServiceUnavailable, Times: 1})
+
+	_, err := p.DriverCreateBucket(context.Background(), &cosi.DriverCreateBucketRequest{Name: "bucket-1"})
+	var statusErr *powerscale.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected a 503, got %v", err)
+	}
+	// The sidecar retries the creation.
+	if _, err := p.DriverCreateBucket(context.Background(), &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGrantMappedUser(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	ctx := context.Background()
+	server.AddUser(powerscale.User{Name: "alice", Enabled: true, Provider: adProvider})
+
+	if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+		BucketId:           "fake-bucket-1",
+		Name:               "ba-1",
+		AuthenticationType: cosi.AuthenticationType_Key,
+		Parameters:         map[string]string{ParamAuthProvider: fake.LocalProvider, ParamUserName: "alice"},
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected the user to be looked up in the provider, got %v", err)
+	}
+	_, err = p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+		BucketId:           "fake-bucket-1",
+		Name:               "ba-1",
+		AuthenticationType: cosi.AuthenticationType_Key,
+		Parameters:         map[string]string{ParamAuthProvider: adProvider},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected the missing user name to be rejected, got %v", err)
+	}
+
+	granted, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+		BucketId:           "fake-bucket-1",
+		Name:               "ba-1",
+		AuthenticationType: cosi.AuthenticationType_Key,
+		Parameters:         map[string]string{ParamAuthProvider: adProvider, ParamUserName: "alice"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if granted.GetAccountId() != "alice" || server.User("fake-ba-1") != nil {
+		t.Fatalf("unexpected account %s", granted.GetAccountId())
+	}
+	if acl := server.Bucket("bucket-1").Acl; len(acl) != 1 || acl[0].Grantee.Name != "alice" {
+		t.Errorf("unexpected ACL %+v", acl)
+	}
+
+	if _, err := p.DriverRevokeBucketAccess(ctx, &cosi.DriverRevokeBucketAccessRequest{
+		BucketId:  "fake-bucket-1",
+		AccountId: "alice",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if server.User("alice") == nil {
+		t.Error("the mapped user must be kept")
+	}
+	if acl := server.Bucket("bucket-1").Acl; len(acl) != 0 {
+		t.Errorf("unexpected ACL %+v", acl)
+	}
+}
+
+func TestGrantGroupACL(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	ctx := context.Background()
+
+	if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ba-1", "ba-2"} {
+		if _, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+			BucketId:           "fake-bucket-1",
+			Name:               name,
+			AuthenticationType: cosi.AuthenticationType_Key,
+			Parameters:         map[string]string{ParamACLGrantee: ACLGranteeGroup},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	groupName := p.bucketGroupName("bucket-1")
+	if members := server.GroupMembers(groupName); len(members) != 2 {
+		t.Errorf("unexpected members %v", members)
+	}
+	if owner, err := p.Powerscale.GetGroupOwnership(groupName); err != nil || !p.Powerscale.Owns(owner) {
+		t.Errorf("expected the group to be owned, got %+v, %v", owner, err)
+	}
+	if acl := server.Bucket("bucket-1").Acl; len(acl) != 1 || acl[0].Grantee.Type != powerscale.GranteeGroup {
+		t.Errorf("unexpected ACL %+v", acl)
+	}
+
+	if _, err := p.DriverRevokeBucketAccess(ctx, &cosi.DriverRevokeBucketAccessRequest{
+		BucketId:  "fake-bucket-1",
+		AccountId: "fake-ba-1",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if members := server.GroupMembers(groupName); len(members) != 1 || members[0] != "fake-ba-2" {
+		t.Errorf("unexpected members %v", members)
+	}
+	// The group keeps the ACL entry of the remaining members.
+	if acl := server.Bucket("bucket-1").Acl; len(acl) != 1 {
+		t.Errorf("unexpected ACL %+v", acl)
+	}
+
+	if _, err := p.DriverDeleteBucket(ctx, &cosi.DriverDeleteBucketRequest{BucketId: "fake-bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if members := server.GroupMembers(groupName); members != nil {
+		t.Errorf("the group must be deleted, got members %v", members)
+	}
+}
+
+// A group named after the bucket, but created by another driver instance,
+// is kept when the bucket is deleted.
+func TestDeleteBucketForeignGroup(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	ctx := context.Background()
+
+	if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	other := powerscale.New(server.Config())
+	other.Name = "other"
+	groupName := p.bucketGroupName("bucket-1")
+	if err := other.CreateGroup(groupName, other.NewOwnership("", "", "")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.DriverDeleteBucket(ctx, &cosi.DriverDeleteBucketRequest{BucketId: "fake-bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if server.GroupMembers(groupName) == nil {
+		t.Error("the group of the other instance must be kept")
+	}
+}
+
+// The parameters of the class override the defaults of the config file.
+func TestGrantDefaultParameters(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	p.defaultParameters = map[string]string{ParamACLGrantee: ACLGranteeGroup, ParamBucketPolicy: "true"}
+	ctx := context.Background()
+
+	if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	for name, params := range map[string]map[string]string{
+		"ba-1": nil,
+		"ba-2": {ParamACLGrantee: ACLGranteeUser},
+	} {
+		if _, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+			BucketId:           "fake-bucket-1",
+			Name:               name,
+			AuthenticationType: cosi.AuthenticationType_Key,
+			Parameters:         params,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if members := server.GroupMembers(p.bucketGroupName("bucket-1")); len(members) != 1 || members[0] != "fake-ba-1" {
+		t.Errorf("unexpected members %v", members)
+	}
+	if acl := server.Bucket("bucket-1").Acl; len(acl) != 2 {
+		t.Errorf("unexpected ACL %+v", acl)
+	}
+	if policy := server.BucketPolicy("bucket-1"); policy == nil || len(policy.Statement) != 2 {
+		t.Errorf("unexpected policy %+v", policy)
+	}
+	if p.defaultParameters[ParamACLGrantee] != ACLGranteeGroup {
+		t.Error("the defaults must not be modified")
+	}
+}
+
+func TestGrantAuthenticationType(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	ctx := context.Background()
+
+	if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, authType := range []cosi.AuthenticationType{
+		cosi.AuthenticationType_UnknownAuthenticationType,
+		cosi.AuthenticationType_IAM,
+		cosi.AuthenticationType(42),
+	} {
+		_, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+			BucketId:           "fake-bucket-1",
+			Name:               "ba-1",
+			AuthenticationType: authType,
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("expected %v to be rejected, got %v", authType, err)
+		}
+	}
+	// Nothing is created on OneFS for a rejected grant.
+	if server.User("fake-ba-1") != nil {
+		t.Error("unexpected user fake-ba-1")
+	}
+}
+
+func TestRevokeSharedIdentity(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	p.Kube = newTestKube(newBucketAccess("ns-1", "access-1", "1"), newBucketAccess("ns-1", "access-2", "2"))
+	ctx := context.Background()
+
+	var userName string
+	for i, bucketName := range []string{"bucket-1", "bucket-2"} {
+		if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: bucketName}); err != nil {
+			t.Fatal(err)
+		}
+		granted, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+			BucketId:           "fake-" + bucketName,
+			Name:               fmt.Sprintf("ba-%d", i+1),
+			AuthenticationType: cosi.AuthenticationType_Key,
+			Parameters:         map[string]string{ParamSharedIdentity: "app"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if userName != "" && granted.GetAccountId() != userName {
+			t.Errorf("expected the identity %s to be shared, got %s", userName, granted.GetAccountId())
+		}
+		userName = granted.GetAccountId()
+	}
+	if userName != "fake-app-ns-1" {
+		t.Fatalf("unexpected account %s", userName)
+	}
+	if server.ReadFile(fake.BasePath+"/.cosi-identities/"+userName+".json") == nil {
+		t.Error("the references of the identity must be recorded")
+	}
+
+	// The sidecar revokes a BucketAccess once it is deleted.
+	revoke := func(bucketName, accessName string) {
+		t.Helper()
+		if err := p.Kube.Dynamic.Resource(kube.BucketAccessResource).Namespace("ns-1").Delete(ctx, accessName, metav1.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.DriverRevokeBucketAccess(ctx, &cosi.DriverRevokeBucketAccessRequest{
+			BucketId:  "fake-" + bucketName,
+			AccountId: userName,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if acl := server.Bucket(bucketName).Acl; len(acl) != 0 {
+			t.Errorf("unexpected ACL %+v", acl)
+		}
+	}
+
+	revoke("bucket-1", "access-1")
+	if server.User(userName) == nil || server.Key(userName) == nil {
+		t.Fatal("the shared user and its key must be kept")
+	}
+	revoke("bucket-2", "access-2")
+	if server.User(userName) != nil || server.Key(userName) != nil {
+		t.Error("the shared user and its key must be deleted")
+	}
+	if server.Exists(fake.BasePath + "/.cosi-identities/" + userName + ".json") {
+		t.Error("the references of the identity must be deleted")
+	}
+}
+
+func TestGrantSharedIdentityWithoutKube(t *testing.T) {
+	_, p := newTestProvisioner(t)
+	ctx := context.Background()
+
+	if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+		BucketId:           "fake-bucket-1",
+		Name:               "ba-1",
+		AuthenticationType: cosi.AuthenticationType_Key,
+		Parameters:         map[string]string{ParamSharedIdentity: "app"},
+	})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected the missing Kubernetes API to be reported, got %v", err)
+	}
+}
+
+func TestGrantBucketPolicy(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	ctx := context.Background()
+
+	if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ba-1", "ba-2"} {
+		if _, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+			BucketId:           "fake-bucket-1",
+			Name:               name,
+			AuthenticationType: cosi.AuthenticationType_Key,
+			Parameters: map[string]string{
+				ParamBucketPolicy:  "true",
+				ParamPolicyActions: "s3:GetObject, s3:ListBucket",
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	policy := server.BucketPolicy("bucket-1")
+	if policy == nil || len(policy.Statement) != 2 {
+		t.Fatalf("unexpected policy %+v", policy)
+	}
+	statement := policy.Statement[0]
+	if statement.Sid != "ba1" || len(statement.Principal.AWS) != 1 || statement.Principal.AWS[0] != "fake-ba-1" {
+		t.Errorf("unexpected statement %+v", statement)
+	}
+	if len(statement.Action) != 2 || statement.Action[0] != "s3:GetObject" || statement.Action[1] != "s3:ListBucket" {
+		t.Errorf("unexpected actions %v", statement.Action)
+	}
+	if len(statement.Resource) != 2 || statement.Resource[1] != "arn:aws:s3:::bucket-1/*" {
+		t.Errorf("unexpected resources %v", statement.Resource)
+	}
+
+	// Only the statement of the revoked account is removed.
+	if _, err := p.DriverRevokeBucketAccess(ctx, &cosi.DriverRevokeBucketAccessRequest{
+		BucketId:  "fake-bucket-1",
+		AccountId: "fake-ba-1",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if policy := server.BucketPolicy("bucket-1"); policy == nil || len(policy.Statement) != 1 || policy.Statement[0].Sid != "ba2" {
+		t.Errorf("unexpected policy %+v", policy)
+	}
+}
+
+func TestGrantPrefix(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	annotated := newBucketAccess("ns-1", "access-2", "2")
+	annotated.SetAnnotations(map[string]string{PrefixAnnotation: "/team-a/reports/"})
+	p.Kube = newTestKube(newBucketAccess("ns-1", "access-1", "1"), annotated)
+	ctx := context.Background()
+
+	if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	grant := func(name string, params map[string]string) error {
+		_, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+			BucketId:           "fake-bucket-1",
+			Name:               name,
+			AuthenticationType: cosi.AuthenticationType_Key,
+			Parameters:         params,
+		})
+		return err
+	}
+
+	for _, name := range []string{"ba-1", "ba-2"} {
+		if err := grant(name, map[string]string{ParamPrefix: "/team-a/"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Prefix-scoped access is only granted by the bucket policy.
+	if acl := server.Bucket("bucket-1").Acl; len(acl) != 0 {
+		t.Errorf("unexpected ACL %+v", acl)
+	}
+	resources := make(map[string]string)
+	policy := server.BucketPolicy("bucket-1")
+	if policy == nil || len(policy.Statement) != 4 {
+		t.Fatalf("unexpected policy %+v", policy)
+	}
+	for _, statement := range policy.Statement {
+		resources[statement.Sid] = strings.Join(statement.Resource, ",")
+	}
+	if resources["ba1"] != "arn:aws:s3:::bucket-1/team-a/*" || resources["ba1List"] != "arn:aws:s3:::bucket-1" {
+		t.Errorf("unexpected statements of the class prefix %v", resources)
+	}
+	if resources["ba2"] != "arn:aws:s3:::bucket-1/team-a/reports/*" {
+		t.Errorf("unexpected statements of the annotation prefix %v", resources)
+	}
+
+	for _, params := range []map[string]string{
+		{ParamPrefix: "team-*"},
+		{ParamPrefix: "team-a/../team-b"},
+		{ParamPrefix: "team-a", ParamACLGrantee: ACLGranteeGroup},
+	} {
+		if err := grant("ba-1", params); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("expected %v to be rejected, got %v", params, err)
+		}
+	}
+
+	// The sidecar revokes a BucketAccess once it is deleted.
+	if err := p.Kube.Dynamic.Resource(kube.BucketAccessResource).Namespace("ns-1").Delete(ctx, "access-1", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DriverRevokeBucketAccess(ctx, &cosi.DriverRevokeBucketAccessRequest{
+		BucketId:  "fake-bucket-1",
+		AccountId: "fake-ba-1",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if policy := server.BucketPolicy("bucket-1"); policy == nil || len(policy.Statement) != 2 || policy.Statement[0].Sid != "ba2" {
+		t.Errorf("unexpected policy %+v", policy)
+	}
+}
+
+func TestIdentityPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+		valid  bool
+	}{
+		{"", "nas1-", true},
+		{"nas1-", "nas1-", true},
+		{"nas1-team-", "nas1-team-", true},
+		{"nas1-team", "nas1-team", true},
+		{"nas1", "", false},
+		{"nas10-", "", false},
+		{"team-nas1-", "", false},
+		{"Nas1-", "", false},
+		{"nas1-" + strings.Repeat("team", 8), "", false},
+	}
+	for _, test := range tests {
+		got, err := identityPrefix("nas1", test.prefix)
+		if test.valid != (err == nil) || got != test.want {
+			t.Errorf("identityPrefix(%q) = %q, %v", test.prefix, got, err)
+		}
+	}
+}
+
+func TestIdentityName(t *testing.T) {
+	p := &Provisioner{identityPrefix: "nas1-"}
+	if got := p.identityName("ba-1"); got != "nas1-ba-1" {
+		t.Errorf("unexpected name %s", got)
+	}
+	long := strings.Repeat("a", maxUsernameLength)
+	got := p.identityName(long)
+	if len(got) != maxUsernameLength || !strings.HasPrefix(got, "nas1-a") {
+		t.Errorf("unexpected shortened name %s", got)
+	}
+	if other := p.identityName(long + "b"); other == got {
+		t.Errorf("shortened names must stay unique, got %s twice", got)
+	}
+}
+
+func TestRevokeMappedUser(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	ctx := context.Background()
+	server.AddUser(powerscale.User{Name: "admin", Enabled: true})
+
+	if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	granted, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+		BucketId:           "fake-bucket-1",
+		Name:               "ba-1",
+		AuthenticationType: cosi.AuthenticationType_Key,
+		Parameters:         map[string]string{ParamAuthProvider: fake.LocalProvider, ParamUserName: "admin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if granted.GetAccountId() != "admin" {
+		t.Fatalf("unexpected account %s", granted.GetAccountId())
+	}
+
+	if _, err := p.DriverRevokeBucketAccess(ctx, &cosi.DriverRevokeBucketAccessRequest{
+		BucketId:  "fake-bucket-1",
+		AccountId: "admin",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if server.User("admin") == nil || server.Key("admin") == nil {
+		t.Error("the mapped user and its key must be kept")
+	}
+	if acl := server.Bucket("bucket-1").Acl; len(acl) != 0 {
+		t.Errorf("unexpected ACL %+v", acl)
+	}
+}
+
+// Users granted before the ownership markers are named after their account,
+// and deleted on revoke.
+// The broker stops rotating the key of a mapped user once revoked, the key
+// itself is kept.
+func TestRevokeBrokerMappedUser(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	cfg := server.Config()
+	cfg.BrokerKeyTTL = time.Hour
+	p.Authenticators[cosi.AuthenticationType_Key] = NewBrokerAuthenticator(p.Powerscale, broker.New(cfg, p.Powerscale, nil))
+	ctx := context.Background()
+	server.AddUser(powerscale.User{Name: "admin", Enabled: true})
+
+	if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+		BucketId:           "fake-bucket-1",
+		Name:               "ba-1",
+		AuthenticationType: cosi.AuthenticationType_Key,
+		Parameters:         map[string]string{ParamAuthProvider: fake.LocalProvider, ParamUserName: "admin"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if accounts, err := p.Powerscale.ListBrokerAccounts(); err != nil || len(accounts) != 1 {
+		t.Fatalf("expected the account to be refreshed by the broker, got %v, %v", accounts, err)
+	}
+
+	if _, err := p.DriverRevokeBucketAccess(ctx, &cosi.DriverRevokeBucketAccessRequest{
+		BucketId:  "fake-bucket-1",
+		AccountId: "admin",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if accounts, err := p.Powerscale.ListBrokerAccounts(); err != nil || len(accounts) != 0 {
+		t.Errorf("expected the account to be forgotten, got %v, %v", accounts, err)
+	}
+	if server.User("admin") == nil || server.Key("admin") == nil {
+		t.Error("the mapped user and its key must be kept")
+	}
+}
+
+func TestRevokeLegacyUser(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	ctx := context.Background()
+
+	if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	client := p.Powerscale
+	for _, userName := range []string{"ba-x", "alice"} {
+		server.AddUser(powerscale.User{Name: userName, Enabled: true})
+		if err := client.EnsureACL("bucket-1", powerscale.AclUser{Type: powerscale.GranteeUser, Name: userName}, "FULL_CONTROL"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.CreateKey(userName); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.DriverRevokeBucketAccess(ctx, &cosi.DriverRevokeBucketAccessRequest{
+			BucketId:  "fake-bucket-1",
+			AccountId: userName,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if server.User("ba-x") != nil || server.Key("ba-x") != nil {
+		t.Error("the legacy user and its key must be deleted")
+	}
+	// Unmarked users not named after an account are not the driver's.
+	if server.User("alice") == nil || server.Key("alice") == nil {
+		t.Error("the user alice and its key must be kept")
+	}
+	if acl := server.Bucket("bucket-1").Acl; len(acl) != 0 {
+		t.Errorf("unexpected ACL %+v", acl)
+	}
+}
+
+// Two BucketAccesses of the same bucket share the identity and its ACL entry
+// until both are revoked.
+func TestRevokeSharedIdentitySameBucket(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	p.Kube = newTestKube(newBucketAccess("ns-1", "access-1", "1"), newBucketAccess("ns-1", "access-2", "2"))
+	ctx := context.Background()
+
+	if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	var userName string
+	for _, name := range []string{"ba-1", "ba-2"} {
+		granted, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+			BucketId:           "fake-bucket-1",
+			Name:               name,
+			AuthenticationType: cosi.AuthenticationType_Key,
+			Parameters:         map[string]string{ParamSharedIdentity: "app", ParamBucketPolicy: "true"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		userName = granted.GetAccountId()
+	}
+	if userName != "fake-app-ns-1" {
+		t.Fatalf("unexpected account %s", userName)
+	}
+	refsPath := fake.BasePath + "/.cosi-identities/" + userName + ".json"
+	if owner, err := p.Powerscale.GetDirectoryOwnership(refsPath); err != nil || !p.Powerscale.Owns(owner) {
+		t.Errorf("expected the references to be owned, got %+v, %v", owner, err)
+	}
+
+	// The sidecar revokes a BucketAccess once it is deleted.
+	revoke := func(uid string) {
+		t.Helper()
+		if err := p.Kube.Dynamic.Resource(kube.BucketAccessResource).Namespace("ns-1").Delete(ctx, "access-"+uid, metav1.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.DriverRevokeBucketAccess(ctx, &cosi.DriverRevokeBucketAccessRequest{
+			BucketId:  "fake-bucket-1",
+			AccountId: userName,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	revoke("1")
+	if server.User(userName) == nil || server.Key(userName) == nil {
+		t.Fatal("the shared user and its key must be kept")
+	}
+	if acl := server.Bucket("bucket-1").Acl; len(acl) != 1 || acl[0].Grantee.Name != userName {
+		t.Errorf("unexpected ACL %+v", acl)
+	}
+	// Only the statement of the revoked BucketAccess is removed.
+	if policy := server.BucketPolicy("bucket-1"); policy == nil || len(policy.Statement) != 1 || policy.Statement[0].Sid != "ba2" {
+		t.Errorf("unexpected policy %+v", policy)
+	}
+
+	revoke("2")
+	if server.User(userName) != nil || server.Key(userName) != nil {
+		t.Error("the shared user and its key must be deleted")
+	}
+	if acl := server.Bucket("bucket-1").Acl; len(acl) != 0 {
+		t.Errorf("unexpected ACL %+v", acl)
+	}
+}
+
+// Grants made before the BucketAccesses were recorded are revoked by the
+// names derived from the user.
+func TestRevokeUnrecordedGrant(t *testing.T) {
+	server, p := newTestProvisioner(t)
+	ctx := context.Background()
+
+	if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	client := p.Powerscale
+	if err := client.CreateUser("fake-ba-1", client.NewOwnership("1", "ns-1", "access-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.EnsureACL("bucket-1", powerscale.AclUser{Type: powerscale.GranteeUser, Name: "fake-ba-1"}, "FULL_CONTROL"); err != nil {
+		t.Fatal(err)
+	}
+	statements := append(
+		powerscale.NewPolicyStatements("ba1", "bucket-1", "fake-ba-1", "", powerscale.StringList{"s3:*"}),
+		powerscale.NewPolicyStatements("other", "bucket-1", "fake-ba-1", "", powerscale.StringList{"s3:*"})...)
+	if err := client.EnsurePolicyStatements("bucket-1", statements...); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.DriverRevokeBucketAccess(ctx, &cosi.DriverRevokeBucketAccessRequest{
+		BucketId:  "fake-bucket-1",
+		AccountId: "fake-ba-1",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if server.User("fake-ba-1") != nil {
+		t.Error("the user must be deleted")
+	}
+	if acl := server.Bucket("bucket-1").Acl; len(acl) != 0 {
+		t.Errorf("unexpected ACL %+v", acl)
+	}
+	// Statements of other grants are kept, even for the same principal.
+	if policy := server.BucketPolicy("bucket-1"); policy == nil || len(policy.Statement) != 1 || policy.Statement[0].Sid != "other" {
+		t.Errorf("unexpected policy %+v", policy)
+	}
+}
+
+// The prefix annotation of a BucketAccess can only narrow the prefix of its
+// class.
+func TestGrantPrefixAnnotation(t *testing.T) {
+	annotated := func(prefix string) *unstructured.Unstructured {
+		bucketAccess := newBucketAccess("ns-1", "access-1", "1")
+		bucketAccess.SetAnnotations(map[string]string{PrefixAnnotation: prefix})
+		return bucketAccess
+	}
+	tests := []struct {
+		params       map[string]string
+		bucketAccess *unstructured.Unstructured
+		want         string
+		invalid      bool
+	}{
+		{params: map[string]string{}, want: ""},
+		{params: map[string]string{ParamPrefix: "/team-a/"}, want: "team-a"},
+		{params: map[string]string{ParamPrefix: "team-a"}, bucketAccess: newBucketAccess("ns-1", "access-1", "1"), want: "team-a"},
+		{params: map[string]string{ParamPrefix: "team-a"}, bucketAccess: annotated("team-a"), want: "team-a"},
+		{params: map[string]string{ParamPrefix: "team-a"}, bucketAccess: annotated("team-a/reports/"), want: "team-a/reports"},
+		{params: map[string]string{ParamPrefix: ""}, bucketAccess: annotated("team-b"), want: "team-b"},
+		{params: map[string]string{ParamPrefix: "team-a"}, bucketAccess: annotated("team-b"), invalid: true},
+		{params: map[string]string{ParamPrefix: "team-a"}, bucketAccess: annotated("team-ab"), invalid: true},
+		{params: map[string]string{ParamPrefix: "team-a"}, bucketAccess: annotated(""), invalid: true},
+		{params: map[string]string{ParamPrefix: "team-a"}, bucketAccess: annotated("team-a/../team-b"), invalid: true},
+		{params: map[string]string{ParamPrefix: "team-*"}, invalid: true},
+	}
+	for _, test := range tests {
+		got, err := grantPrefix(test.params, test.bucketAccess)
+		if test.invalid {
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("grantPrefix(%v) = %q, %v, want InvalidArgument", test.params, got, err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("grantPrefix(%v) = %q, %v, want %q", test.params, got, err, test.want)
+		}
+	}
+}
+
+// Grants which do not need the BucketAccess object do not depend on the
+// Kubernetes API.
+func TestGrantWithoutBucketAccess(t *testing.T) {
+	_, p := newTestProvisioner(t)
+	p.Kube = newTestKube()
+	ctx := context.Background()
+
+	if _, err := p.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "bucket-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+		BucketId:           "fake-bucket-1",
+		Name:               "ba-1",
+		AuthenticationType: cosi.AuthenticationType_Key,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := p.DriverGrantBucketAccess(ctx, &cosi.DriverGrantBucketAccessRequest{
+		BucketId:           "fake-bucket-1",
+		Name:               "ba-2",
+		AuthenticationType: cosi.AuthenticationType_Key,
+		Parameters:         map[string]string{ParamPrefix: "team-a"},
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected the missing BucketAccess to be reported, got %v", err)
+	}
+}
@@ -4,8 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/japannext/cosi-powerscale/pkg/audit"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
 	log "k8s.io/klog/v2"
+	"sigs.k8s.io/container-object-storage-interface-provisioner-sidecar/pkg/consts"
 	cosi "sigs.k8s.io/container-object-storage-interface-spec"
 )
 
@@ -28,17 +35,18 @@ var (
 // DriverRevokeBucketAccess revokes access from Bucket on specific Object Storage Platform.
 func (p *Provisioner) DriverRevokeBucketAccess(ctx context.Context,
 	req *cosi.DriverRevokeBucketAccessRequest,
-) (*cosi.DriverRevokeBucketAccessResponse, error) {
+) (resp *cosi.DriverRevokeBucketAccessResponse, err error) {
+	logger := log.FromContext(ctx)
 
 	// Check if bucketID is not empty.
 	if req.GetBucketId() == "" {
-		log.Errorf("empty bucket ID", "action", "DriverRevokeBucketAccess")
+		logger.Error(ErrEmptyBucketID, "empty bucket ID", "action", "DriverRevokeBucketAccess")
 		return nil, fmt.Errorf("empty bucket ID")
 	}
 
 	// Check if bucket access name is not empty.
 	if req.GetAccountId() == "" {
-		log.Errorf("empty account ID", "action", "DriverRevokeBucketAccess", "bucketID", req.GetBucketId())
+		logger.Error(ErrEmptyAccountID, "empty account ID", "action", "DriverRevokeBucketAccess", "bucketID", req.GetBucketId())
 		return nil, fmt.Errorf("empty bucket access name")
 	}
 
@@ -47,46 +55,201 @@ func (p *Provisioner) DriverRevokeBucketAccess(ctx context.Context,
 	userName := req.AccountId
 	bucketName, err := getBucketName(req.GetBucketId())
 	if err != nil {
-		log.ErrorS(err, "failed to convert bucket name", "action", "DriverRevokeBucketAccess", "bucketID", req.GetBucketId())
+		logger.Error(err, "failed to convert bucket name", "action", "DriverRevokeBucketAccess", "bucketID", req.GetBucketId())
 		return nil, err
 	}
+	// The BucketAccess is only known by its account, its object is found
+	// with the ownership marker of the user.
+	bucketAccess := p.revokedBucketAccess(ctx, userName)
+	defer func() {
+		p.recordOutcome(bucketAccessReference(bucketAccess), err,
+			ReasonAccessRevoked, "Revoked access to bucket "+bucketName,
+			ReasonRevokeAccessFailed, "Failed to revoke access to bucket "+bucketName)
+	}()
+	actor := &audit.Actor{Kind: audit.KindBucketAccess, AccountID: userName}
+	if bucketAccess != nil {
+		actor.Namespace = bucketAccess.GetNamespace()
+		actor.Name = bucketAccess.GetName()
+		actor.UID = string(bucketAccess.GetUID())
+	}
+	ctx = audit.WithActor(ctx, actor)
+	server := p.Powerscale.WithContext(ctx)
 
-	// Check if bucket for revoking access exists.
-	bucket, err := p.Powerscale.GetBucket(bucketName)
+	// The grants of the BucketAccesses still in the cluster are kept: the ACL
+	// entry and the group membership are removed with the last BucketAccess on
+	// the bucket, and the user with the last BucketAccess of the user.
+	found, err := server.ReleaseIdentity(userName, bucketName, p.liveBucketAccess(ctx), func(r *powerscale.IdentityRelease) error {
+		sids := make([]string, 0, len(r.BucketAccesses))
+		for _, name := range r.BucketAccesses {
+			sids = append(sids, powerscale.PolicyStatementID(name))
+		}
+		if err := p.revokeBucket(ctx, server, userName, bucketName, sids, r.Bucket); err != nil {
+			return err
+		}
+		if !r.Bucket {
+			logger.Info("user still granted the bucket", "action", "DriverRevokeBucketAccess", "bucket", bucketName, "userName", userName, "released", r.BucketAccesses)
+		}
+		if r.Identity {
+			return p.deleteIdentity(ctx, server, userName, bucketName)
+		}
+		return nil
+	})
 	if err != nil {
-		log.ErrorS(err, "error fetching bucket", "action", "DriverRevokeBucketAccess", "bucket", bucketName)
+		logger.Error(err, "error releasing identity", "action", "DriverRevokeBucketAccess", "bucket", bucketName, "userName", userName)
+		return nil, err
+	}
+	if found {
+		return &cosi.DriverRevokeBucketAccessResponse{}, nil
+	}
+
+	// Grants made before the BucketAccesses were recorded: the user is named
+	// after its BucketAccess, and so is the policy statement.
+	sid := powerscale.PolicyStatementID(strings.TrimPrefix(userName, p.identityPrefix))
+	if err := p.revokeBucket(ctx, server, userName, bucketName, []string{sid}, true); err != nil {
+		return nil, err
+	}
+	if err := p.deleteIdentity(ctx, server, userName, bucketName); err != nil {
 		return nil, err
 	}
+
+	return &cosi.DriverRevokeBucketAccessResponse{}, nil
+}
+
+// revokeBucket removes the policy statements of the given Sids and, when the
+// user loses the bucket, the ACL entry and the bucket group membership of the
+// user.
+func (p *Provisioner) revokeBucket(ctx context.Context, server *powerscale.Server, userName, bucketName string, sids []string, all bool) error {
+	logger := log.FromContext(ctx)
+
+	// Check if bucket for revoking access exists.
+	bucket, err := server.GetBucket(bucketName)
+	if err != nil {
+		logger.Error(err, "error fetching bucket", "action", "DriverRevokeBucketAccess", "bucket", bucketName)
+		return err
+	}
 	if bucket != nil {
-		if err := p.Powerscale.DeleteACL(bucketName, userName); err != nil {
-			log.ErrorS(err, "error removing acl", "action", "DriverRevokeBucketAccess", "bucket", bucketName, "userName", userName)
-			return nil, err
+		if all {
+			grantee := powerscale.AclUser{Type: powerscale.GranteeUser, Name: userName}
+			if err := server.DeleteACL(bucketName, grantee); err != nil {
+				logger.Error(err, "error removing acl", "action", "DriverRevokeBucketAccess", "bucket", bucketName, "userName", userName)
+				return err
+			}
+		}
+		// The grant parameters are not part of the request, remove the
+		// statements of the grant from the policy, if any.
+		for _, sid := range sids {
+			if err := server.DeletePolicyStatements(bucketName, sid); err != nil {
+				logger.Error(err, "error removing policy statement", "action", "DriverRevokeBucketAccess", "bucket", bucketName, "userName", userName, "sid", sid)
+				return fmt.Errorf("%w: %w", ErrFailedToUpdateBucketPolicy, err)
+			}
 		}
 	}
+	if !all {
+		return nil
+	}
 
-	key, err := p.Powerscale.GetKey(userName)
-	if err != nil {
-		log.ErrorS(err, "error fetching key", "action", "DriverRevokeBucketAccess", "bucket", bucketName, "userName", userName)
-		return nil, err
+	// Access granted through the bucket group is revoked by removing the
+	// membership, the group ACL entry is kept for the other members.
+	groupName := p.bucketGroupName(bucketName)
+	if err := server.RemoveGroupMember(groupName, userName); err != nil {
+		logger.Error(err, "error removing group member", "action", "DriverRevokeBucketAccess", "bucket", bucketName, "groupName", groupName, "userName", userName)
+		return err
 	}
-	if key != nil {
-		if err := p.Powerscale.DeleteKey(userName); err != nil {
-			log.ErrorS(err, "error deleting key", "action", "DriverRevokeBucketAccess", "bucket", bucketName, "userName", userName)
-			return nil, err
+	return nil
+}
+
+// liveBucketAccess returns whether a BucketAccess, by name, still holds its
+// grant: it exists and is not being deleted. The BucketAccesses are listed
+// once, on the first call. Without the Kubernetes API, no BucketAccess is
+// live.
+func (p *Provisioner) liveBucketAccess(ctx context.Context) func(name string) (bool, error) {
+	var live map[string]bool
+	return func(name string) (bool, error) {
+		if p.Kube == nil {
+			return false, nil
 		}
+		if live == nil {
+			items, err := p.Kube.ListBucketAccesses(ctx, metav1.NamespaceAll)
+			if err != nil {
+				return false, err
+			}
+			live = make(map[string]bool, len(items))
+			for _, item := range items {
+				if item.GetDeletionTimestamp() == nil {
+					live[consts.AccountNamePrefix+string(item.GetUID())] = true
+				}
+			}
+		}
+		return live[name], nil
 	}
+}
 
-	user, err := p.Powerscale.GetUser(userName)
+// revokedBucketAccess returns the BucketAccess of a user created by the
+// driver, or nil when it is unknown, e.g. for a shared or external user.
+func (p *Provisioner) revokedBucketAccess(ctx context.Context, userName string) *unstructured.Unstructured {
+	if p.Kube == nil {
+		return nil
+	}
+	user, err := p.Powerscale.WithContext(ctx).GetUser(userName)
+	if err != nil || user == nil {
+		return nil
+	}
+	owner := user.Ownership()
+	if !p.Powerscale.Owns(owner) || owner.UID == "" {
+		return nil
+	}
+	bucketAccess, err := p.Kube.FindBucketAccess(ctx, types.UID(owner.UID))
 	if err != nil {
-		log.ErrorS(err, "error fetching user", "action", "DriverRevokeBucketAccess", "bucket", bucketName, "userName", userName)
-		return nil, err
+		log.FromContext(ctx).Error(err, "failed to fetch BucketAccess, no event recorded", "userName", userName)
+		return nil
+	}
+	return bucketAccess
+}
+
+// deleteIdentity revokes the credentials of a user owned by the driver, then
+// deletes it. Mapped users (authProvider) are not owned by the driver: the
+// user and its key may be used by other BucketAccesses, so both are kept.
+func (p *Provisioner) deleteIdentity(ctx context.Context, server *powerscale.Server, userName, bucketName string) error {
+	logger := log.FromContext(ctx)
+
+	user, err := server.GetUser(userName)
+	if err != nil {
+		logger.Error(err, "error fetching user", "action", "DriverRevokeBucketAccess", "bucket", bucketName, "userName", userName)
+		return err
 	}
-	if user != nil {
-		if err := p.Powerscale.DeleteUser(userName); err != nil {
-			log.ErrorS(err, "error deleting user", "action", "DriverRevokeBucketAccess", "bucket", bucketName, "userName", userName)
-			return nil, err
+	owned := user == nil || server.Owns(user.Ownership()) || legacyUser(user)
+
+	// The authentication type is not part of the request, revoke the
+	// credentials of every authenticator. The credentials of the users the
+	// driver does not own are kept, but no longer managed.
+	for authType, auth := range p.Authenticators {
+		revoke := auth.Revoke
+		if !owned {
+			revoke = auth.Release
+		}
+		if err := revoke(ctx, userName); err != nil {
+			logger.Error(err, "error revoking credentials", "action", "DriverRevokeBucketAccess", "bucket", bucketName, "userName", userName, "authenticationType", authType)
+			return err
 		}
 	}
+	if user == nil {
+		return nil
+	}
+	if !owned {
+		logger.Info("user not owned by the driver, keeping it and its credentials", "action", "DriverRevokeBucketAccess", "bucket", bucketName, "userName", userName)
+		return nil
+	}
 
-	return &cosi.DriverRevokeBucketAccessResponse{}, nil
+	if err := server.DeleteUser(userName); err != nil {
+		logger.Error(err, "error deleting user", "action", "DriverRevokeBucketAccess", "bucket", bucketName, "userName", userName)
+		return err
+	}
+	return nil
+}
+
+// legacyUser reports whether a user was created by the driver before the
+// ownership markers: a local user without marker, named after the account
+// of its BucketAccess, "ba-<uid>".
+func legacyUser(user *powerscale.User) bool {
+	return user.Ownership() == nil && user.IsLocal() && strings.HasPrefix(user.Name, consts.AccountNamePrefix)
 }
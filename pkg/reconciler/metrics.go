@@ -0,0 +1,28 @@
+package reconciler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	discrepancies = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cosi_powerscale_reconcile_discrepancies",
+		Help: "Number of discrepancies found by the last reconciliation, by kind.",
+	}, []string{"kind"})
+
+	fixed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cosi_powerscale_reconcile_fixed_total",
+		Help: "Number of discrepancies fixed by the reconciler, by kind.",
+	}, []string{"kind"})
+
+	reconcileErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cosi_powerscale_reconcile_errors_total",
+		Help: "Number of failed reconciliations.",
+	})
+
+	lastSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "cosi_powerscale_reconcile_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful reconciliation.",
+	})
+)
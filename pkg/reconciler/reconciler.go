@@ -0,0 +1,396 @@
+// Package reconciler periodically cross-checks the users, S3 keys, bucket
+// ACLs and the base path directories of the zone, to find the objects left
+// behind by failed grants and manual edits:
+//   - users created by the driver which are not granted any bucket,
+//   - ACL entries of driver-owned buckets for users which do not exist,
+//   - directories under the base path which are not the path of a bucket.
+//
+// Discrepancies are reported as metrics and logs. When fixing is enabled,
+// only the objects carrying the ownership marker of this driver instance
+// are modified.
+package reconciler
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	log "k8s.io/klog/v2"
+
+	"github.com/japannext/cosi-powerscale/pkg/config"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+)
+
+// Kinds of discrepancies.
+const (
+	KindOrphanUser      = "orphan_user"
+	KindOrphanKey       = "orphan_key"
+	KindStaleACL        = "stale_acl"
+	KindOrphanDirectory = "orphan_directory"
+)
+
+// OrphanUser is a user created by the driver which is not referenced by any
+// bucket ACL, bucket group or bucket policy.
+type OrphanUser struct {
+	Name string
+	// The user still has an S3 key.
+	HasKey bool
+}
+
+// StaleACL is an ACL entry of a driver-owned bucket for a user which does
+// not exist anymore.
+type StaleACL struct {
+	Bucket string
+	User   string
+}
+
+// OrphanDirectory is a directory of the base path without bucket.
+type OrphanDirectory struct {
+	Path string
+	// The directory carries the ownership marker of the driver.
+	Owned bool
+}
+
+// Report lists the discrepancies found by a reconciliation.
+type Report struct {
+	OrphanUsers       []OrphanUser
+	StaleACLs         []StaleACL
+	OrphanDirectories []OrphanDirectory
+}
+
+type Reconciler struct {
+	powerscale *powerscale.Server
+	interval   time.Duration
+	// Objects younger than the grace period may belong to an operation
+	// in progress and are ignored.
+	gracePeriod time.Duration
+	fix         bool
+}
+
+func New(cfg *config.Config, server *powerscale.Server) *Reconciler {
+	return &Reconciler{
+		powerscale:  server,
+		interval:    cfg.ReconcileInterval,
+		gracePeriod: cfg.ReconcileGracePeriod,
+		fix:         cfg.ReconcileFix,
+	}
+}
+
+// Run reconciles the zone every interval until the context is done.
+func (r *Reconciler) Run(ctx context.Context) error {
+	log.InfoS("Reconciler started", "interval", r.interval, "fix", r.fix)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.runOnce()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Reconciler) runOnce() {
+	start := time.Now()
+	report, err := r.Reconcile()
+	if err != nil {
+		reconcileErrors.Inc()
+		log.ErrorS(err, "Reconciliation failed")
+		return
+	}
+	discrepancies.WithLabelValues(KindOrphanUser).Set(float64(len(report.OrphanUsers)))
+	discrepancies.WithLabelValues(KindOrphanKey).Set(float64(countKeys(report.OrphanUsers)))
+	discrepancies.WithLabelValues(KindStaleACL).Set(float64(len(report.StaleACLs)))
+	discrepancies.WithLabelValues(KindOrphanDirectory).Set(float64(len(report.OrphanDirectories)))
+	lastSuccess.SetToCurrentTime()
+
+	if r.fix {
+		r.Fix(report)
+	}
+
+	log.InfoS("Reconciliation success",
+		"orphanUsers", len(report.OrphanUsers),
+		"staleACLs", len(report.StaleACLs),
+		"orphanDirectories", len(report.OrphanDirectories),
+		"duration", time.Since(start))
+}
+
+func countKeys(users []OrphanUser) int {
+	count := 0
+	for _, user := range users {
+		if user.HasKey {
+			count++
+		}
+	}
+	return count
+}
+
+// expired reports whether an object created at the given time is older
+// than the grace period. Objects without creation time are considered old.
+func (r *Reconciler) expired(createdAt time.Time) bool {
+	return createdAt.IsZero() || time.Since(createdAt) > r.gracePeriod
+}
+
+// Reconcile lists the discrepancies of the zone without modifying anything.
+func (r *Reconciler) Reconcile() (*Report, error) {
+	buckets, err := r.powerscale.ListBuckets(powerscale.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	users, err := r.powerscale.ListUsers(powerscale.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+
+	referenced, err := r.referencedUsers(buckets)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		owner := user.Ownership()
+		if !r.powerscale.Owns(owner) || referenced[user.Name] || !r.expired(owner.CreatedAt) {
+			continue
+		}
+		key, err := r.powerscale.GetKey(user.Name)
+		if err != nil {
+			return nil, err
+		}
+		orphan := OrphanUser{Name: user.Name, HasKey: key != nil}
+		log.InfoS("Reconcile found orphan user", "user", orphan.Name, "hasKey", orphan.HasKey)
+		report.OrphanUsers = append(report.OrphanUsers, orphan)
+	}
+
+	staleACLs, err := r.staleACLs(buckets, users)
+	if err != nil {
+		return nil, err
+	}
+	report.StaleACLs = staleACLs
+
+	orphanDirectories, err := r.orphanDirectories(buckets)
+	if err != nil {
+		return nil, err
+	}
+	report.OrphanDirectories = orphanDirectories
+
+	return report, nil
+}
+
+// referencedUsers returns the names of the users granted access to a bucket,
+// directly in its ACL, through a group of its ACL or in its policy.
+func (r *Reconciler) referencedUsers(buckets []*powerscale.Bucket) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	groups := make(map[string]bool)
+	for _, bucket := range buckets {
+		for _, acl := range bucket.Acl {
+			if acl.Grantee == nil {
+				continue
+			}
+			switch acl.Grantee.Type {
+			case powerscale.GranteeGroup:
+				groups[acl.Grantee.Name] = true
+			default:
+				referenced[acl.Grantee.Name] = true
+			}
+		}
+
+		policy, err := r.powerscale.GetBucketPolicy(bucket.Name)
+		if err != nil {
+			return nil, err
+		}
+		if policy == nil {
+			continue
+		}
+		for _, statement := range policy.Statement {
+			for _, principal := range statement.Principal.AWS {
+				referenced[principal] = true
+			}
+		}
+	}
+
+	for group := range groups {
+		members, err := r.powerscale.ListGroupMembers(group, powerscale.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			referenced[member.Name] = true
+		}
+	}
+	return referenced, nil
+}
+
+// staleACLs returns the user entries of the driver-owned buckets whose user
+// does not exist in any provider of the zone.
+func (r *Reconciler) staleACLs(buckets []*powerscale.Bucket, users []*powerscale.User) ([]StaleACL, error) {
+	exists := make(map[string]bool)
+	for _, user := range users {
+		exists[user.Name] = true
+	}
+
+	var stale []StaleACL
+	for _, bucket := range buckets {
+		if !r.powerscale.Owns(bucket.Ownership()) {
+			continue
+		}
+		for _, acl := range bucket.Acl {
+			if acl.Grantee == nil || acl.Grantee.Type == powerscale.GranteeGroup {
+				continue
+			}
+			name := acl.Grantee.Name
+			if _, ok := exists[name]; !ok {
+				// Users of other providers are not part of the listing.
+				user, err := r.powerscale.GetUser(name)
+				if err != nil {
+					return nil, err
+				}
+				exists[name] = user != nil
+			}
+			if exists[name] {
+				continue
+			}
+			log.InfoS("Reconcile found stale ACL entry", "bucket", bucket.Name, "user", name)
+			stale = append(stale, StaleACL{Bucket: bucket.Name, User: name})
+		}
+	}
+	return stale, nil
+}
+
+// orphanDirectories returns the directories of the base path which are not
+// the path of a bucket. Hidden directories, used by the driver for its own
+// state, are skipped.
+func (r *Reconciler) orphanDirectories(buckets []*powerscale.Bucket) ([]OrphanDirectory, error) {
+	bucketPaths := make(map[string]bool)
+	for _, bucket := range buckets {
+		bucketPaths[path.Clean(bucket.Path)] = true
+	}
+
+	entries, err := r.powerscale.ListDirectory(r.powerscale.BasePath(), powerscale.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []OrphanDirectory
+	for _, entry := range entries {
+		if entry.Type != "container" || strings.HasPrefix(entry.Name, ".") {
+			continue
+		}
+		dirPath := path.Join(r.powerscale.BasePath(), entry.Name)
+		if bucketPaths[dirPath] {
+			continue
+		}
+		owner, err := r.powerscale.GetDirectoryOwnership(dirPath)
+		if err != nil {
+			return nil, err
+		}
+		owned := r.powerscale.Owns(owner)
+		if owned && !r.expired(owner.CreatedAt) {
+			continue
+		}
+		log.InfoS("Reconcile found orphan directory", "directory", dirPath, "owned", owned)
+		orphans = append(orphans, OrphanDirectory{Path: dirPath, Owned: owned})
+	}
+	return orphans, nil
+}
+
+// Fix removes the discrepancies of the report. Orphan users and stale ACL
+// entries are only found on driver-owned objects; orphan directories without
+// the ownership marker of the driver are left untouched.
+func (r *Reconciler) Fix(report *Report) {
+	for _, user := range report.OrphanUsers {
+		// The user is checked again under the lock of the identity, before
+		// its key is deleted, as a grant may have picked it up since the
+		// reconciliation.
+		deleted, err := r.powerscale.DeleteIdentity(user.Name, user.HasKey, func() (bool, error) {
+			return r.stillOrphanUser(user.Name)
+		})
+		if err != nil {
+			log.ErrorS(err, "Failed to delete orphan user", "user", user.Name)
+			continue
+		}
+		if !deleted {
+			continue
+		}
+		if user.HasKey {
+			fixed.WithLabelValues(KindOrphanKey).Inc()
+		}
+		fixed.WithLabelValues(KindOrphanUser).Inc()
+	}
+
+	for _, acl := range report.StaleACLs {
+		grantee := powerscale.AclUser{Type: powerscale.GranteeUser, Name: acl.User}
+		if err := r.powerscale.DeleteACL(acl.Bucket, grantee); err != nil {
+			log.ErrorS(err, "Failed to delete stale ACL entry", "bucket", acl.Bucket, "user", acl.User)
+			continue
+		}
+		fixed.WithLabelValues(KindStaleACL).Inc()
+	}
+
+	for _, directory := range report.OrphanDirectories {
+		if !directory.Owned {
+			log.InfoS("Orphan directory not owned by the driver, skipping", "directory", directory.Path)
+			continue
+		}
+		if ok, err := r.stillOrphanDirectory(directory.Path); err != nil || !ok {
+			if err != nil {
+				log.ErrorS(err, "Failed to check orphan directory", "directory", directory.Path)
+			}
+			continue
+		}
+		if err := r.powerscale.DeleteDirectory(directory.Path); err != nil {
+			log.ErrorS(err, "Failed to delete orphan directory", "directory", directory.Path)
+			continue
+		}
+		fixed.WithLabelValues(KindOrphanDirectory).Inc()
+	}
+}
+
+// stillOrphanUser checks again, right before the deletion of its key, that an
+// orphan user is owned by the driver and that no grant recorded a
+// BucketAccess for it since the reconciliation.
+func (r *Reconciler) stillOrphanUser(userName string) (bool, error) {
+	user, err := r.powerscale.GetUser(userName)
+	if err != nil || user == nil {
+		return false, err
+	}
+	owner := user.Ownership()
+	if !r.powerscale.Owns(owner) || !r.expired(owner.CreatedAt) {
+		log.InfoS("Orphan user changed since the reconciliation, skipping", "user", userName)
+		return false, nil
+	}
+	refs, err := r.powerscale.GetIdentityRefs(userName)
+	if err != nil {
+		return false, err
+	}
+	if refs != nil && (len(refs.Grants) > 0 || len(refs.Buckets) > 0) {
+		log.InfoS("Orphan user granted a bucket since the reconciliation, skipping", "user", userName)
+		return false, nil
+	}
+	return true, nil
+}
+
+// stillOrphanDirectory checks again, right before its deletion, that an orphan
+// directory is owned by the driver and that no bucket was created on it since
+// the reconciliation.
+func (r *Reconciler) stillOrphanDirectory(dirPath string) (bool, error) {
+	bucket, err := r.powerscale.GetBucket(path.Base(dirPath))
+	if err != nil {
+		return false, err
+	}
+	if bucket != nil {
+		log.InfoS("Orphan directory claimed by a bucket since the reconciliation, skipping", "directory", dirPath)
+		return false, nil
+	}
+	owner, err := r.powerscale.GetDirectoryOwnership(dirPath)
+	if err != nil {
+		return false, err
+	}
+	if !r.powerscale.Owns(owner) || !r.expired(owner.CreatedAt) {
+		log.InfoS("Orphan directory changed since the reconciliation, skipping", "directory", dirPath)
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,168 @@
+package reconciler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale/fake"
+)
+
+// newTestZone returns a zone holding one discrepancy of each kind, next to
+// objects which must be left alone:
+//   - bucket-1 is granted to the users app, gone (deleted) and, through the
+//     group readers, grouped;
+//   - orphan is not granted any bucket, foreign is not owned by the driver;
+//   - bucket-2 was deleted but not its directory, manual was never a bucket.
+func newTestZone(t *testing.T) (*fake.Server, *powerscale.Server) {
+	t.Helper()
+	server := fake.NewServer()
+	t.Cleanup(server.Close)
+	client := powerscale.New(server.Config())
+	owner := client.NewOwnership("", "", "")
+	other := powerscale.New(server.Config())
+	other.Name = "other"
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, bucketName := range []string{"bucket-1", "bucket-2"} {
+		must(client.CreateBucket(bucketName, owner))
+	}
+	must(client.DeleteBucket("bucket-2"))
+	must(client.CreateDirectory(fake.BasePath + "/manual"))
+
+	for _, userName := range []string{"app", "gone", "grouped", "orphan"} {
+		must(client.CreateUser(userName, owner))
+		_, err := client.CreateKey(userName)
+		must(err)
+	}
+	must(client.CreateUser("foreign", other.NewOwnership("", "", "")))
+	must(client.CreateGroup("readers", client.NewOwnership("", "", "")))
+	must(client.AddGroupMember("readers", "grouped"))
+	for _, grantee := range []powerscale.AclUser{
+		{Type: powerscale.GranteeUser, Name: "app"},
+		{Type: powerscale.GranteeUser, Name: "gone"},
+		{Type: powerscale.GranteeGroup, Name: "readers"},
+	} {
+		must(client.EnsureACL("bucket-1", grantee, "FULL_CONTROL"))
+	}
+	must(client.DeleteUser("gone"))
+	return server, client
+}
+
+func TestReconcile(t *testing.T) {
+	_, client := newTestZone(t)
+
+	report, err := (&Reconciler{powerscale: client}).Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Report{
+		OrphanUsers: []OrphanUser{{Name: "orphan", HasKey: true}},
+		StaleACLs:   []StaleACL{{Bucket: "bucket-1", User: "gone"}},
+		OrphanDirectories: []OrphanDirectory{
+			{Path: fake.BasePath + "/bucket-2", Owned: true},
+			{Path: fake.BasePath + "/manual", Owned: false},
+		},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	// Recent objects may belong to an operation in progress.
+	report, err = (&Reconciler{powerscale: client, gracePeriod: time.Hour}).Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected.OrphanUsers = nil
+	expected.OrphanDirectories = expected.OrphanDirectories[1:]
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("unexpected report within the grace period %+v", report)
+	}
+}
+
+func TestFix(t *testing.T) {
+	server, client := newTestZone(t)
+	r := &Reconciler{powerscale: client}
+
+	report, err := r.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Fix(report)
+
+	if server.User("orphan") != nil || server.Key("orphan") != nil {
+		t.Error("the orphan user and its key must be deleted")
+	}
+	for _, userName := range []string{"app", "grouped", "foreign"} {
+		if server.User(userName) == nil {
+			t.Errorf("the user %s must be kept", userName)
+		}
+	}
+	if acl := server.Bucket("bucket-1").Acl; len(acl) != 2 {
+		t.Errorf("unexpected ACL %+v", acl)
+	}
+	if server.Exists(fake.BasePath + "/bucket-2") {
+		t.Error("the orphan directory owned by the driver must be deleted")
+	}
+	if !server.Exists(fake.BasePath + "/manual") {
+		t.Error("the directory not owned by the driver must be kept")
+	}
+
+	report, err = r.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.OrphanUsers) != 0 || len(report.StaleACLs) != 0 || len(report.OrphanDirectories) != 1 {
+		t.Errorf("unexpected report after fix %+v", report)
+	}
+}
+
+// The orphans of a report are checked again before their deletion, nothing
+// is deleted when they changed since the reconciliation.
+func TestFixChanged(t *testing.T) {
+	server, client := newTestZone(t)
+	report, err := (&Reconciler{powerscale: client}).Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Recent objects may belong to an operation in progress.
+	(&Reconciler{powerscale: client, gracePeriod: time.Hour}).Fix(report)
+	if server.User("orphan") == nil || server.Key("orphan") == nil {
+		t.Error("the orphan user within the grace period and its key must be kept")
+	}
+	if !server.Exists(fake.BasePath + "/bucket-2") {
+		t.Error("the orphan directory within the grace period must be kept")
+	}
+
+	// Objects not owned by the driver are never deleted.
+	r := &Reconciler{powerscale: client}
+	r.Fix(&Report{
+		OrphanUsers:       []OrphanUser{{Name: "foreign"}},
+		OrphanDirectories: []OrphanDirectory{{Path: fake.BasePath + "/manual", Owned: true}},
+	})
+	if server.User("foreign") == nil {
+		t.Error("the user not owned by the driver must be kept")
+	}
+	if !server.Exists(fake.BasePath + "/manual") {
+		t.Error("the directory not owned by the driver must be kept")
+	}
+
+	// A grant picked up the orphan user since the reconciliation.
+	if err := client.AcquireIdentity("orphan", "bucket-1", "ba-1", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	r.Fix(report)
+	if server.User("orphan") == nil || server.Key("orphan") == nil {
+		t.Error("the user granted since the reconciliation and its key must be kept")
+	}
+	if server.Exists(fake.BasePath + "/bucket-2") {
+		t.Error("the orphan directory owned by the driver must be deleted")
+	}
+}
@@ -0,0 +1,40 @@
+package redact
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+)
+
+// UnaryServerInterceptor redacts the messages of the errors returned to the
+// sidecar, which stores them in the status of the COSI objects. The status
+// code is kept.
+func UnaryServerInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	if err == nil {
+		return resp, nil
+	}
+	st := status.Convert(err)
+	message := String(st.Message())
+	if message == st.Message() {
+		return resp, err
+	}
+	return resp, status.Error(st.Code(), message)
+}
+
+// Response returns a copy of a gRPC response without the secrets of its
+// credentials, to be logged.
+func Response(resp any) any {
+	grant, ok := resp.(*cosi.DriverGrantBucketAccessResponse)
+	if !ok || grant == nil {
+		return resp
+	}
+	grant = proto.Clone(grant).(*cosi.DriverGrantBucketAccessResponse)
+	for _, credentials := range grant.GetCredentials() {
+		credentials.Secrets = Map(credentials.GetSecrets())
+	}
+	return grant
+}
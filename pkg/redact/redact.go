@@ -0,0 +1,94 @@
+// Package redact removes credentials from the texts that may reach the logs,
+// the traces or the gRPC errors: secret keys, passwords and tokens, HTTP
+// Authorization headers and the OneFS session cookies.
+package redact
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Placeholder replaces the redacted values.
+const Placeholder = "REDACTED"
+
+// Names of the fields and parameters holding secrets, matched as substrings.
+var secretNames = []string{"password", "secret", "token", "passwd", "credential"}
+
+// Headers holding credentials.
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Csrf-Token"}
+
+var (
+	// "secret_key": "value" in JSON bodies.
+	jsonField = regexp.MustCompile(`(?i)("[^"\\]*(?:password|secret|token|passwd|credential)[^"\\]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	// \"secret_key\": \"value\" in JSON documents quoted in JSON strings,
+	// e.g. the request echoed in an error message.
+	quotedJSONField = regexp.MustCompile(`(?i)(\\"[^"\\]*(?:password|secret|token|passwd|credential)[^"\\]*\\"\s*:\s*)\\"(?:[^"\\]|\\[^"])*\\"`)
+	// secret_key=value in query strings, form bodies and logfmt.
+	keyValue = regexp.MustCompile(`(?i)\b([\w.-]*(?:password|secret|token|passwd|credential)[\w.-]*=)[^&\s",;]+`)
+	// Authorization, Cookie and Set-Cookie header lines.
+	headerLine = regexp.MustCompile(`(?i)\b((?:proxy-)?authorization:\s*|(?:set-)?cookie:\s*)[^\r\n"]+`)
+	// Credentials of the Authorization header quoted alone. Short words are
+	// not matched, e.g. "basic authentication".
+	authScheme = regexp.MustCompile(`(?i)\b(basic|bearer)\s+[A-Za-z0-9+/._~-]{16,}=*`)
+	// isisessid and isicsrf session cookies.
+	sessionCookie = regexp.MustCompile(`(?i)\b(isisessid|isicsrf)=[^;\s",]+`)
+)
+
+// String returns the text with its credentials replaced by Placeholder.
+func String(s string) string {
+	s = jsonField.ReplaceAllString(s, `${1}"`+Placeholder+`"`)
+	s = quotedJSONField.ReplaceAllString(s, `${1}\"`+Placeholder+`\"`)
+	s = keyValue.ReplaceAllString(s, "${1}"+Placeholder)
+	s = headerLine.ReplaceAllString(s, "${1}"+Placeholder)
+	s = authScheme.ReplaceAllString(s, "${1} "+Placeholder)
+	s = sessionCookie.ReplaceAllString(s, "${1}="+Placeholder)
+	return s
+}
+
+// Bytes is String for a body.
+func Bytes(b []byte) []byte {
+	return []byte(String(string(b)))
+}
+
+// IsSecret reports whether a field, parameter or header name holds a secret.
+func IsSecret(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range secretNames {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	for _, header := range secretHeaders {
+		if strings.EqualFold(name, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// Map returns a copy of the map with the values of its secret keys redacted.
+func Map(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(m))
+	for key, value := range m {
+		if IsSecret(key) {
+			value = Placeholder
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// Header returns a copy of the headers with the credentials redacted.
+func Header(h http.Header) http.Header {
+	redacted := h.Clone()
+	for name := range redacted {
+		if IsSecret(name) {
+			redacted[name] = []string{Placeholder}
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,191 @@
+package redact
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+)
+
+const secret = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "key response",
+			in:   `{"keys":{"access_id":"1_cosi_accid","secret_key":"` + secret + `","secret_key_timestamp":1700000000}}`,
+			want: `{"keys":{"access_id":"1_cosi_accid","secret_key":"REDACTED","secret_key_timestamp":1700000000}}`,
+		},
+		{
+			name: "password field with spaces",
+			in:   `{"name": "cosi-user", "password" : "hunter2"}`,
+			want: `{"name": "cosi-user", "password" : "REDACTED"}`,
+		},
+		{
+			name: "escaped quotes in value",
+			in:   `{"password":"a\"b` + secret + `"}`,
+			want: `{"password":"REDACTED"}`,
+		},
+		{
+			name: "request echoed in an error message",
+			in:   `{"errors":[{"code":"AEC_BAD_REQUEST","message":"Invalid input {\"secret_key\":\"` + secret + `\"}"}]}`,
+			want: `{"errors":[{"code":"AEC_BAD_REQUEST","message":"Invalid input {\"secret_key\":\"REDACTED\"}"}]}`,
+		},
+		{
+			name: "query string",
+			in:   "/platform/14/auth/users?zone=System&password=hunter2&enabled=true",
+			want: "/platform/14/auth/users?zone=System&password=REDACTED&enabled=true",
+		},
+		{
+			name: "authorization header line",
+			in:   "Authorization: Basic Y29zaTpodW50ZXIy\r\nHost: isilon",
+			want: "Authorization: REDACTED\r\nHost: isilon",
+		},
+		{
+			name: "basic credentials",
+			in:   "sent Basic YWRtaW46UGFzc3dvcmQxMjM= to the API",
+			want: "sent Basic REDACTED to the API",
+		},
+		{
+			name: "bearer token",
+			in:   "token Bearer eyJhbGciOiJSUzI1NiIsImtpZCI6IjEifQ.eyJzdWIiOiJjb3NpIn0.c2ln",
+			want: "token Bearer REDACTED",
+		},
+		{
+			name: "session cookies",
+			in:   "isisessid=2e0f1b3c-9d4a-4b9e; isicsrf=5f6e7d8c",
+			want: "isisessid=REDACTED; isicsrf=REDACTED",
+		},
+		{
+			name: "set-cookie header line",
+			in:   "Set-Cookie: isisessid=2e0f1b3c-9d4a-4b9e; path=/; HttpOnly",
+			want: "Set-Cookie: REDACTED",
+		},
+		{
+			name: "no credentials",
+			in:   `Unexpected status code 404: {"errors":[{"code":"AEC_NOT_FOUND","message":"Basic authentication is not enabled"}]}`,
+			want: `Unexpected status code 404: {"errors":[{"code":"AEC_NOT_FOUND","message":"Basic authentication is not enabled"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := String(tt.in); got != tt.want {
+				t.Errorf("String(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeader(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Basic Y29zaTpodW50ZXIy")
+	h.Set("Cookie", "isisessid=2e0f1b3c")
+	h.Set("X-CSRF-Token", "5f6e7d8c")
+	h.Set("Content-Type", "application/json")
+
+	got := Header(h)
+	for _, name := range []string{"Authorization", "Cookie", "X-CSRF-Token"} {
+		if got.Get(name) != Placeholder {
+			t.Errorf("header %s = %q, want %q", name, got.Get(name), Placeholder)
+		}
+	}
+	if got.Get("Content-Type") != "application/json" {
+		t.Errorf("header Content-Type = %q, want it unchanged", got.Get("Content-Type"))
+	}
+	if h.Get("Authorization") != "Basic Y29zaTpodW50ZXIy" {
+		t.Error("Header modified its argument")
+	}
+}
+
+func TestMap(t *testing.T) {
+	got := Map(map[string]string{
+		"accessKeyID":     "1_cosi_accid",
+		"accessSecretKey": secret,
+		"endpoint":        "https://s3.example.com:9021",
+	})
+	want := map[string]string{
+		"accessKeyID":     "1_cosi_accid",
+		"accessSecretKey": Placeholder,
+		"endpoint":        "https://s3.example.com:9021",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("Map()[%q] = %q, want %q", key, got[key], value)
+		}
+	}
+}
+
+func grantResponse() *cosi.DriverGrantBucketAccessResponse {
+	return &cosi.DriverGrantBucketAccessResponse{
+		AccountId: "cosi-ba-1234",
+		Credentials: map[string]*cosi.CredentialDetails{
+			"s3": {Secrets: map[string]string{
+				"accessKeyID":     "1_cosi_accid",
+				"accessSecretKey": secret,
+			}},
+		},
+	}
+}
+
+func TestResponse(t *testing.T) {
+	resp := grantResponse()
+	redacted := Response(resp).(*cosi.DriverGrantBucketAccessResponse)
+
+	if got := redacted.Credentials["s3"].Secrets["accessSecretKey"]; got != Placeholder {
+		t.Errorf("redacted secret key = %q, want %q", got, Placeholder)
+	}
+	if got := resp.Credentials["s3"].Secrets["accessSecretKey"]; got != secret {
+		t.Errorf("Response modified the response sent to the sidecar, secret key = %q", got)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/cosi.v1alpha1.Provisioner/DriverGrantBucketAccess"}
+
+	t.Run("error", func(t *testing.T) {
+		handler := func(context.Context, any) (any, error) {
+			return nil, status.Errorf(codes.Internal, `Unexpected status code 500: {"secret_key":"%s"}`, secret)
+		}
+		_, err := UnaryServerInterceptor(context.Background(), nil, info, handler)
+		if strings.Contains(err.Error(), secret) {
+			t.Errorf("error %q contains the secret key", err)
+		}
+		if status.Code(err) != codes.Internal {
+			t.Errorf("code = %s, want %s", status.Code(err), codes.Internal)
+		}
+	})
+
+	t.Run("wrapped error", func(t *testing.T) {
+		handler := func(context.Context, any) (any, error) {
+			return nil, errors.New("failed: Authorization: Basic Y29zaTpodW50ZXIy")
+		}
+		_, err := UnaryServerInterceptor(context.Background(), nil, info, handler)
+		if strings.Contains(err.Error(), "Y29zaTpodW50ZXIy") {
+			t.Errorf("error %q contains the credentials", err)
+		}
+	})
+
+	t.Run("response", func(t *testing.T) {
+		handler := func(context.Context, any) (any, error) {
+			return grantResponse(), nil
+		}
+		resp, err := UnaryServerInterceptor(context.Background(), nil, info, handler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The credentials are sent to the sidecar.
+		if got := resp.(*cosi.DriverGrantBucketAccessResponse).Credentials["s3"].Secrets["accessSecretKey"]; got != secret {
+			t.Errorf("secret key = %q, want it unchanged", got)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+)
+
+var tracer = otel.Tracer("github.com/japannext/cosi-powerscale/pkg/tracing")
+
+// Span names of the provisioner RPCs.
+var spanNames = map[string]string{
+	"/cosi.v1alpha1.Provisioner/DriverCreateBucket":       powerscale.CreateBucketTraceName,
+	"/cosi.v1alpha1.Provisioner/DriverDeleteBucket":       powerscale.DeleteBucketTraceName,
+	"/cosi.v1alpha1.Provisioner/DriverGrantBucketAccess":  powerscale.GrantBucketAccessTraceName,
+	"/cosi.v1alpha1.Provisioner/DriverRevokeBucketAccess": powerscale.RevokeBucketAccessTraceName,
+}
+
+// metadataCarrier reads the trace context from the gRPC metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// UnaryServerInterceptor starts the span of a gRPC request, continuing the
+// trace propagated in the request metadata, if any.
+func UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	}
+	name, ok := spanNames[info.FullMethod]
+	if !ok {
+		name = info.FullMethod
+	}
+	ctx, span := tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.method", info.FullMethod),
+		))
+	defer span.End()
+
+	resp, err := handler(ctx, req)
+	code := status.Code(err)
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(code)))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, code.String())
+	}
+	return resp, err
+}
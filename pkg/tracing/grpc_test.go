@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/japannext/cosi-powerscale/pkg/powerscale"
+	"github.com/japannext/cosi-powerscale/pkg/powerscale/fake"
+)
+
+const (
+	// Trace context of the sidecar, in the W3C traceparent format.
+	traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	traceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	parentID    = "00f067aa0ba902b7"
+)
+
+// The tracers of the packages are bound to the first registered provider,
+// so the spans of all the tests are recorded by the same recorder.
+var recorder = tracetest.NewSpanRecorder()
+
+func TestMain(m *testing.M) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	os.Exit(m.Run())
+}
+
+// endedSpans returns the spans ended by fn.
+func endedSpans(fn func()) []sdktrace.ReadOnlySpan {
+	before := len(recorder.Ended())
+	fn()
+	return recorder.Ended()[before:]
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	server := fake.NewServer()
+	defer server.Close()
+	client := powerscale.New(server.Config())
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", traceParent))
+	info := &grpc.UnaryServerInfo{FullMethod: "/cosi.v1alpha1.Provisioner/DriverCreateBucket"}
+	handler := func(ctx context.Context, req any) (any, error) {
+		if !trace.SpanFromContext(ctx).IsRecording() {
+			t.Error("the handler must run in the span of the request")
+		}
+		_, err := client.WithContext(ctx).GetBucket("bucket-1")
+		return nil, err
+	}
+	spans := endedSpans(func() {
+		if _, err := UnaryServerInterceptor(ctx, nil, info, handler); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if len(spans) != 2 {
+		t.Fatalf("expected the spans of the request and of the OneFS call, got %d", len(spans))
+	}
+	call, request := spans[0], spans[1]
+	if request.Name() != powerscale.CreateBucketTraceName || request.SpanKind() != trace.SpanKindServer {
+		t.Errorf("unexpected request span %s (%s)", request.Name(), request.SpanKind())
+	}
+	// The request span continues the trace of the sidecar.
+	if request.SpanContext().TraceID().String() != traceID || request.Parent().SpanID().String() != parentID || !request.Parent().IsRemote() {
+		t.Errorf("unexpected parent %s/%s", request.Parent().TraceID(), request.Parent().SpanID())
+	}
+	if call.Parent().SpanID() != request.SpanContext().SpanID() || call.SpanKind() != trace.SpanKindClient {
+		t.Errorf("expected the OneFS span %s to be a child of the request span", call.Name())
+	}
+	if call.Name() != "OneFS GET /platform/14/protocols/s3/buckets/{name}" {
+		t.Errorf("unexpected OneFS span %s", call.Name())
+	}
+}
+
+func TestUnaryServerInterceptorError(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/cosi.v1alpha1.Identity/DriverGetInfo"}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return nil, status.Error(codes.Unavailable, "unavailable")
+	}
+	spans := endedSpans(func() {
+		if _, err := UnaryServerInterceptor(context.Background(), nil, info, handler); status.Code(err) != codes.Unavailable {
+			t.Fatalf("expected the error of the handler, got %v", err)
+		}
+	})
+	if len(spans) != 1 {
+		t.Fatalf("expected one span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != info.FullMethod || span.Parent().IsValid() {
+		t.Errorf("expected a root span named after the method, got %s", span.Name())
+	}
+	if span.Status().Code != otelcodes.Error {
+		t.Errorf("unexpected status %+v", span.Status())
+	}
+}
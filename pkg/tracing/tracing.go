@@ -0,0 +1,67 @@
+// Package tracing exports OpenTelemetry traces over OTLP: a span per gRPC
+// request, continuing the trace of the sidecar when it sends one, with a
+// child span per OneFS API request.
+//
+// Tracing is off by default. It is enabled by setting the standard
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT variable,
+// and configured by the other OTEL_* variables (OTEL_SERVICE_NAME,
+// OTEL_RESOURCE_ATTRIBUTES, OTEL_TRACES_SAMPLER, ...).
+package tracing
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	log "k8s.io/klog/v2"
+)
+
+const serviceName = "cosi-powerscale"
+
+// Enabled reports whether the environment configures an OTLP endpoint and
+// does not disable tracing.
+func Enabled() bool {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") || os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Setup registers the OTLP tracer provider when tracing is enabled, and
+// returns the function flushing and stopping it.
+func Setup(ctx context.Context, driverName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES variables override
+	// the defaults.
+	res, err := resource.Merge(
+		resource.NewSchemaless(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceInstanceID(driverName),
+		),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	log.InfoS("Tracing enabled")
+	return provider.Shutdown, nil
+}